@@ -1,59 +1,192 @@
 package main
 
 import (
-	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 
-	pb "github.com/grpc-ecosystem/go-grpc-prometheus/examples/grpc-server-with-prometheus/protobuf"
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	pb "github.com/positiveblue/poc-grpc-prometheus/protobuf"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 )
 
-func main() {
+var (
+	// Create a metrics registry.
+	reg = prom.NewRegistry()
 
-	conn, err := grpc.Dial(
-		fmt.Sprintf("localhost:%v", 9093),
-		grpc.WithInsecure(),
-	)
-	if err != nil {
-		log.Fatal(err)
-	}
+	// Create some standard client metrics.
+	grpcMetrics = grpcprom.NewClientMetrics()
 
-	defer conn.Close()
+	// Create the metrics of the connections and the RPCs killed by the transport.
+	transportMetrics = grpcprom.NewTransportMetrics()
 
-	// Create a gRPC server client.
-	client := pb.NewDemoServiceClient(conn)
-	fmt.Println("Start to call the method called SayHello every 3 seconds")
-	go func() {
-		for {
+	// Create the metrics of the deadline budget given to the calls, keeping 50ms for the client.
+	budgetMetrics = grpcprom.NewDeadlineBudgetMetrics(50*time.Millisecond, grpcprom.DefBudgetBuckets)
+)
+
+func init() {
+	// Register standard client metrics to registry.
+	reg.MustRegister(grpcMetrics)
+	reg.MustRegister(transportMetrics)
+	reg.MustRegister(budgetMetrics)
+}
+
+// callTimeout bounds every SayHello call so in-flight calls can always be drained on shutdown.
+const callTimeout = 5 * time.Second
+
+// sayHello calls the SayHello method with its own deadline, independent of the shutdown context,
+// so a call which already started is allowed to finish and be recorded by the client metrics.
+func sayHello(client pb.DemoServiceClient, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	_, err := client.SayHello(ctx, &pb.HelloRequest{Name: name})
+	return err
+}
+
+// callLoop calls the SayHello method every 3 seconds until the context is cancelled.
+func callLoop(ctx context.Context, client pb.DemoServiceClient) {
+	for {
+		for _, name := range []string{"Test", "Test111"} {
 			// Call “SayHello” method and wait for response from gRPC Server.
-			_, err := client.SayHello(context.Background(), &pb.HelloRequest{Name: "Test"})
-			if err != nil {
+			if err := sayHello(client, name); err != nil {
 				log.Printf("Calling the SayHello method unsuccessfully. ErrorInfo: %+v", err)
-				log.Printf("You should to stop the process")
-				return
 			}
-			time.Sleep(3 * time.Second)
 
-			_, err = client.SayHello(context.Background(), &pb.HelloRequest{Name: "Test111"})
-			if err != nil {
-				log.Printf("Calling the SayHello method unsuccessfully. ErrorInfo: %+v", err)
-				log.Printf("You should to stop the process")
+			select {
+			case <-ctx.Done():
 				return
+			case <-time.After(3 * time.Second):
+			}
+		}
+	}
+}
+
+// printLatencyReport logs the number of calls and the average latency observed per method.
+func printLatencyReport(g prom.Gatherer) {
+	families, err := g.Gather()
+	if err != nil {
+		log.Printf("Unable to gather the client metrics: %v", err)
+		return
+	}
+
+	for _, family := range families {
+		if family.GetName() != "grpc_client_handling_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			h := metric.GetHistogram()
+			if h.GetSampleCount() == 0 {
+				continue
 			}
-			time.Sleep(3 * time.Second)
+			log.Printf("%s: %d calls, %.4fs average latency", metricLabelString(metric), h.GetSampleCount(), h.GetSampleSum()/float64(h.GetSampleCount()))
+		}
+	}
+}
+
+func metricLabelString(metric *dto.Metric) string {
+	var pairs []string
+	for _, pair := range metric.GetLabel() {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", pair.GetName(), pair.GetValue()))
+	}
+	return strings.Join(pairs, " ")
+}
+
+func main() {
+	scenarioName := flag.String("scenario", "steady", fmt.Sprintf("scenario to run, one of %s", strings.Join(scenarioNames(), ", ")))
+	scenarioFile := flag.String("scenario-file", "", "JSON or YAML scenario file to run instead of -scenario")
+	target := flag.String("target", "localhost:9093", "gRPC target of the server, e.g. unix:///tmp/demo.sock")
+	flag.Parse()
+
+	run, ok := scenarios[*scenarioName]
+	if !ok {
+		log.Fatalf("Unknown scenario %q", *scenarioName)
+	}
+	if *scenarioFile != "" {
+		sf, err := loadScenarioFile(*scenarioFile)
+		if err != nil {
+			log.Fatal(err)
 		}
+		run = sf.scenario()
+		*scenarioName = *scenarioFile
+	}
+
+	// Cancel the context on SIGINT/SIGTERM.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("Received %v, stopping the client", sig)
+		cancel()
 	}()
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Println("You can press n or N to stop the process of client")
-	for scanner.Scan() {
-		if strings.ToLower(scanner.Text()) == "n" {
-			os.Exit(0)
+
+	// Create a HTTP server for prometheus.
+	httpServer := &http.Server{Handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), Addr: fmt.Sprintf("0.0.0.0:%d", 9094)}
+
+	// Start your http server for prometheus.
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Unable to start a http server.")
 		}
+	}()
+
+	dial := func() (*grpc.ClientConn, error) {
+		return grpc.Dial(
+			*target,
+			grpc.WithTransportCredentials(transportMetrics.Credentials(insecure.NewCredentials())),
+			grpc.WithChainUnaryInterceptor(
+				grpcMetrics.UnaryClientInterceptor(),
+				grpcprom.SendTimeUnaryClientInterceptor(),
+				budgetMetrics.UnaryClientInterceptor(),
+			),
+			grpc.WithStatsHandler(transportMetrics.ClientHandler()),
+		)
+	}
+
+	conn, err := dial()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	fmt.Printf("Start to call the method called SayHello using the %s scenario\n", *scenarioName)
+	fmt.Println("You can press Ctrl+C to stop the process of client")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run(ctx, conn, dial)
+		// Finite scenarios stop the client once they are done.
+		cancel()
+	}()
+
+	// Wait for the signal, or the end of the scenario, and drain the in-flight calls.
+	<-ctx.Done()
+	wg.Wait()
+
+	printLatencyReport(reg)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Unable to stop the http server: %v", err)
 	}
 }
@@ -1,9 +1,36 @@
 module github.com/positiveblue/poc-grpc-prometheus/client
 
-go 1.13
+go 1.23.0
 
 require (
-	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0 // indirect
-	github.com/prometheus/client_golang v1.4.1 // indirect
-	google.golang.org/grpc v1.27.1 // indirect
+	github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom v0.0.0
+	github.com/positiveblue/poc-grpc-prometheus/protobuf v0.0.0
+	github.com/prometheus/client_golang v1.19.1
+	github.com/prometheus/client_model v0.5.0
+	google.golang.org/grpc v1.72.1
+	gopkg.in/yaml.v2 v2.4.0
 )
+
+require (
+	connectrpc.com/connect v1.16.1 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/cncf/xds/go v0.0.0-20250121191232-2f005788dc42 // indirect
+	github.com/envoyproxy/protoc-gen-validate v1.2.1 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	github.com/twitchtv/twirp v8.1.3+incompatible // indirect
+	go.opentelemetry.io/otel v1.35.0 // indirect
+	go.opentelemetry.io/otel/trace v1.35.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	golang.org/x/time v0.5.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250528174236-200df99c418a // indirect
+	google.golang.org/protobuf v1.36.6 // indirect
+)
+
+replace github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom => ../pkg/grpcprom
+
+replace github.com/positiveblue/poc-grpc-prometheus/protobuf => ../protobuf
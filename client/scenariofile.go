@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/yaml.v2"
+
+	pb "github.com/positiveblue/poc-grpc-prometheus/protobuf"
+)
+
+// injectErrorKey is the metadata key the demo server reads to fail a call with the given code.
+const injectErrorKey = "x-inject-error"
+
+// ScenarioFile describes a reproducible load shape as a list of phases run one after the other.
+type ScenarioFile struct {
+	// Seed makes the error injection decisions reproducible between runs.
+	Seed   int64   `json:"seed" yaml:"seed"`
+	Phases []Phase `json:"phases" yaml:"phases"`
+}
+
+// Phase is a period of time during which the request rate ramps linearly from RPSStart to RPSEnd.
+type Phase struct {
+	Name     string  `json:"name" yaml:"name"`
+	Duration string  `json:"duration" yaml:"duration"`
+	RPSStart float64 `json:"rps_start" yaml:"rps_start"`
+	RPSEnd   float64 `json:"rps_end" yaml:"rps_end"`
+	// InjectErrors asks the server to fail a fraction of the calls with the given code.
+	InjectErrors *ErrorInjection `json:"inject_errors" yaml:"inject_errors"`
+	// Metadata is sent with every call of the phase.
+	Metadata map[string]string `json:"metadata" yaml:"metadata"`
+
+	duration time.Duration
+}
+
+// ErrorInjection configures which fraction of the calls the server must fail and with which code.
+type ErrorInjection struct {
+	Rate float64 `json:"rate" yaml:"rate"`
+	Code string  `json:"code" yaml:"code"`
+}
+
+// loadScenarioFile reads a scenario from a .json, .yaml or .yml file.
+func loadScenarioFile(path string) (*ScenarioFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sf ScenarioFile
+	switch filepath.Ext(path) {
+	case ".json":
+		// Like the YAML files, the misspelled fields are errors instead of being silently ignored.
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&sf); err == nil && decoder.More() {
+			err = fmt.Errorf("unexpected data after the scenario")
+		}
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, &sf)
+	default:
+		return nil, fmt.Errorf("unknown scenario file extension %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse scenario file %s: %v", path, err)
+	}
+
+	if len(sf.Phases) == 0 {
+		return nil, fmt.Errorf("scenario file %s has no phases", path)
+	}
+	for i := range sf.Phases {
+		p := &sf.Phases[i]
+		if p.duration, err = time.ParseDuration(p.Duration); err != nil {
+			return nil, fmt.Errorf("phase %d (%s): invalid duration: %v", i, p.Name, err)
+		}
+		if p.RPSStart < 0 || p.RPSEnd < 0 {
+			return nil, fmt.Errorf("phase %d (%s): rps must not be negative", i, p.Name)
+		}
+		if p.InjectErrors != nil && (p.InjectErrors.Rate < 0 || p.InjectErrors.Rate > 1) {
+			return nil, fmt.Errorf("phase %d (%s): error rate must be between 0 and 1", i, p.Name)
+		}
+	}
+	return &sf, nil
+}
+
+// scenario returns the scenario which runs every phase of the file once.
+func (sf *ScenarioFile) scenario() scenario {
+	return func(ctx context.Context, conn *grpc.ClientConn, _ dialFunc) {
+		client := pb.NewDemoServiceClient(conn)
+		rnd := rand.New(rand.NewSource(sf.Seed))
+
+		var wg sync.WaitGroup
+		defer wg.Wait()
+
+		for i := range sf.Phases {
+			p := &sf.Phases[i]
+			log.Printf("Starting phase %q: %s from %.1f to %.1f rps", p.Name, p.duration, p.RPSStart, p.RPSEnd)
+			if !p.run(ctx, client, rnd, &wg) {
+				return
+			}
+		}
+	}
+}
+
+// rps returns the target request rate after elapsed time in the phase.
+func (p *Phase) rps(elapsed time.Duration) float64 {
+	if p.duration <= 0 {
+		return p.RPSEnd
+	}
+	progress := float64(elapsed) / float64(p.duration)
+	return p.RPSStart + (p.RPSEnd-p.RPSStart)*progress
+}
+
+// run issues calls at the phase rate until the phase is over. It returns false if the context
+// was cancelled before the phase finished.
+func (p *Phase) run(ctx context.Context, client pb.DemoServiceClient, rnd *rand.Rand, wg *sync.WaitGroup) bool {
+	name := p.Name
+	start := time.Now()
+	for {
+		elapsed := time.Since(start)
+		if elapsed >= p.duration {
+			return true
+		}
+
+		wait := 100 * time.Millisecond
+		if rps := p.rps(elapsed); rps > 0 {
+			md := metadata.New(p.Metadata)
+			if p.InjectErrors != nil && rnd.Float64() < p.InjectErrors.Rate {
+				md.Set(injectErrorKey, p.InjectErrors.Code)
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				callCtx, cancel := context.WithTimeout(metadata.NewOutgoingContext(context.Background(), md), callTimeout)
+				defer cancel()
+				if _, err := client.SayHello(callCtx, &pb.HelloRequest{Name: name}); err != nil {
+					log.Printf("Calling the SayHello method unsuccessfully. ErrorInfo: %+v", err)
+				}
+			}()
+			wait = time.Duration(float64(time.Second) / rps)
+		}
+		// A low rate must not make the phase outlast its duration.
+		if left := p.duration - elapsed; wait > left {
+			wait = left
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/positiveblue/poc-grpc-prometheus/protobuf"
+)
+
+// dialFunc opens a new instrumented connection to the demo server.
+type dialFunc func() (*grpc.ClientConn, error)
+
+// scenario drives calls against the demo server until the context is cancelled.
+type scenario func(ctx context.Context, conn *grpc.ClientConn, dial dialFunc)
+
+// scenarios contains the load shapes the client can run, selected with the -scenario flag.
+var scenarios = map[string]scenario{
+	// steady calls the SayHello method every 3 seconds on a single connection.
+	"steady": func(ctx context.Context, conn *grpc.ClientConn, _ dialFunc) {
+		callLoop(ctx, pb.NewDemoServiceClient(conn))
+	},
+	// cancel starts calls and abruptly cancels them after a random delay, so the
+	// Canceled code shows up on both the client and the server metrics.
+	"cancel": func(ctx context.Context, conn *grpc.ClientConn, _ dialFunc) {
+		cancelLoop(ctx, pb.NewDemoServiceClient(conn))
+	},
+	// churn opens a new connection for every few calls and closes it right after,
+	// exercising connection setup and teardown instead of the steady state.
+	"churn": func(ctx context.Context, _ *grpc.ClientConn, dial dialFunc) {
+		churnLoop(ctx, dial)
+	},
+	// stream keeps a SayHelloStream stream open for minutes, sending a name every second, so the
+	// open streams and the per-message metrics show up next to the unary ones.
+	"stream": func(ctx context.Context, conn *grpc.ClientConn, _ dialFunc) {
+		streamLoop(ctx, pb.NewDemoServiceClient(conn))
+	},
+}
+
+// scenarioNames returns the sorted names of the available scenarios.
+func scenarioNames() []string {
+	var names []string
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cancelLoop calls the SayHello method with a context which is cancelled after up to 2ms.
+func cancelLoop(ctx context.Context, client pb.DemoServiceClient) {
+	for {
+		callCtx, cancel := context.WithCancel(context.Background())
+		timer := time.AfterFunc(time.Duration(rand.Int63n(int64(2*time.Millisecond))), cancel)
+
+		_, err := client.SayHello(callCtx, &pb.HelloRequest{Name: "Cancel"})
+		if err != nil {
+			log.Printf("SayHello call was cancelled: %v", err)
+		}
+		timer.Stop()
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// churnLoop dials a new connection, makes a few calls and closes it, over and over.
+func churnLoop(ctx context.Context, dial dialFunc) {
+	for i := 0; ; i++ {
+		conn, err := dial()
+		if err != nil {
+			log.Printf("Unable to dial the demo server: %v", err)
+		} else {
+			client := pb.NewDemoServiceClient(conn)
+			for j := 0; j < 3; j++ {
+				if err := sayHello(client, fmt.Sprintf("Churn%d", i)); err != nil {
+					log.Printf("Calling the SayHello method unsuccessfully. ErrorInfo: %+v", err)
+				}
+			}
+			conn.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// streamLifetime is the time each stream of the stream scenario stays open before it's closed
+// and a new one is opened.
+const streamLifetime = 5 * time.Minute
+
+// streamLoop opens a SayHelloStream stream and sends a name on it every second, replacing it
+// every streamLifetime or when it fails.
+func streamLoop(ctx context.Context, client pb.DemoServiceClient) {
+	for i := 0; ; i++ {
+		if err := greetStream(ctx, client, fmt.Sprintf("Stream%d", i)); err != nil {
+			log.Printf("Calling the SayHelloStream method unsuccessfully. ErrorInfo: %+v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// greetStream sends the name on a new stream every second, until the context is cancelled or
+// streamLifetime has passed, and then closes the stream gracefully.
+func greetStream(ctx context.Context, client pb.DemoServiceClient, name string) error {
+	// The stream isn't canceled with the shutdown context, so it's closed with an OK status.
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.SayHelloStream(streamCtx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(streamLifetime)
+	for {
+		if err := stream.Send(&pb.HelloRequest{Name: name}); err != nil {
+			return err
+		}
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-deadline:
+		case <-ticker.C:
+			continue
+		}
+		if err := stream.CloseSend(); err != nil {
+			return err
+		}
+		if _, err := stream.Recv(); err != io.EOF {
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,293 @@
+// gen-dashboard generates a Grafana dashboard with the RED (rate, errors, duration) panels of
+// every method of the services instrumented by grpcprom, so the dashboards follow the
+// instrumentation instead of being edited by hand.
+//
+// The methods are read from a descriptor set of the services, written by protoc, and listed
+// with grpcprom.Methods like the ones registered on a server, or given with -method:
+//
+//	protoc -I . --include_imports --descriptor_set_out=service.pb service.proto
+//	gen-dashboard -descriptor-set service.pb -labels userName > dashboard.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+// stringsFlag is a flag which can be repeated.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// config holds the metric names and labels of the instrumentation.
+type config struct {
+	title         string
+	handledMetric string
+	latencyMetric string
+	labels        []string
+}
+
+// descriptorServices is the grpcprom.ServiceInfoProvider of the services of a descriptor set.
+type descriptorServices map[string]grpc.ServiceInfo
+
+func (s descriptorServices) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return s
+}
+
+// readMethods returns the methods of the services of the descriptor set.
+func readMethods(path string) ([]grpcprom.Method, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+
+	services := descriptorServices{}
+	for _, file := range set.GetFile() {
+		for _, service := range file.GetService() {
+			name := service.GetName()
+			if file.GetPackage() != "" {
+				name = file.GetPackage() + "." + name
+			}
+			info := grpc.ServiceInfo{}
+			for _, method := range service.GetMethod() {
+				info.Methods = append(info.Methods, grpc.MethodInfo{
+					Name:           method.GetName(),
+					IsClientStream: method.GetClientStreaming(),
+					IsServerStream: method.GetServerStreaming(),
+				})
+			}
+			services[name] = info
+		}
+	}
+	return grpcprom.Methods(services), nil
+}
+
+// parseMethod returns the unary method of a full method name, like grpcprom splits them.
+func parseMethod(fullMethod string) (grpcprom.Method, error) {
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return grpcprom.Method{}, fmt.Errorf("invalid method %q, expected /package.Service/Method", fullMethod)
+	}
+	return grpcprom.Method{Service: parts[0], Name: parts[1], Type: grpcprom.Unary}, nil
+}
+
+type target struct {
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+	RefID        string `json:"refId"`
+}
+
+type gridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type panel struct {
+	ID          int               `json:"id"`
+	Type        string            `json:"type"`
+	Title       string            `json:"title"`
+	GridPos     gridPos           `json:"gridPos"`
+	Datasource  map[string]string `json:"datasource,omitempty"`
+	Targets     []target          `json:"targets,omitempty"`
+	FieldConfig *fieldConfig      `json:"fieldConfig,omitempty"`
+}
+
+type fieldConfig struct {
+	Defaults map[string]string `json:"defaults"`
+}
+
+type variable struct {
+	Name       string            `json:"name"`
+	Label      string            `json:"label,omitempty"`
+	Type       string            `json:"type"`
+	Query      string            `json:"query"`
+	Datasource map[string]string `json:"datasource,omitempty"`
+	IncludeAll bool              `json:"includeAll,omitempty"`
+	Multi      bool              `json:"multi,omitempty"`
+	AllValue   string            `json:"allValue,omitempty"`
+}
+
+type dashboard struct {
+	Title         string                `json:"title"`
+	UID           string                `json:"uid"`
+	SchemaVersion int                   `json:"schemaVersion"`
+	Time          map[string]string     `json:"time"`
+	Templating    map[string][]variable `json:"templating"`
+	Panels        []panel               `json:"panels"`
+}
+
+var datasource = map[string]string{"type": "prometheus", "uid": "${datasource}"}
+
+// labelSelector returns the selector of the method, filtered by the label variables.
+func (c config) labelSelector(service, method string) string {
+	matchers := []string{
+		fmt.Sprintf("grpc_service=%q", service),
+		fmt.Sprintf("grpc_method=%q", method),
+	}
+	for _, label := range c.labels {
+		matchers = append(matchers, fmt.Sprintf("%s=~\"$%s\"", label, label))
+	}
+	return strings.Join(matchers, ", ")
+}
+
+// generate returns the dashboard with one row per service and the RED panels of its methods. The
+// duration of the streaming methods is the lifetime of their streams.
+func generate(c config, methods []grpcprom.Method) *dashboard {
+	d := &dashboard{
+		Title:         c.title,
+		UID:           strings.ToLower(strings.ReplaceAll(c.title, " ", "-")),
+		SchemaVersion: 39,
+		Time:          map[string]string{"from": "now-1h", "to": "now"},
+		Templating: map[string][]variable{"list": {{
+			Name:  "datasource",
+			Label: "Data source",
+			Type:  "datasource",
+			Query: "prometheus",
+		}}},
+	}
+	for _, label := range c.labels {
+		d.Templating["list"] = append(d.Templating["list"], variable{
+			Name:       label,
+			Type:       "query",
+			Query:      fmt.Sprintf("label_values(%s, %s)", c.handledMetric, label),
+			Datasource: datasource,
+			IncludeAll: true,
+			Multi:      true,
+			AllValue:   ".*",
+		})
+	}
+
+	byService := map[string][]grpcprom.Method{}
+	for _, method := range methods {
+		byService[method.Service] = append(byService[method.Service], method)
+	}
+	services := make([]string, 0, len(byService))
+	for service := range byService {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	id, y := 1, 0
+	for _, service := range services {
+		d.Panels = append(d.Panels, panel{ID: id, Type: "row", Title: service, GridPos: gridPos{H: 1, W: 24, Y: y}})
+		id, y = id+1, y+1
+
+		methods := byService[service]
+		sort.Slice(methods, func(i, j int) bool {
+			return methods[i].Name < methods[j].Name
+		})
+		for _, m := range methods {
+			method := m.Name
+			duration := " p99 duration"
+			if m.Type != grpcprom.Unary {
+				duration = " p99 stream duration"
+			}
+			selector := c.labelSelector(service, method)
+			panels := []struct {
+				title string
+				unit  string
+				expr  string
+			}{
+				{
+					title: method + " rate",
+					unit:  "reqps",
+					expr:  fmt.Sprintf("sum by (grpc_status) (rate(%s{%s}[$__rate_interval]))", c.handledMetric, selector),
+				},
+				{
+					title: method + " errors",
+					unit:  "percentunit",
+					expr: fmt.Sprintf("sum(rate(%s{%s, grpc_status!=\"OK\"}[$__rate_interval])) / sum(rate(%s{%s}[$__rate_interval]))",
+						c.handledMetric, selector, c.handledMetric, selector),
+				},
+				{
+					title: method + duration,
+					unit:  "s",
+					expr:  fmt.Sprintf("histogram_quantile(0.99, sum by (le) (rate(%s_bucket{%s}[$__rate_interval])))", c.latencyMetric, selector),
+				},
+			}
+			for i, p := range panels {
+				d.Panels = append(d.Panels, panel{
+					ID:          id,
+					Type:        "timeseries",
+					Title:       p.title,
+					GridPos:     gridPos{H: 8, W: 8, X: 8 * i, Y: y},
+					Datasource:  datasource,
+					Targets:     []target{{Expr: p.expr, LegendFormat: "__auto", RefID: "A"}},
+					FieldConfig: &fieldConfig{Defaults: map[string]string{"unit": p.unit}},
+				})
+				id++
+			}
+			y += 8
+		}
+	}
+	return d
+}
+
+func main() {
+	var (
+		c           config
+		fullMethods stringsFlag
+		labels      string
+	)
+	descriptorSet := flag.String("descriptor-set", "", "descriptor set of the services, written by protoc --descriptor_set_out")
+	flag.Var(&fullMethods, "method", "full method name (/package.Service/Method) to add, can be repeated")
+	flag.StringVar(&c.title, "title", "gRPC services", "title of the dashboard")
+	flag.StringVar(&c.handledMetric, "handled-metric", "grpc_server_handled_total", "name of the handled RPCs counter")
+	flag.StringVar(&c.latencyMetric, "latency-metric", "grpc_server_handling_seconds", "name of the handling time histogram")
+	flag.StringVar(&labels, "labels", "", "comma separated custom labels of the LabelExtractor, added as dashboard variables")
+	flag.Parse()
+
+	var methods []grpcprom.Method
+	if *descriptorSet != "" {
+		m, err := readMethods(*descriptorSet)
+		if err != nil {
+			log.Fatalf("failed to read the services: %v", err)
+		}
+		methods = m
+	}
+	for _, fullMethod := range fullMethods {
+		method, err := parseMethod(fullMethod)
+		if err != nil {
+			log.Fatal(err)
+		}
+		methods = append(methods, method)
+	}
+	if len(methods) == 0 {
+		log.Fatal("no method given, use -descriptor-set or -method")
+	}
+	if labels != "" {
+		c.labels = strings.Split(labels, ",")
+	}
+
+	d := generate(c, methods)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		log.Fatalf("failed to write the dashboard: %v", err)
+	}
+}
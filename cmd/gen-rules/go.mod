@@ -0,0 +1,5 @@
+module github.com/positiveblue/poc-grpc-prometheus/cmd/gen-rules
+
+go 1.23.0
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,195 @@
+// gen-rules generates the Prometheus recording rules (per-method p99 latency and error ratios)
+// and the burn-rate alerting rules of the per-method SLOs, so the alerts use the same metric
+// names, labels and error codes as the grpcprom instrumentation.
+//
+// The SLOs are read from a YAML file keyed by full method name:
+//
+//	methods:
+//	  /proto.DemoService/SayHello:
+//	    latency: 100ms
+//	    error_rate: 0.01
+//
+//	gen-rules -slos slos.yaml > rules.yaml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errorCodes are the codes counted as errors, the same ones as the grpcprom SLOs: the codes
+// meaning the server failed, not the ones caused by an invalid request.
+const errorCodes = "Unknown|DeadlineExceeded|Unimplemented|Internal|Unavailable|DataLoss|ResourceExhausted"
+
+// errorWindows are the windows of the recorded error ratios used by the burn-rate alerts.
+var errorWindows = []string{"5m", "30m", "1h", "6h"}
+
+// burnRate is a multiwindow burn-rate alert: it fires when the error budget is consumed factor
+// times faster than allowed over both windows.
+type burnRate struct {
+	severity    string
+	factor      float64
+	long, short string
+}
+
+var burnRates = []burnRate{
+	{severity: "page", factor: 14.4, long: "1h", short: "5m"},
+	{severity: "ticket", factor: 6, long: "6h", short: "30m"},
+}
+
+// slo is the objective of a method, like grpcprom.SLO.
+type slo struct {
+	Latency   time.Duration `yaml:"latency"`
+	ErrorRate float64       `yaml:"error_rate"`
+}
+
+type sloFile struct {
+	Methods map[string]slo `yaml:"methods"`
+}
+
+type rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type ruleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []rule `yaml:"rules"`
+}
+
+type ruleFile struct {
+	Groups []ruleGroup `yaml:"groups"`
+}
+
+// config holds the metric names of the instrumentation.
+type config struct {
+	handledMetric string
+	latencyMetric string
+}
+
+// splitMethod splits a full method name into its service and method, like grpcprom does.
+func splitMethod(fullMethod string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(fullMethod, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid method %q, expected /package.Service/Method", fullMethod)
+	}
+	return parts[0], parts[1], nil
+}
+
+func (c config) p99Record() string {
+	return "grpc_service_method:" + c.latencyMetric + ":p99_rate5m"
+}
+
+func (c config) errorRatioRecord(window string) string {
+	return "grpc_service_method:grpc_server_error_ratio:rate" + window
+}
+
+// recordingRules returns the per-method p99 latency and error ratios of every method.
+func (c config) recordingRules() ruleGroup {
+	group := ruleGroup{Name: "grpc_server_methods", Rules: []rule{{
+		Record: c.p99Record(),
+		Expr:   fmt.Sprintf("histogram_quantile(0.99, sum by (grpc_service, grpc_method, le) (rate(%s_bucket[5m])))", c.latencyMetric),
+	}}}
+	for _, window := range errorWindows {
+		group.Rules = append(group.Rules, rule{
+			Record: c.errorRatioRecord(window),
+			Expr: fmt.Sprintf("sum by (grpc_service, grpc_method) (rate(%s{grpc_status=~%q}[%s]))\n/ sum by (grpc_service, grpc_method) (rate(%s[%s]))",
+				c.handledMetric, errorCodes, window, c.handledMetric, window),
+		})
+	}
+	return group
+}
+
+// alertingRules returns the burn-rate alerts of the error objectives and the alerts of the
+// latency objectives of the methods.
+func (c config) alertingRules(slos map[string]slo) (ruleGroup, error) {
+	methods := make([]string, 0, len(slos))
+	for fullMethod := range slos {
+		methods = append(methods, fullMethod)
+	}
+	sort.Strings(methods)
+
+	group := ruleGroup{Name: "grpc_server_slos"}
+	for _, fullMethod := range methods {
+		service, method, err := splitMethod(fullMethod)
+		if err != nil {
+			return ruleGroup{}, err
+		}
+		selector := fmt.Sprintf("{grpc_service=%q, grpc_method=%q}", service, method)
+		labels := func(severity string) map[string]string {
+			return map[string]string{"severity": severity, "grpc_service": service, "grpc_method": method}
+		}
+
+		s := slos[fullMethod]
+		if s.ErrorRate > 0 {
+			for _, b := range burnRates {
+				// Rounded so 14.4 * 0.01 is written as 0.144.
+				threshold := math.Round(b.factor*s.ErrorRate*1e9) / 1e9
+				group.Rules = append(group.Rules, rule{
+					Alert: "GRPCErrorBudgetBurn",
+					Expr: fmt.Sprintf("%s%s > %g\nand %s%s > %g",
+						c.errorRatioRecord(b.long), selector, threshold, c.errorRatioRecord(b.short), selector, threshold),
+					Labels: labels(b.severity),
+					Annotations: map[string]string{
+						"summary": fmt.Sprintf("%s is burning its %g error budget %gx too fast.", fullMethod, s.ErrorRate, b.factor),
+					},
+				})
+			}
+		}
+		if s.Latency > 0 {
+			group.Rules = append(group.Rules, rule{
+				Alert:  "GRPCLatencyObjective",
+				Expr:   fmt.Sprintf("%s%s > %g", c.p99Record(), selector, s.Latency.Seconds()),
+				For:    "10m",
+				Labels: labels("ticket"),
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("The p99 latency of %s is above its %s objective.", fullMethod, s.Latency),
+				},
+			})
+		}
+	}
+	return group, nil
+}
+
+func main() {
+	var c config
+	sloPath := flag.String("slos", "", "YAML file with the SLOs of the methods")
+	flag.StringVar(&c.handledMetric, "handled-metric", "grpc_server_handled_total", "name of the handled RPCs counter")
+	flag.StringVar(&c.latencyMetric, "latency-metric", "grpc_server_handling_seconds", "name of the handling time histogram")
+	flag.Parse()
+
+	if *sloPath == "" {
+		log.Fatal("no SLO file given, use -slos")
+	}
+	b, err := os.ReadFile(*sloPath)
+	if err != nil {
+		log.Fatalf("failed to read the SLOs: %v", err)
+	}
+	var slos sloFile
+	if err := yaml.Unmarshal(b, &slos); err != nil {
+		log.Fatalf("failed to decode the SLOs: %v", err)
+	}
+
+	alerts, err := c.alertingRules(slos.Methods)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(ruleFile{Groups: []ruleGroup{c.recordingRules(), alerts}}); err != nil {
+		log.Fatalf("failed to write the rules: %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+module github.com/positiveblue/poc-grpc-prometheus/cmd/lint-metrics
+
+go 1.23.0
+
+require (
+	github.com/prometheus/client_model v0.5.0
+	github.com/prometheus/common v0.48.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/kr/pretty v0.3.1 // indirect
+	google.golang.org/protobuf v1.32.0 // indirect
+)
@@ -0,0 +1,204 @@
+// lint-metrics scrapes the /metrics endpoint of an instrumented service and checks it exposes
+// the expected metric families, with their label names, histogram buckets and cardinality
+// limits. It exits with a non-zero status listing the problems, so it can run as a deploy-time
+// smoke test.
+//
+// The expectations are read from a YAML file:
+//
+//	max_series: 10000
+//	families:
+//	  grpc_server_handled_total:
+//	    type: counter
+//	    labels: [grpc_service, grpc_method, grpc_status]
+//	    max_series: 1000
+//	  grpc_server_handling_seconds:
+//	    type: histogram
+//	    labels: [grpc_service, grpc_method, grpc_status]
+//	    buckets: [0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10]
+//
+//	lint-metrics -url http://localhost:9092/metrics -spec metrics.yaml
+//
+// The -bearer-token flag, defaulting to $METRICS_TOKEN, authenticates the scrape of an endpoint
+// requiring a bearer token.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"gopkg.in/yaml.v3"
+)
+
+// familySpec is the expected shape of a metric family.
+type familySpec struct {
+	// Type is the lower case metric type, e.g. counter. Empty accepts any type.
+	Type string `yaml:"type"`
+	// Labels are the exact label names of every series, in any order.
+	Labels []string `yaml:"labels"`
+	// Buckets are the upper bounds of the histogram buckets, without +Inf.
+	Buckets []float64 `yaml:"buckets"`
+	// MaxSeries limits the number of series of the family, zero meaning no limit.
+	MaxSeries int `yaml:"max_series"`
+}
+
+// spec holds the expectations of the endpoint.
+type spec struct {
+	// MaxSeries limits the number of series of the endpoint, zero meaning no limit.
+	MaxSeries int                   `yaml:"max_series"`
+	Families  map[string]familySpec `yaml:"families"`
+}
+
+// scrape fetches and parses the text exposition format served at url, sending the bearer token
+// when not empty.
+func scrape(client *http.Client, url, token string) (map[string]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status scraping %s: %s", url, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// labelNames returns the sorted label names of the series.
+func labelNames(metric *dto.Metric) []string {
+	names := make([]string, 0, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		names = append(names, pair.GetName())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bucketBounds returns the upper bounds of the histogram buckets, without +Inf.
+func bucketBounds(metric *dto.Metric) []float64 {
+	var bounds []float64
+	for _, bucket := range metric.GetHistogram().GetBucket() {
+		if !math.IsInf(bucket.GetUpperBound(), 1) {
+			bounds = append(bounds, bucket.GetUpperBound())
+		}
+	}
+	return bounds
+}
+
+func equalFloats(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// lintFamily returns the problems of the family against its spec.
+func lintFamily(name string, family *dto.MetricFamily, fs familySpec) []string {
+	var problems []string
+	if fs.Type != "" && strings.ToLower(family.GetType().String()) != fs.Type {
+		problems = append(problems, fmt.Sprintf("%s: type %s, expected %s", name, strings.ToLower(family.GetType().String()), fs.Type))
+	}
+	if fs.MaxSeries > 0 && len(family.GetMetric()) > fs.MaxSeries {
+		problems = append(problems, fmt.Sprintf("%s: %d series, above the limit of %d", name, len(family.GetMetric()), fs.MaxSeries))
+	}
+
+	expectedLabels := append([]string(nil), fs.Labels...)
+	sort.Strings(expectedLabels)
+	badLabels, badBuckets := false, false
+	for _, metric := range family.GetMetric() {
+		if fs.Labels != nil && !badLabels && strings.Join(labelNames(metric), ",") != strings.Join(expectedLabels, ",") {
+			problems = append(problems, fmt.Sprintf("%s: labels %v, expected %v", name, labelNames(metric), expectedLabels))
+			badLabels = true
+		}
+		if fs.Buckets != nil && !badBuckets && family.GetType() == dto.MetricType_HISTOGRAM && !equalFloats(bucketBounds(metric), fs.Buckets) {
+			problems = append(problems, fmt.Sprintf("%s: buckets %v, expected %v", name, bucketBounds(metric), fs.Buckets))
+			badBuckets = true
+		}
+	}
+	return problems
+}
+
+// lint returns the problems of the scraped families against the spec.
+func lint(families map[string]*dto.MetricFamily, s spec) []string {
+	var problems []string
+
+	names := make([]string, 0, len(s.Families))
+	for name := range s.Families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family, ok := families[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: missing", name))
+			continue
+		}
+		problems = append(problems, lintFamily(name, family, s.Families[name])...)
+	}
+
+	series := 0
+	for _, family := range families {
+		series += len(family.GetMetric())
+	}
+	if s.MaxSeries > 0 && series > s.MaxSeries {
+		problems = append(problems, fmt.Sprintf("%d series, above the limit of %d", series, s.MaxSeries))
+	}
+	return problems
+}
+
+func main() {
+	url := flag.String("url", "http://localhost:9092/metrics", "metrics endpoint to check")
+	specPath := flag.String("spec", "", "YAML file with the expected metric families")
+	token := flag.String("bearer-token", os.Getenv("METRICS_TOKEN"), "bearer token sent with the scrape")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of the scrape")
+	flag.Parse()
+
+	if *specPath == "" {
+		log.Fatal("no spec given, use -spec")
+	}
+	b, err := os.ReadFile(*specPath)
+	if err != nil {
+		log.Fatalf("failed to read the spec: %v", err)
+	}
+	var s spec
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		log.Fatalf("failed to decode the spec: %v", err)
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	families, err := scrape(client, *url, *token)
+	if err != nil {
+		log.Fatalf("failed to scrape %s: %v", *url, err)
+	}
+
+	problems := lint(families, s)
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+	log.Printf("%s matches the spec", *url)
+}
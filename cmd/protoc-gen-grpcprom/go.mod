@@ -0,0 +1,5 @@
+module github.com/positiveblue/poc-grpc-prometheus/cmd/protoc-gen-grpcprom
+
+go 1.23.0
+
+require google.golang.org/protobuf v1.36.6
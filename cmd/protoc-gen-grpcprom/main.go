@@ -0,0 +1,215 @@
+// protoc-gen-grpcprom generates the label extractors of the services from the (metrics.label)
+// options of their request messages, defined in proto/metrics/metrics.proto.
+//
+// For every message with annotated fields it generates a RequestLabels method returning the
+// field values, and for every service a LabelExtractor exposing the labels of its messages. The
+// label names must be valid Prometheus label names:
+//
+//	protoc -I . -I proto --go_out=. --grpcprom_out=. service.proto
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// labelFieldNumber is the field number of the (metrics.label) field option.
+const labelFieldNumber = 50101
+
+// labelNamePattern matches the valid Prometheus label names.
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+const (
+	fmtPackage      = protogen.GoImportPath("fmt")
+	grpcpromPackage = protogen.GoImportPath("github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom")
+)
+
+func main() {
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+		for _, f := range gen.Files {
+			if !f.Generate {
+				continue
+			}
+			if err := generateFile(gen, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// labeledField is a message field annotated with (metrics.label).
+type labeledField struct {
+	field *protogen.Field
+	label string
+}
+
+// fieldLabel returns the label name of the (metrics.label) option of the field, if any. The
+// option is read from the unknown fields, so the plugin does not depend on generated code for
+// metrics.proto.
+func fieldLabel(field *protogen.Field) (string, bool) {
+	opts, ok := field.Desc.Options().(*descriptorpb.FieldOptions)
+	if !ok || opts == nil {
+		return "", false
+	}
+
+	b := opts.ProtoReflect().GetUnknown()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return "", false
+		}
+		b = b[n:]
+
+		if num == labelFieldNumber && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return "", false
+			}
+			return string(v), true
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return "", false
+		}
+		b = b[n:]
+	}
+	return "", false
+}
+
+// labeledFields returns the annotated fields of the message, checking they can be labels.
+func labeledFields(message *protogen.Message) ([]labeledField, error) {
+	var fields []labeledField
+	for _, field := range message.Fields {
+		label, ok := fieldLabel(field)
+		if !ok {
+			continue
+		}
+
+		if label == "" {
+			return nil, fmt.Errorf("%s: empty (metrics.label)", field.Desc.FullName())
+		}
+		if !labelNamePattern.MatchString(label) || strings.HasPrefix(label, "__") {
+			return nil, fmt.Errorf("%s: %q is not a valid Prometheus label name", field.Desc.FullName(), label)
+		}
+		if field.Desc.IsList() || field.Desc.IsMap() {
+			return nil, fmt.Errorf("%s: repeated fields can not be labels", field.Desc.FullName())
+		}
+		switch field.Desc.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind, protoreflect.BytesKind:
+			return nil, fmt.Errorf("%s: %s fields can not be labels", field.Desc.FullName(), field.Desc.Kind())
+		}
+
+		fields = append(fields, labeledField{field: field, label: label})
+	}
+	return fields, nil
+}
+
+// allMessages returns the messages of the file, including the nested ones.
+func allMessages(messages []*protogen.Message) []*protogen.Message {
+	var res []*protogen.Message
+	for _, message := range messages {
+		res = append(res, message)
+		res = append(res, allMessages(message.Messages)...)
+	}
+	return res
+}
+
+// serviceLabelNames returns the label names of the request messages of the service methods,
+// without duplicates and in declaration order.
+func serviceLabelNames(service *protogen.Service) ([]string, error) {
+	var names []string
+	seen := map[string]bool{}
+	for _, method := range service.Methods {
+		fields, err := labeledFields(method.Input)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			if !seen[f.label] {
+				seen[f.label] = true
+				names = append(names, f.label)
+			}
+		}
+	}
+	return names, nil
+}
+
+func generateFile(gen *protogen.Plugin, file *protogen.File) error {
+	var (
+		messages []*protogen.Message
+		fields   = map[*protogen.Message][]labeledField{}
+	)
+	for _, message := range allMessages(file.Messages) {
+		f, err := labeledFields(message)
+		if err != nil {
+			return err
+		}
+		if len(f) > 0 {
+			messages = append(messages, message)
+			fields[message] = f
+		}
+	}
+
+	labelNames := map[*protogen.Service][]string{}
+	var services []*protogen.Service
+	for _, service := range file.Services {
+		names, err := serviceLabelNames(service)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			services = append(services, service)
+			labelNames[service] = names
+		}
+	}
+
+	if len(messages) == 0 && len(services) == 0 {
+		return nil
+	}
+
+	g := gen.NewGeneratedFile(file.GeneratedFilenamePrefix+"_grpcprom.pb.go", file.GoImportPath)
+	g.P("// Code generated by protoc-gen-grpcprom. DO NOT EDIT.")
+	g.P("// source: ", file.Desc.Path())
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+
+	for _, message := range messages {
+		g.P("// RequestLabels returns the labels of the ", message.GoIdent.GoName, " fields annotated with (metrics.label).")
+		g.P("func (x *", message.GoIdent, ") RequestLabels() map[string]string {")
+		g.P("return map[string]string{")
+		for _, f := range fields[message] {
+			g.P(fmt.Sprintf("%q", f.label), ": ", fmtPackage.Ident("Sprint"), "(x.Get", f.field.GoName, "()),")
+		}
+		g.P("}")
+		g.P("}")
+		g.P()
+	}
+
+	for _, service := range services {
+		g.P("// ", service.GoName, "LabelNames are the labels annotated on the request messages of the ", service.GoName, " methods.")
+		g.P("var ", service.GoName, "LabelNames = []string{")
+		for _, name := range labelNames[service] {
+			g.P(fmt.Sprintf("%q", name), ",")
+		}
+		g.P("}")
+		g.P()
+		g.P("// New", service.GoName, "LabelExtractor returns a LabelExtractor labeling the ", service.GoName, " RPCs with")
+		g.P("// the annotated fields of their request messages.")
+		g.P("func New", service.GoName, "LabelExtractor() ", grpcpromPackage.Ident("LabelExtractor"), " {")
+		g.P("return ", grpcpromPackage.Ident("NewRequestLabelExtractor"), "(", service.GoName, "LabelNames...)")
+		g.P("}")
+		g.P()
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+// labelOption returns the field options with the (metrics.label) option set to label.
+func labelOption(label string) *descriptorpb.FieldOptions {
+	opts := &descriptorpb.FieldOptions{}
+	b := protowire.AppendTag(nil, labelFieldNumber, protowire.BytesType)
+	opts.ProtoReflect().SetUnknown(protowire.AppendString(b, label))
+	return opts
+}
+
+// generate runs the plugin on a file whose HelloRequest name field is labeled with label, and
+// returns the generated code.
+func generate(t *testing.T, label string) (string, error) {
+	t.Helper()
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("demo/greeter.proto"),
+		Package: proto.String("demo"),
+		Syntax:  proto.String("proto3"),
+		Options: &descriptorpb.FileOptions{GoPackage: proto.String("example.com/demo;demo")},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("HelloRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("name"),
+						JsonName: proto.String("name"),
+						Number:   proto.Int32(1),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+						Options:  labelOption(label),
+					},
+					{
+						Name:     proto.String("priority"),
+						JsonName: proto.String("priority"),
+						Number:   proto.Int32(2),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+						Options:  labelOption("priority"),
+					},
+					{
+						Name:     proto.String("message"),
+						JsonName: proto.String("message"),
+						Number:   proto.Int32(3),
+						Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+					},
+				},
+			},
+			{Name: proto.String("HelloReply")},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("SayHello"),
+				InputType:  proto.String(".demo.HelloRequest"),
+				OutputType: proto.String(".demo.HelloReply"),
+			}},
+		}},
+	}
+
+	gen, err := protogen.Options{}.New(&pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{file.GetName()},
+		ProtoFile:      []*descriptorpb.FileDescriptorProto{file},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range gen.Files {
+		if f.Generate {
+			if err := generateFile(gen, f); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	resp := gen.Response()
+	if resp.Error != nil {
+		t.Fatal(resp.GetError())
+	}
+	if len(resp.GetFile()) != 1 {
+		t.Fatalf("%d files generated, want 1", len(resp.GetFile()))
+	}
+	return resp.GetFile()[0].GetContent(), nil
+}
+
+func TestGenerateGolden(t *testing.T) {
+	got, err := generate(t, "userName")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// UPDATE_GOLDEN=1 rewrites the golden file, like the grpcpromtest golden files.
+	goldenFile := filepath.Join("testdata", "greeter_grpcprom.pb.go.golden")
+	if os.Getenv("UPDATE_GOLDEN") == "1" {
+		if err := os.WriteFile(goldenFile, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("generated code:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestGenerateInvalidLabelName(t *testing.T) {
+	for _, label := range []string{"user-name", "1user", "user name", "__name__"} {
+		t.Run(label, func(t *testing.T) {
+			if _, err := generate(t, label); err == nil {
+				t.Errorf("no error generating the label %q", label)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/positiveblue/poc-grpc-prometheus/cmd/soak
+
+go 1.23.0
+
+require (
+	github.com/prometheus/client_model v0.5.0
+	github.com/prometheus/common v0.48.0
+	google.golang.org/grpc v1.72.1
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a // indirect
+)
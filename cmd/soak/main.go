@@ -0,0 +1,182 @@
+// soak drives a gRPC server with calls carrying high-cardinality metadata for a while and
+// reports how the number of exposed series grows over time, to check the cardinality controls
+// of the instrumentation hold under abuse.
+//
+// Every call gets a distinct metadata value out of -cardinality, so a label extracted from the
+// metadata key would create that many series:
+//
+//	soak -addr localhost:9093 -metrics http://localhost:9092/metrics -key x-tenant-id -cardinality 10000 -duration 5m
+//
+// The calls are sent with empty messages, so any unary method can be used. The -bearer-token
+// flag, defaulting to $METRICS_TOKEN, authenticates the scrapes of the metrics endpoint.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// scrape fetches the text exposition format served at url, sending the bearer token when not
+// empty, and returns the number of series of every family.
+func scrape(client *http.Client, url, token string) (map[string]int, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status scraping %s: %s", url, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return seriesCount(families), nil
+}
+
+func seriesCount(families map[string]*dto.MetricFamily) map[string]int {
+	counts := make(map[string]int, len(families))
+	for name, family := range families {
+		counts[name] = len(family.GetMetric())
+	}
+	return counts
+}
+
+func total(counts map[string]int) int {
+	var n int
+	for _, c := range counts {
+		n += c
+	}
+	return n
+}
+
+// drive sends calls with a distinct metadata value out of cardinality until ctx is done.
+func drive(ctx context.Context, conn *grpc.ClientConn, method, key string, cardinality int, calls, failures *atomic.Int64) {
+	for i := 0; ctx.Err() == nil; i++ {
+		callCtx := metadata.AppendToOutgoingContext(ctx, key, "soak-"+strconv.Itoa(i%cardinality))
+		if err := conn.Invoke(callCtx, method, &emptypb.Empty{}, &emptypb.Empty{}); err != nil && ctx.Err() == nil {
+			failures.Add(1)
+		}
+		calls.Add(1)
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9093", "address of the gRPC server")
+	metricsURL := flag.String("metrics", "http://localhost:9092/metrics", "metrics endpoint of the server")
+	token := flag.String("bearer-token", os.Getenv("METRICS_TOKEN"), "bearer token sent with the scrapes")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of the scrapes")
+	method := flag.String("method", "/proto.DemoService/SayHello", "unary method to call")
+	key := flag.String("key", "x-tenant-id", "metadata key carrying the high-cardinality values")
+	cardinality := flag.Int("cardinality", 10000, "number of distinct metadata values")
+	concurrency := flag.Int("concurrency", 8, "number of concurrent callers")
+	duration := flag.Duration("duration", time.Minute, "duration of the soak test")
+	interval := flag.Duration("interval", 10*time.Second, "interval between the series reports")
+	top := flag.Int("top", 10, "number of fastest growing families reported at the end")
+	flag.Parse()
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("failed to connect to %s: %v", *addr, err)
+	}
+	defer conn.Close()
+
+	client := &http.Client{Timeout: *timeout}
+	initial, err := scrape(client, *metricsURL, *token)
+	if err != nil {
+		log.Fatalf("failed to scrape %s: %v", *metricsURL, err)
+	}
+	fmt.Printf("%10s %10s %10s %10s\n", "elapsed", "calls", "series", "growth")
+	fmt.Printf("%10s %10d %10d %10d\n", time.Duration(0), 0, total(initial), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *duration)
+	defer cancel()
+
+	var (
+		wg              sync.WaitGroup
+		calls, failures atomic.Int64
+	)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			drive(ctx, conn, *method, *key, *cardinality, &calls, &failures)
+		}()
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	last := initial
+	report := func() {
+		counts, err := scrape(client, *metricsURL, *token)
+		if err != nil {
+			log.Printf("failed to scrape %s: %v", *metricsURL, err)
+			return
+		}
+		fmt.Printf("%10s %10d %10d %+10d\n", time.Since(start).Round(time.Second), calls.Load(), total(counts), total(counts)-total(last))
+		last = counts
+	}
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			report()
+		case <-ctx.Done():
+			done = true
+		}
+	}
+	wg.Wait()
+	report()
+
+	type growth struct {
+		name  string
+		delta int
+	}
+	var growths []growth
+	for name, n := range last {
+		if delta := n - initial[name]; delta > 0 {
+			growths = append(growths, growth{name: name, delta: delta})
+		}
+	}
+	sort.Slice(growths, func(i, j int) bool {
+		if growths[i].delta != growths[j].delta {
+			return growths[i].delta > growths[j].delta
+		}
+		return growths[i].name < growths[j].name
+	})
+	if len(growths) > *top {
+		growths = growths[:*top]
+	}
+
+	fmt.Printf("\n%d calls, %d failed, %d new series\n", calls.Load(), failures.Load(), total(last)-total(initial))
+	for _, g := range growths {
+		fmt.Printf("%+8d %s\n", g.delta, g.name)
+	}
+}
@@ -0,0 +1,200 @@
+// Package e2e spins up a gRPC server instrumented like the demo one, drives a known set of calls,
+// scrapes its /metrics endpoint and asserts the exact counter values and histogram bucket counts.
+//
+// Run it with `go test ./...` from this directory. The servers listen on ephemeral loopback
+// ports, so the tests run in parallel with a local demo server or other test runs.
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	pb "github.com/positiveblue/poc-grpc-prometheus/protobuf"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// injectErrorKey is the metadata key the demo server reads to fail a call with the given code.
+const injectErrorKey = "x-inject-error"
+
+// demoServer is the DemoService of the tests, failing the calls like the demo server.
+type demoServer struct {
+	pb.UnimplementedDemoServiceServer
+}
+
+func (demoServer) SayHello(ctx context.Context, req *pb.HelloRequest) (*pb.HelloResponse, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(injectErrorKey)) > 0 {
+		name := md.Get(injectErrorKey)[0]
+		for c := codes.Canceled; c <= codes.Unauthenticated; c++ {
+			if strings.EqualFold(c.String(), name) {
+				return nil, status.Errorf(c, "injected %s error", c)
+			}
+		}
+		return nil, status.Errorf(codes.Unknown, "injected unknown error %q", name)
+	}
+	return &pb.HelloResponse{Message: "Hello " + req.Name}, nil
+}
+
+// testServer is a DemoService server and its metrics endpoint, listening on loopback.
+type testServer struct {
+	grpcAddr   string
+	metricsURL string
+}
+
+// startServer starts the instrumented gRPC server and the metrics server on ephemeral ports,
+// stopped at the end of the test.
+func startServer(t *testing.T) *testServer {
+	t.Helper()
+
+	registry := prom.NewRegistry()
+	metrics := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+	registry.MustRegister(metrics)
+
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(metrics.UnaryServerInterceptor()))
+	pb.RegisterDemoServiceServer(server, demoServer{})
+	metrics.InitializeMetrics(server)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	metricsServer := grpcprom.NewMetricsServer(grpcprom.MetricsServerOptions{
+		Addr:    "127.0.0.1:0",
+		Handler: mux,
+		OnError: func(err error) { t.Errorf("metrics server: %v", err) },
+	})
+	if err := metricsServer.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { metricsServer.Shutdown(context.Background()) })
+
+	return &testServer{
+		grpcAddr:   listener.Addr().String(),
+		metricsURL: fmt.Sprintf("http://%s/metrics", metricsServer.Addr()),
+	}
+}
+
+func TestHandledMetrics(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls map[codes.Code]int
+	}{
+		{
+			name:  "successful calls",
+			calls: map[codes.Code]int{codes.OK: 20},
+		},
+		{
+			name:  "failed calls",
+			calls: map[codes.Code]int{codes.Unavailable: 5, codes.NotFound: 3},
+		},
+		{
+			name:  "mixed calls",
+			calls: map[codes.Code]int{codes.OK: 20, codes.Unavailable: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startServer(t)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			conn, err := grpc.NewClient(server.grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatalf("unable to connect to the server: %v", err)
+			}
+			defer conn.Close()
+
+			before, err := scrape(server.metricsURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Drive the calls and keep the slowest round trip: no server side observation can be
+			// slower than it, which makes the bucket counts above it exact.
+			client := pb.NewDemoServiceClient(conn)
+			var slowest time.Duration
+			for code, n := range tt.calls {
+				md := metadata.MD{}
+				if code != codes.OK {
+					md = metadata.Pairs(injectErrorKey, code.String())
+				}
+				for i := 0; i < n; i++ {
+					start := time.Now()
+					_, err := client.SayHello(metadata.NewOutgoingContext(ctx, md), &pb.HelloRequest{Name: "e2e"})
+					if elapsed := time.Since(start); elapsed > slowest {
+						slowest = elapsed
+					}
+					if got := status.Code(err); got != code {
+						t.Fatalf("expected %s from SayHello, got %s (%v)", code, got, err)
+					}
+				}
+			}
+
+			after, err := scrape(server.metricsURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var c checker
+			for code, n := range tt.calls {
+				labels := map[string]string{
+					"grpc_service": "proto.DemoService",
+					"grpc_method":  "SayHello",
+					"grpc_status":  code.String(),
+				}
+				assertCounterDelta(&c, before, after, "grpc_server_handled_total", labels, n)
+				assertHistogramDelta(&c, before, after, "grpc_server_handling_seconds", labels, n, slowest)
+			}
+			if err := c.err(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func assertCounterDelta(c *checker, before, after map[string]*dto.MetricFamily, name string, labels map[string]string, want int) {
+	got := counterValue(after, name, labels) - counterValue(before, name, labels)
+	if got != float64(want) {
+		c.errorf("%s%v: expected %d, got %v", name, labels, want, got)
+	}
+}
+
+func assertHistogramDelta(c *checker, before, after map[string]*dto.MetricFamily, name string, labels map[string]string, want int, slowest time.Duration) {
+	prev, cur := histogramValue(before, name, labels), histogramValue(after, name, labels)
+	if got := cur.count - prev.count; got != uint64(want) {
+		c.errorf("%s_count%v: expected %d, got %d", name, labels, want, got)
+	}
+
+	var last uint64
+	for _, bound := range cur.upperBounds() {
+		got := cur.buckets[bound] - prev.buckets[bound]
+		if got < last {
+			c.errorf("%s_bucket%v{le=%v}: cumulative count decreased from %d to %d", name, labels, bound, last, got)
+		}
+		if got > uint64(want) {
+			c.errorf("%s_bucket%v{le=%v}: expected at most %d, got %d", name, labels, bound, want, got)
+		}
+		if bound >= slowest.Seconds() && got != uint64(want) {
+			c.errorf("%s_bucket%v{le=%v}: every call took less than %s, expected %d, got %d", name, labels, bound, slowest, want, got)
+		}
+		last = got
+	}
+}
@@ -0,0 +1,100 @@
+package e2e
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrape fetches and parses the text exposition format served at url.
+func scrape(url string) (map[string]*dto.MetricFamily, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status scraping %s: %s", url, resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// matches reports if the metric has all the given label values.
+func matches(metric *dto.Metric, labels map[string]string) bool {
+	found := 0
+	for _, pair := range metric.GetLabel() {
+		if v, ok := labels[pair.GetName()]; ok {
+			if v != pair.GetValue() {
+				return false
+			}
+			found++
+		}
+	}
+	return found == len(labels)
+}
+
+// counterValue sums the counters of the family matching the given labels.
+func counterValue(families map[string]*dto.MetricFamily, name string, labels map[string]string) float64 {
+	var total float64
+	for _, metric := range families[name].GetMetric() {
+		if matches(metric, labels) {
+			total += metric.GetCounter().GetValue()
+		}
+	}
+	return total
+}
+
+// histogramSnapshot is the aggregated state of the histograms matching a label set.
+type histogramSnapshot struct {
+	count   uint64
+	buckets map[float64]uint64
+}
+
+// histogramValue sums the histograms of the family matching the given labels.
+func histogramValue(families map[string]*dto.MetricFamily, name string, labels map[string]string) histogramSnapshot {
+	snapshot := histogramSnapshot{buckets: map[float64]uint64{}}
+	for _, metric := range families[name].GetMetric() {
+		if !matches(metric, labels) {
+			continue
+		}
+		h := metric.GetHistogram()
+		snapshot.count += h.GetSampleCount()
+		for _, b := range h.GetBucket() {
+			snapshot.buckets[b.GetUpperBound()] += b.GetCumulativeCount()
+		}
+	}
+	return snapshot
+}
+
+// upperBounds returns the sorted bucket upper bounds of the snapshot.
+func (h histogramSnapshot) upperBounds() []float64 {
+	var bounds []float64
+	for bound := range h.buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+	return bounds
+}
+
+// checker accumulates assertion failures instead of stopping at the first one.
+type checker struct {
+	failures []string
+}
+
+func (c *checker) errorf(format string, args ...interface{}) {
+	c.failures = append(c.failures, fmt.Sprintf(format, args...))
+}
+
+func (c *checker) err() error {
+	if len(c.failures) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d assertions failed:\n\t%s", len(c.failures), strings.Join(c.failures, "\n\t"))
+}
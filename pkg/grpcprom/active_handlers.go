@@ -0,0 +1,50 @@
+package grpcprom
+
+import (
+	"fmt"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// WithActiveHandlersGauge makes the ServerMetrics export grpc_server_active_handlers, the number
+// of handlers currently executing broken down by one of the custom labels, e.g. the tenant, so a
+// single tenant monopolizing the concurrency of the server is visible right away. It is recorded
+// by the gRPC interceptor. NewServerMetrics panics if the label is not declared by the
+// LabelExtractor.
+func WithActiveHandlersGauge(labelName string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.activeHandlersLabel = labelName
+		m.activeHandlers = prom.NewGaugeVec(
+			prom.GaugeOpts{
+				Name: "grpc_server_active_handlers",
+				Help: "Number of RPC handlers currently executing on the server.",
+			}, []string{labelName},
+		)
+	}
+}
+
+// checkActiveHandlersLabel panics if the label of the active handlers gauge is not one of the
+// labels of the metrics.
+func (m *ServerMetrics) checkActiveHandlersLabel() {
+	if m.activeHandlers == nil {
+		return
+	}
+	for _, labelName := range m.labels {
+		if labelName == m.activeHandlersLabel {
+			return
+		}
+	}
+	panic(fmt.Sprintf("active handlers label %q is not one of the labels %v", m.activeHandlersLabel, m.labels))
+}
+
+// startHandler counts one more handler executing with the labels. The returned function counts
+// it as finished.
+func (m *ServerMetrics) startHandler(labels map[string]string) func() {
+	if m.activeHandlers == nil {
+		return func() {}
+	}
+
+	gauge := m.activeHandlers.WithLabelValues(labels[m.activeHandlersLabel])
+	gauge.Inc()
+	return gauge.Dec
+}
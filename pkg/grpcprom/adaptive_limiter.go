@@ -0,0 +1,187 @@
+package grpcprom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// adaptiveDecrease is the factor the limit is multiplied by when the method is overloaded.
+const adaptiveDecrease = 0.9
+
+// adaptiveMethod is the limit state of a method.
+type adaptiveMethod struct {
+	limit    atomic.Int64
+	inFlight atomic.Int64
+}
+
+// AdaptiveLimiter is a unary server interceptor limiting the RPCs in flight of every method with
+// a limit adjusted by AIMD from the in-process statistics of the ServerMetrics: the limit grows by
+// one while the mean latency and the error ratio stay under their targets, and shrinks by 10%
+// when they don't. RPCs over the limit are rejected right away with ResourceExhausted.
+type AdaptiveLimiter struct {
+	metrics       *ServerMetrics
+	latencyTarget time.Duration
+	errorTarget   float64
+	minLimit      int64
+	maxLimit      int64
+
+	mu      sync.Mutex
+	methods map[string]*adaptiveMethod
+
+	limitGauge *prom.GaugeVec
+	decisions  *prom.CounterVec
+	rejected   *prom.CounterVec
+}
+
+// NewAdaptiveLimiter returns an AdaptiveLimiter fed by the WindowStats of metrics, which must
+// have WithStatsWindow; a short window makes it react faster. The limit of every method starts at
+// maxLimit and stays between minLimit and maxLimit. Call Run to adjust the limits. It returns an
+// error if the metrics have no stats window, or if minLimit is not between 1 and maxLimit, since
+// a limit of 0 rejects every RPC and never grows back.
+func NewAdaptiveLimiter(metrics *ServerMetrics, latencyTarget time.Duration, errorTarget float64, minLimit, maxLimit int) (*AdaptiveLimiter, error) {
+	switch {
+	case metrics.window == nil:
+		return nil, errors.New("the server metrics have no stats window")
+	case minLimit < 1:
+		return nil, fmt.Errorf("min limit %d is not positive", minLimit)
+	case minLimit > maxLimit:
+		return nil, fmt.Errorf("min limit %d is over the max limit %d", minLimit, maxLimit)
+	}
+
+	return &AdaptiveLimiter{
+		metrics:       metrics,
+		latencyTarget: latencyTarget,
+		errorTarget:   errorTarget,
+		minLimit:      int64(minLimit),
+		maxLimit:      int64(maxLimit),
+		methods:       map[string]*adaptiveMethod{},
+		limitGauge: prom.NewGaugeVec(
+			prom.GaugeOpts{
+				Name: "grpc_server_adaptive_limit",
+				Help: "Current limit of RPCs in flight of the method set by the adaptive limiter.",
+			}, []string{"grpc_service", "grpc_method"},
+		),
+		decisions: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_adaptive_limit_decisions_total",
+				Help: "Total number of adjustments of the limit of the method by the adaptive limiter.",
+			}, []string{"grpc_service", "grpc_method", "decision"},
+		),
+		rejected: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_adaptive_limiter_rejected_total",
+				Help: "Total number of RPCs rejected by the adaptive limiter.",
+			}, []string{"grpc_service", "grpc_method"},
+		),
+	}, nil
+}
+
+// Describe describes the adaptive limiter metrics.
+func (l *AdaptiveLimiter) Describe(ch chan<- *prom.Desc) {
+	l.limitGauge.Describe(ch)
+	l.decisions.Describe(ch)
+	l.rejected.Describe(ch)
+}
+
+// Collect collects the adaptive limiter metrics.
+func (l *AdaptiveLimiter) Collect(ch chan<- prom.Metric) {
+	l.limitGauge.Collect(ch)
+	l.decisions.Collect(ch)
+	l.rejected.Collect(ch)
+}
+
+func (l *AdaptiveLimiter) method(fullMethod string) *adaptiveMethod {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	am, ok := l.methods[fullMethod]
+	if !ok {
+		am = &adaptiveMethod{}
+		am.limit.Store(l.maxLimit)
+		l.methods[fullMethod] = am
+
+		service, method := splitMethodName(fullMethod)
+		l.limitGauge.WithLabelValues(service, method).Set(float64(l.maxLimit))
+	}
+	return am
+}
+
+// Run adjusts the limits every interval until ctx is done.
+func (l *AdaptiveLimiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.adjust()
+		}
+	}
+}
+
+// adjust updates the limit of every method seen from its window statistics.
+func (l *AdaptiveLimiter) adjust() {
+	l.mu.Lock()
+	methods := make(map[string]*adaptiveMethod, len(l.methods))
+	for fullMethod, am := range l.methods {
+		methods[fullMethod] = am
+	}
+	l.mu.Unlock()
+
+	for fullMethod, am := range methods {
+		stats := l.metrics.WindowStats(fullMethod)
+		if stats.Requests == 0 {
+			continue
+		}
+
+		limit, decision := am.limit.Load(), "increase"
+		if stats.MeanLatency > l.latencyTarget || stats.ErrorRatio > l.errorTarget {
+			limit, decision = int64(float64(limit)*adaptiveDecrease), "decrease"
+		} else {
+			limit++
+		}
+		if limit < l.minLimit {
+			limit = l.minLimit
+		}
+		if limit > l.maxLimit {
+			limit = l.maxLimit
+		}
+		if limit == am.limit.Load() {
+			continue
+		}
+
+		am.limit.Store(limit)
+		service, method := splitMethodName(fullMethod)
+		l.limitGauge.WithLabelValues(service, method).Set(float64(limit))
+		l.decisions.WithLabelValues(service, method, decision).Inc()
+	}
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor enforcing the adaptive limits. Put it
+// before the ServerMetrics interceptor, so the rejected RPCs don't count as errors in the window
+// statistics and shrink the limit further.
+func (l *AdaptiveLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		am := l.method(info.FullMethod)
+		if am.inFlight.Add(1) > am.limit.Load() {
+			am.inFlight.Add(-1)
+			service, method := splitMethodName(info.FullMethod)
+			l.rejected.WithLabelValues(service, method).Inc()
+			return nil, status.Errorf(codes.ResourceExhausted, "adaptive limit of %s reached", info.FullMethod)
+		}
+		defer am.inFlight.Add(-1)
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,114 @@
+package grpcprom
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestNewAdaptiveLimiterInvalid(t *testing.T) {
+	windowed := NewServerMetrics(&DefaultLabelExtractor{}, WithStatsWindow(time.Minute))
+
+	tests := []struct {
+		name               string
+		metrics            *ServerMetrics
+		minLimit, maxLimit int
+	}{
+		{
+			name:     "no stats window",
+			metrics:  NewServerMetrics(&DefaultLabelExtractor{}),
+			minLimit: 1,
+			maxLimit: 10,
+		},
+		{
+			name:     "zero min limit",
+			metrics:  windowed,
+			minLimit: 0,
+			maxLimit: 10,
+		},
+		{
+			name:     "min limit over max limit",
+			metrics:  windowed,
+			minLimit: 11,
+			maxLimit: 10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAdaptiveLimiter(tt.metrics, time.Second, 0.1, tt.minLimit, tt.maxLimit); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestAdaptiveLimiterAdjust(t *testing.T) {
+	const fullMethod = "/demo.v1.Greeter/SayHello"
+
+	tests := []struct {
+		name          string
+		latencyTarget time.Duration
+		err           error
+		limit         int64
+		want          int64
+	}{
+		{
+			name:          "additive increase",
+			latencyTarget: time.Hour,
+			limit:         5,
+			want:          6,
+		},
+		{
+			name:          "increase capped at the max limit",
+			latencyTarget: time.Hour,
+			limit:         100,
+			want:          100,
+		},
+		{
+			name:          "multiplicative decrease on latency",
+			latencyTarget: 0,
+			limit:         50,
+			want:          45,
+		},
+		{
+			name:          "multiplicative decrease on errors",
+			latencyTarget: time.Hour,
+			err:           errors.New("boom"),
+			limit:         50,
+			want:          45,
+		},
+		{
+			name:          "decrease capped at the min limit",
+			latencyTarget: 0,
+			limit:         1,
+			want:          1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewServerMetrics(&DefaultLabelExtractor{}, WithStatsWindow(time.Minute))
+			l, err := NewAdaptiveLimiter(m, tt.latencyTarget, 0.1, 1, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			handler := func(context.Context, interface{}) (interface{}, error) {
+				time.Sleep(time.Millisecond)
+				return nil, tt.err
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: fullMethod}
+			_, _ = l.UnaryServerInterceptor()(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return m.UnaryServerInterceptor()(ctx, req, info, handler)
+			})
+
+			l.method(fullMethod).limit.Store(tt.limit)
+			l.adjust()
+			if got := l.method(fullMethod).limit.Load(); got != tt.want {
+				t.Errorf("got limit %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package grpcprom
+
+import (
+	"sort"
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// AggregatingGatherer is a prom.Gatherer summing away some labels of the metrics of the wrapped
+// gatherer. Served on a second endpoint, it lets a central Prometheus scrape cheap aggregates
+// while a local agent scrapes the full detail. Counters, gauges and histograms are summed;
+// summaries keep their count and sum but lose their quantiles, which can't be aggregated.
+type AggregatingGatherer struct {
+	gatherer prom.Gatherer
+	drop     map[string]bool
+}
+
+// NewAggregatingGatherer returns an AggregatingGatherer removing the labels from the metrics of
+// gatherer, e.g. NewAggregatingGatherer(reg, "userName").
+func NewAggregatingGatherer(gatherer prom.Gatherer, labels ...string) *AggregatingGatherer {
+	drop := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		drop[label] = true
+	}
+	return &AggregatingGatherer{gatherer: gatherer, drop: drop}
+}
+
+// Gather gathers the metrics of the wrapped gatherer and aggregates them.
+func (g *AggregatingGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		family.Metric = g.aggregate(family.GetMetric())
+	}
+	return families, err
+}
+
+// aggregate merges the metrics which only differ by the dropped labels.
+func (g *AggregatingGatherer) aggregate(metrics []*dto.Metric) []*dto.Metric {
+	var (
+		keys       []string
+		aggregates = map[string]*dto.Metric{}
+	)
+	for _, metric := range metrics {
+		var (
+			labels []*dto.LabelPair
+			pairs  []string
+		)
+		for _, pair := range metric.GetLabel() {
+			if !g.drop[pair.GetName()] {
+				labels = append(labels, pair)
+				pairs = append(pairs, pair.GetName()+"="+pair.GetValue())
+			}
+		}
+		key := strings.Join(pairs, "\xff")
+
+		aggregate, ok := aggregates[key]
+		if !ok {
+			aggregate = proto.Clone(metric).(*dto.Metric)
+			aggregate.Label = labels
+			aggregate.TimestampMs = nil
+			if aggregate.Summary != nil {
+				aggregate.Summary.Quantile = nil
+			}
+			// Exemplars belong to one of the merged series.
+			if aggregate.Counter != nil {
+				aggregate.Counter.Exemplar = nil
+			}
+			if aggregate.Histogram != nil {
+				for _, bucket := range aggregate.Histogram.GetBucket() {
+					bucket.Exemplar = nil
+				}
+			}
+			aggregates[key] = aggregate
+			keys = append(keys, key)
+			continue
+		}
+		merge(aggregate, metric)
+	}
+
+	sort.Strings(keys)
+	res := make([]*dto.Metric, 0, len(keys))
+	for _, key := range keys {
+		res = append(res, aggregates[key])
+	}
+	return res
+}
+
+// merge adds the values of metric to aggregate.
+func merge(aggregate, metric *dto.Metric) {
+	switch {
+	case aggregate.Counter != nil:
+		aggregate.Counter.Value = proto.Float64(aggregate.Counter.GetValue() + metric.GetCounter().GetValue())
+	case aggregate.Gauge != nil:
+		aggregate.Gauge.Value = proto.Float64(aggregate.Gauge.GetValue() + metric.GetGauge().GetValue())
+	case aggregate.Untyped != nil:
+		aggregate.Untyped.Value = proto.Float64(aggregate.Untyped.GetValue() + metric.GetUntyped().GetValue())
+	case aggregate.Summary != nil:
+		aggregate.Summary.SampleCount = proto.Uint64(aggregate.Summary.GetSampleCount() + metric.GetSummary().GetSampleCount())
+		aggregate.Summary.SampleSum = proto.Float64(aggregate.Summary.GetSampleSum() + metric.GetSummary().GetSampleSum())
+	case aggregate.Histogram != nil:
+		h := aggregate.Histogram
+		h.SampleCount = proto.Uint64(h.GetSampleCount() + metric.GetHistogram().GetSampleCount())
+		h.SampleSum = proto.Float64(h.GetSampleSum() + metric.GetHistogram().GetSampleSum())
+		// The series of a family share their buckets.
+		for i, bucket := range metric.GetHistogram().GetBucket() {
+			if i < len(h.Bucket) && h.Bucket[i].GetUpperBound() == bucket.GetUpperBound() {
+				h.Bucket[i].CumulativeCount = proto.Uint64(h.Bucket[i].GetCumulativeCount() + bucket.GetCumulativeCount())
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package grpcprom_test
+
+import (
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAggregatingGatherer(t *testing.T) {
+	counter := prom.NewCounterVec(prom.CounterOpts{Name: "demo_calls_total", Help: "Calls."}, []string{"method", "userName"})
+	counter.WithLabelValues("SayHello", "alice").Add(1)
+	counter.WithLabelValues("SayHello", "bob").Add(2)
+	counter.WithLabelValues("Chat", "bob").Add(4)
+
+	histogram := prom.NewHistogramVec(prom.HistogramOpts{Name: "demo_latency_seconds", Help: "Latency.", Buckets: []float64{0.1, 1}}, []string{"userName"})
+	histogram.WithLabelValues("alice").Observe(0.05)
+	histogram.WithLabelValues("bob").Observe(0.5)
+	histogram.WithLabelValues("bob").Observe(2)
+
+	summary := prom.NewSummaryVec(prom.SummaryOpts{Name: "demo_size_bytes", Help: "Size.", Objectives: map[float64]float64{0.5: 0.05}}, []string{"userName"})
+	summary.WithLabelValues("alice").Observe(10)
+	summary.WithLabelValues("bob").Observe(30)
+
+	g := grpcprom.NewAggregatingGatherer(newRegistry(t, counter, histogram, summary), "userName")
+
+	// The summary quantiles can't be aggregated, so only their count and sum are kept.
+	assertMetrics(t, g, `
+# HELP demo_calls_total Calls.
+# TYPE demo_calls_total counter
+demo_calls_total{method="Chat"} 4
+demo_calls_total{method="SayHello"} 3
+# HELP demo_latency_seconds Latency.
+# TYPE demo_latency_seconds histogram
+demo_latency_seconds_bucket{le="0.1"} 1
+demo_latency_seconds_bucket{le="1"} 2
+demo_latency_seconds_bucket{le="+Inf"} 3
+demo_latency_seconds_sum 2.55
+demo_latency_seconds_count 3
+# HELP demo_size_bytes Size.
+# TYPE demo_size_bytes summary
+demo_size_bytes_sum 40
+demo_size_bytes_count 2
+`, "demo_calls_total", "demo_latency_seconds", "demo_size_bytes")
+}
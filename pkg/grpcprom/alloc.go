@@ -0,0 +1,75 @@
+package grpcprom
+
+import (
+	"context"
+	"math/rand"
+	"runtime/metrics"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// heapAllocsMetric is the runtime metric of the cumulative bytes allocated on the heap.
+const heapAllocsMetric = "/gc/heap/allocs:bytes"
+
+// AllocMetrics exports grpc_server_alloc_bytes, the heap bytes allocated while a sample of the
+// unary handlers run, to pinpoint the allocation heavy methods driving the GC pressure. The Go
+// runtime only counts the allocations of the whole process, and flushes them in batches, so the
+// observations include the allocations of the concurrent goroutines: they are an approximation,
+// meaningful on the aggregate of many samples.
+type AllocMetrics struct {
+	fraction   float64
+	allocBytes *prom.HistogramVec
+}
+
+// NewAllocMetrics returns the AllocMetrics sampling the given fraction of the RPCs, e.g. 0.01.
+func NewAllocMetrics(fraction float64) *AllocMetrics {
+	return &AllocMetrics{
+		fraction: fraction,
+		allocBytes: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_server_alloc_bytes",
+				Help:    "Histogram of the heap bytes allocated while the sampled handlers run.",
+				Buckets: prom.ExponentialBuckets(1024, 4, 10),
+			}, []string{"grpc_service", "grpc_method"},
+		),
+	}
+}
+
+// Describe describes the allocation metrics.
+func (m *AllocMetrics) Describe(ch chan<- *prom.Desc) {
+	m.allocBytes.Describe(ch)
+}
+
+// Collect collects the allocation metrics.
+func (m *AllocMetrics) Collect(ch chan<- prom.Metric) {
+	m.allocBytes.Collect(ch)
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor measuring the heap allocations of a
+// sample of the handlers.
+func (m *AllocMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if rand.Float64() >= m.fraction {
+			return handler(ctx, req)
+		}
+
+		start := heapAllocs()
+		resp, err := handler(ctx, req)
+		if end := heapAllocs(); end >= start {
+			service, method := splitMethodName(info.FullMethod)
+			m.allocBytes.WithLabelValues(service, method).Observe(float64(end - start))
+		}
+		return resp, err
+	}
+}
+
+// heapAllocs returns the cumulative bytes allocated on the heap by the process.
+func heapAllocs() uint64 {
+	sample := []metrics.Sample{{Name: heapAllocsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,56 @@
+package grpcprom
+
+import (
+	"fmt"
+	"sort"
+)
+
+// otherMethod is the grpc_service and grpc_method label of the RPCs left out of the allowlist.
+const otherMethod = "other"
+
+// WithMethodAllowlist makes the ServerMetrics only label the listed methods, given as full method
+// names (/package.Service/Method), with their own name. Every other RPC is recorded with
+// grpc_service and grpc_method set to "other", for servers exposing hundreds of internal methods
+// when only the public API matters. Check the allowlist against the methods of the server with
+// CheckMethodAllowlist.
+func WithMethodAllowlist(fullMethods ...string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		if m.allowlist == nil {
+			m.allowlist = map[string]bool{}
+		}
+		for _, fullMethod := range fullMethods {
+			m.allowlist[fullMethod] = true
+		}
+	}
+}
+
+// methodLabels returns the grpc_service and grpc_method labels of the full method, after
+// applying the allowlist and the rewrite rules.
+func (m *ServerMetrics) methodLabels(fullMethod string) (string, string) {
+	if m.allowlist != nil && !m.allowlist[fullMethod] {
+		return otherMethod, otherMethod
+	}
+	return splitMethodName(m.rewriteMethod(fullMethod))
+}
+
+// CheckMethodAllowlist returns an error if a method of the WithMethodAllowlist allowlist is not
+// registered on the server, like a misspelled or removed method, which would silently record the
+// RPCs of the method meant to be listed as other. Call it once the services are registered.
+func (m *ServerMetrics) CheckMethodAllowlist(server ServiceInfoProvider) error {
+	registered := map[string]bool{}
+	for _, method := range Methods(server) {
+		registered[method.FullMethod()] = true
+	}
+
+	var unknown []string
+	for fullMethod := range m.allowlist {
+		if !registered[fullMethod] {
+			unknown = append(unknown, fullMethod)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("allowlisted methods not registered on the server: %v", unknown)
+	}
+	return nil
+}
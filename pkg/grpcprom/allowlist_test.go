@@ -0,0 +1,46 @@
+package grpcprom_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestCheckMethodAllowlist(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		wantErr   string
+	}{
+		{
+			name: "no allowlist",
+		},
+		{
+			name:      "registered methods",
+			allowlist: []string{"/demo.v1.Greeter/SayHello", "/demo.v1.Greeter/Chat"},
+		},
+		{
+			name:      "misspelled method",
+			allowlist: []string{"/demo.v1.Greeter/SayHello", "/demo.v1.Greeter/SayHelo"},
+			wantErr:   "/demo.v1.Greeter/SayHelo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []grpcprom.ServerMetricsOption
+			if tt.allowlist != nil {
+				opts = append(opts, grpcprom.WithMethodAllowlist(tt.allowlist...))
+			}
+			m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, opts...)
+
+			err := m.CheckMethodAllowlist(fakeServer{})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error %v, want one naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package grpcprom
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// apiVersionLabel is the label of the APIVersionLabelExtractor.
+const apiVersionLabel = "api_version"
+
+// unversioned is the api_version label of the methods of unversioned packages.
+const unversioned = "unversioned"
+
+// apiVersionPattern matches the version elements of the proto packages, like v1, v2beta1 or
+// v1alpha.
+var apiVersionPattern = regexp.MustCompile(`^v[0-9]+((alpha|beta)[0-9]*)?$`)
+
+// APIVersionLabelExtractor is a LabelExtractor labeling the RPCs with the api_version of the
+// proto package of their method, e.g. v1 for /myapi.v1.Users/Get, so the traffic shift between
+// API versions can be tracked. The methods of unversioned packages get the unversioned value.
+type APIVersionLabelExtractor struct{}
+
+// LabelNames returns the api_version label
+func (e *APIVersionLabelExtractor) LabelNames() []string {
+	return []string{apiVersionLabel}
+}
+
+// Labels returns the API version of the method of the RPC.
+func (e *APIVersionLabelExtractor) Labels(ctx context.Context) map[string]string {
+	labels := map[string]string{}
+	fullMethod := inboundFullMethod(ctx)
+	if fullMethod == "" {
+		return labels
+	}
+
+	labels[apiVersionLabel] = apiVersion(fullMethod)
+	return labels
+}
+
+// apiVersion returns the last version element of the package of the full method.
+func apiVersion(fullMethod string) string {
+	service, _ := splitMethodName(fullMethod)
+	elements := strings.Split(service, ".")
+	// The last element is the service name.
+	for i := len(elements) - 2; i >= 0; i-- {
+		if apiVersionPattern.MatchString(elements[i]) {
+			return elements[i]
+		}
+	}
+	return unversioned
+}
@@ -0,0 +1,84 @@
+package grpcprom
+
+import (
+	"context"
+	"errors"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The errors an Authenticator returns to tell why the credentials were refused. Other errors
+// are counted as invalid credentials.
+var (
+	ErrCredentialsMissing = errors.New("missing credentials")
+	ErrCredentialsExpired = errors.New("expired credentials")
+	ErrCredentialsInvalid = errors.New("invalid credentials")
+)
+
+// Authenticator checks the credentials of an RPC and returns the context passed to the handler,
+// e.g. with the identity of the caller. The errors should wrap ErrCredentialsMissing,
+// ErrCredentialsExpired or ErrCredentialsInvalid.
+type Authenticator func(ctx context.Context, fullMethod string) (context.Context, error)
+
+// AuthMetrics is a unary server interceptor authenticating the RPCs and counting the outcomes in
+// grpc_server_auth_results_total{result=ok|expired|invalid|missing}, so credential problems are
+// told apart from application errors. Refused RPCs fail with Unauthenticated.
+type AuthMetrics struct {
+	authenticate Authenticator
+	results      *prom.CounterVec
+}
+
+// NewAuthMetrics returns the AuthMetrics authenticating the RPCs with authenticate.
+func NewAuthMetrics(authenticate Authenticator) *AuthMetrics {
+	return &AuthMetrics{
+		authenticate: authenticate,
+		results: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_auth_results_total",
+				Help: "Total number of RPCs authenticated by the server, by result.",
+			}, []string{"grpc_service", "grpc_method", "result"},
+		),
+	}
+}
+
+// Describe describes the authentication metrics.
+func (m *AuthMetrics) Describe(ch chan<- *prom.Desc) {
+	m.results.Describe(ch)
+}
+
+// Collect collects the authentication metrics.
+func (m *AuthMetrics) Collect(ch chan<- prom.Metric) {
+	m.results.Collect(ch)
+}
+
+// authResult returns the result label of an authentication error.
+func authResult(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrCredentialsMissing):
+		return "missing"
+	case errors.Is(err, ErrCredentialsExpired):
+		return "expired"
+	default:
+		return "invalid"
+	}
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor authenticating the RPCs. Put it after
+// the ServerMetrics interceptor so the refused RPCs are also counted as handled.
+func (m *AuthMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethodName(info.FullMethod)
+
+		newCtx, err := m.authenticate(ctx, info.FullMethod)
+		m.results.WithLabelValues(service, method, authResult(err)).Inc()
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(newCtx, req)
+	}
+}
@@ -0,0 +1,36 @@
+package grpcprom
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// defaultRetryDelay is the retry delay signaled when the limiter can't compute one.
+const defaultRetryDelay = time.Second
+
+// newBackpressureCounter returns the counter of the backpressure signaled by a limiter, by method.
+// The limiter is a constant label, so the limiters can be registered together.
+func newBackpressureCounter(limiter string) *prom.CounterVec {
+	return prom.NewCounterVec(
+		prom.CounterOpts{
+			Name:        "grpc_server_backpressure_signaled_total",
+			Help:        "Total number of RPCs rejected with a retry delay, by limiter and method.",
+			ConstLabels: prom.Labels{"limiter": limiter},
+		}, []string{"grpc_service", "grpc_method"},
+	)
+}
+
+// backpressureError returns the ResourceExhausted error of a rejected RPC, with a RetryInfo
+// detail asking the client to retry after delay.
+func backpressureError(delay time.Duration, format string, args ...interface{}) error {
+	st := status.Newf(codes.ResourceExhausted, format, args...)
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
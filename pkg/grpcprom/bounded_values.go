@@ -0,0 +1,34 @@
+package grpcprom
+
+import "sync"
+
+// otherValue is the label value of the values left out of a boundedValues.
+const otherValue = "other"
+
+// boundedValues keeps the first values of a label coming from the clients, up to a maximum, and
+// labels the next ones other, so the clients can't create series on demand.
+type boundedValues struct {
+	max int
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func newBoundedValues(max int) *boundedValues {
+	return &boundedValues{max: max, seen: map[string]bool{}}
+}
+
+// value returns the value if it was already seen or there is room for it, and other otherwise.
+func (b *boundedValues) value(v string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.seen[v] {
+		return v
+	}
+	if len(b.seen) >= b.max {
+		return otherValue
+	}
+	b.seen[v] = true
+	return v
+}
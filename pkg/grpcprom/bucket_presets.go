@@ -0,0 +1,89 @@
+package grpcprom
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Bucket presets shared by the services, so the histograms of the same kind have the same buckets
+// and histogram_quantile can aggregate them across services.
+var (
+	// LatencyFastBuckets are the buckets of the latencies under a second, from 0.5ms, e.g. the
+	// ones of the cache or metadata RPCs.
+	LatencyFastBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	// LatencySlowBuckets are the buckets of the latencies up to a minute, from 10ms, e.g. the ones
+	// of the RPCs calling other services or databases.
+	LatencySlowBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	// BatchBuckets are the buckets of the batch durations, from a second to an hour.
+	BatchBuckets = []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600}
+	// SizesBytesBuckets are the buckets of the message or payload sizes, from 64B to 16MiB.
+	SizesBytesBuckets = prom.ExponentialBuckets(64, 4, 10)
+)
+
+// bucketPresets are the presets selectable by name.
+var bucketPresets = map[string]*[]float64{
+	"default":      &prom.DefBuckets,
+	"latency_fast": &LatencyFastBuckets,
+	"latency_slow": &LatencySlowBuckets,
+	"batch":        &BatchBuckets,
+	"sizes_bytes":  &SizesBytesBuckets,
+}
+
+// BucketPreset returns a copy of the buckets of the named preset: "default" (prom.DefBuckets),
+// "latency_fast", "latency_slow", "batch" or "sizes_bytes".
+func BucketPreset(name string) ([]float64, error) {
+	preset, ok := bucketPresets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket preset %q, want one of %v", name, BucketPresetNames())
+	}
+	return append([]float64(nil), *preset...), nil
+}
+
+// BucketPresetNames returns the sorted names of the bucket presets.
+func BucketPresetNames() []string {
+	names := make([]string, 0, len(bucketPresets))
+	for name := range bucketPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Buckets are histogram buckets read from a configuration, given either by the name of a preset
+// or by their upper bounds, e.g. "latency_fast" or [0.1, 1, 10] in JSON. It implements
+// encoding.TextUnmarshaler, so YAML scalars select presets by name too.
+type Buckets []float64
+
+// UnmarshalText sets the buckets of the named preset.
+func (b *Buckets) UnmarshalText(text []byte) error {
+	buckets, err := BucketPreset(string(text))
+	if err != nil {
+		return err
+	}
+	*b = buckets
+	return nil
+}
+
+// UnmarshalJSON sets the buckets of the named preset, or the listed upper bounds, which must be
+// increasing.
+func (b *Buckets) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		return b.UnmarshalText([]byte(name))
+	}
+
+	var bounds []float64
+	if err := json.Unmarshal(data, &bounds); err != nil {
+		return fmt.Errorf("buckets must be a preset name or a list of upper bounds: %w", err)
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return fmt.Errorf("bucket upper bounds %v are not increasing", bounds)
+		}
+	}
+	*b = bounds
+	return nil
+}
@@ -0,0 +1,20 @@
+package grpcprom_test
+
+import (
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBuildInfoWithInstanceLabels(t *testing.T) {
+	t.Setenv("VERSION", "v1.2.3")
+
+	registerer, err := grpcprom.WrapRegistererWithInstanceLabels(prom.NewRegistry(), grpcprom.DefaultInstanceLabels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := registerer.Register(grpcprom.NewBuildInfoCollector()); err != nil {
+		t.Errorf("build info collides with the instance labels: %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package grpcprom
+
+import (
+	"context"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// channelzTimeout bounds the channelz queries of a scrape.
+const channelzTimeout = 5 * time.Second
+
+// maxChannelzSockets bounds the sockets of a server read on every scrape, since every socket
+// takes a GetSocket query.
+const maxChannelzSockets = 100
+
+// ChannelzCollector is a prometheus collector exposing the channelz data of a process: the calls
+// of its channels, subchannels and servers, the state of the channels and the streams of the
+// server sockets. It gives transport level visibility without installing stats handlers.
+//
+// The entities are aggregated by kind and target, since their channelz ids change with every
+// reconnection and would churn the series. The streams are summed over the first
+// maxChannelzSockets sockets of every server.
+//
+// The data is read at scrape time through the channelz service, usually registered on the
+// server itself with service.RegisterChannelzServiceToServer and queried with a loopback
+// connection.
+type ChannelzCollector struct {
+	client channelzpb.ChannelzClient
+
+	callsStarted     *prom.Desc
+	callsSucceeded   *prom.Desc
+	callsFailed      *prom.Desc
+	state            *prom.Desc
+	sockets          *prom.Desc
+	streamsStarted   *prom.Desc
+	streamsSucceeded *prom.Desc
+	streamsFailed    *prom.Desc
+}
+
+// channelzEntity identifies the aggregated channelz entities.
+type channelzEntity struct {
+	kind, target string
+}
+
+// channelzState identifies the aggregated channelz entities in a connectivity state.
+type channelzState struct {
+	channelzEntity
+	state string
+}
+
+// channelzCalls are the calls of the aggregated channelz entities.
+type channelzCalls struct {
+	started, succeeded, failed int64
+}
+
+// channelzData is the channelz data of a scrape, aggregated by kind and target.
+type channelzData struct {
+	calls   map[channelzEntity]*channelzCalls
+	states  map[channelzState]int
+	sockets map[channelzEntity]int
+
+	streamsStarted, streamsSucceeded, streamsFailed int64
+}
+
+func (d *channelzData) addCalls(entity channelzEntity, started, succeeded, failed int64) {
+	calls, ok := d.calls[entity]
+	if !ok {
+		calls = &channelzCalls{}
+		d.calls[entity] = calls
+	}
+	calls.started += started
+	calls.succeeded += succeeded
+	calls.failed += failed
+}
+
+// NewChannelzCollector returns a ChannelzCollector reading the channelz data with client.
+func NewChannelzCollector(client channelzpb.ChannelzClient) *ChannelzCollector {
+	entityLabels := []string{"kind", "target"}
+
+	return &ChannelzCollector{
+		client: client,
+		callsStarted: prom.NewDesc(
+			"grpc_channelz_calls_started_total",
+			"Total number of calls started on the channelz entity.",
+			entityLabels, nil,
+		),
+		callsSucceeded: prom.NewDesc(
+			"grpc_channelz_calls_succeeded_total",
+			"Total number of calls succeeded on the channelz entity.",
+			entityLabels, nil,
+		),
+		callsFailed: prom.NewDesc(
+			"grpc_channelz_calls_failed_total",
+			"Total number of calls failed on the channelz entity.",
+			entityLabels, nil,
+		),
+		state: prom.NewDesc(
+			"grpc_channelz_connectivity_state",
+			"Number of channels and subchannels in the connectivity state.",
+			append(entityLabels, "state"), nil,
+		),
+		sockets: prom.NewDesc(
+			"grpc_channelz_sockets",
+			"Number of open sockets of the channelz entity.",
+			entityLabels, nil,
+		),
+		streamsStarted: prom.NewDesc(
+			"grpc_channelz_server_streams_started_total",
+			"Total number of streams started on the sockets of the servers.",
+			nil, nil,
+		),
+		streamsSucceeded: prom.NewDesc(
+			"grpc_channelz_server_streams_succeeded_total",
+			"Total number of streams succeeded on the sockets of the servers.",
+			nil, nil,
+		),
+		streamsFailed: prom.NewDesc(
+			"grpc_channelz_server_streams_failed_total",
+			"Total number of streams failed on the sockets of the servers.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe describes the channelz metrics.
+func (c *ChannelzCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.callsStarted
+	ch <- c.callsSucceeded
+	ch <- c.callsFailed
+	ch <- c.state
+	ch <- c.sockets
+	ch <- c.streamsStarted
+	ch <- c.streamsSucceeded
+	ch <- c.streamsFailed
+}
+
+// Collect queries the channelz service and collects its metrics. Failed queries are reported as
+// invalid metrics, so the scrape fails instead of silently missing series.
+func (c *ChannelzCollector) Collect(ch chan<- prom.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), channelzTimeout)
+	defer cancel()
+
+	data := &channelzData{
+		calls:   make(map[channelzEntity]*channelzCalls),
+		states:  make(map[channelzState]int),
+		sockets: make(map[channelzEntity]int),
+	}
+	if err := c.collectChannels(ctx, data); err != nil {
+		ch <- prom.NewInvalidMetric(c.callsStarted, err)
+		return
+	}
+	if err := c.collectServers(ctx, data); err != nil {
+		ch <- prom.NewInvalidMetric(c.streamsStarted, err)
+		return
+	}
+
+	for entity, calls := range data.calls {
+		ch <- prom.MustNewConstMetric(c.callsStarted, prom.CounterValue, float64(calls.started), entity.kind, entity.target)
+		ch <- prom.MustNewConstMetric(c.callsSucceeded, prom.CounterValue, float64(calls.succeeded), entity.kind, entity.target)
+		ch <- prom.MustNewConstMetric(c.callsFailed, prom.CounterValue, float64(calls.failed), entity.kind, entity.target)
+	}
+	for state, n := range data.states {
+		ch <- prom.MustNewConstMetric(c.state, prom.GaugeValue, float64(n), state.kind, state.target, state.state)
+	}
+	for entity, n := range data.sockets {
+		ch <- prom.MustNewConstMetric(c.sockets, prom.GaugeValue, float64(n), entity.kind, entity.target)
+	}
+	ch <- prom.MustNewConstMetric(c.streamsStarted, prom.CounterValue, float64(data.streamsStarted))
+	ch <- prom.MustNewConstMetric(c.streamsSucceeded, prom.CounterValue, float64(data.streamsSucceeded))
+	ch <- prom.MustNewConstMetric(c.streamsFailed, prom.CounterValue, float64(data.streamsFailed))
+}
+
+func (c *ChannelzCollector) collectChannels(ctx context.Context, data *channelzData) error {
+	var start int64
+	for {
+		resp, err := c.client.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return err
+		}
+
+		for _, channel := range resp.GetChannel() {
+			channelData := channel.GetData()
+			entity := channelzEntity{kind: "channel", target: channelData.GetTarget()}
+
+			data.addCalls(entity, channelData.GetCallsStarted(), channelData.GetCallsSucceeded(), channelData.GetCallsFailed())
+			data.states[channelzState{entity, channelData.GetState().GetState().String()}]++
+
+			for _, ref := range channel.GetSubchannelRef() {
+				if err := c.collectSubchannel(ctx, data, ref.GetSubchannelId()); err != nil {
+					return err
+				}
+			}
+			start = channel.GetRef().GetChannelId() + 1
+		}
+
+		if resp.GetEnd() || len(resp.GetChannel()) == 0 {
+			return nil
+		}
+	}
+}
+
+func (c *ChannelzCollector) collectSubchannel(ctx context.Context, data *channelzData, id int64) error {
+	resp, err := c.client.GetSubchannel(ctx, &channelzpb.GetSubchannelRequest{SubchannelId: id})
+	if status.Code(err) == codes.NotFound {
+		// The subchannel was closed since the channel was read.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	subchannel := resp.GetSubchannel()
+	subchannelData := subchannel.GetData()
+	entity := channelzEntity{kind: "subchannel", target: subchannelData.GetTarget()}
+
+	data.addCalls(entity, subchannelData.GetCallsStarted(), subchannelData.GetCallsSucceeded(), subchannelData.GetCallsFailed())
+	data.states[channelzState{entity, subchannelData.GetState().GetState().String()}]++
+	data.sockets[entity] += len(subchannel.GetSocketRef())
+	return nil
+}
+
+func (c *ChannelzCollector) collectServers(ctx context.Context, data *channelzData) error {
+	var start int64
+	for {
+		resp, err := c.client.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return err
+		}
+
+		for _, server := range resp.GetServer() {
+			id := server.GetRef().GetServerId()
+			serverData := server.GetData()
+			data.addCalls(channelzEntity{kind: "server"}, serverData.GetCallsStarted(), serverData.GetCallsSucceeded(), serverData.GetCallsFailed())
+
+			if err := c.collectServerSockets(ctx, data, id); err != nil {
+				return err
+			}
+			start = id + 1
+		}
+
+		if resp.GetEnd() || len(resp.GetServer()) == 0 {
+			return nil
+		}
+	}
+}
+
+// collectServerSockets adds the number of sockets of the server and the streams of its first
+// maxChannelzSockets sockets.
+func (c *ChannelzCollector) collectServerSockets(ctx context.Context, data *channelzData, serverID int64) error {
+	var (
+		start int64
+		read  int
+	)
+	for {
+		resp, err := c.client.GetServerSockets(ctx, &channelzpb.GetServerSocketsRequest{ServerId: serverID, StartSocketId: start})
+		if err != nil {
+			return err
+		}
+
+		for _, ref := range resp.GetSocketRef() {
+			start = ref.GetSocketId() + 1
+			if read == maxChannelzSockets {
+				data.sockets[channelzEntity{kind: "server"}]++
+				continue
+			}
+
+			socket, err := c.client.GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: ref.GetSocketId()})
+			if status.Code(err) == codes.NotFound {
+				// The socket was closed since the server sockets were listed.
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			socketData := socket.GetSocket().GetData()
+			read++
+			data.sockets[channelzEntity{kind: "server"}]++
+			data.streamsStarted += socketData.GetStreamsStarted()
+			data.streamsSucceeded += socketData.GetStreamsSucceeded()
+			data.streamsFailed += socketData.GetStreamsFailed()
+		}
+
+		if resp.GetEnd() || len(resp.GetSocketRef()) == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package grpcprom_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+)
+
+// fakeChannelz serves two channels to the same target, each with a subchannel, and a server
+// with the given number of sockets of one stream each.
+type fakeChannelz struct {
+	channelzpb.ChannelzClient
+
+	serverSockets int
+	socketQueries int
+}
+
+func (f *fakeChannelz) GetTopChannels(context.Context, *channelzpb.GetTopChannelsRequest, ...grpc.CallOption) (*channelzpb.GetTopChannelsResponse, error) {
+	channel := func(id int64, state channelzpb.ChannelConnectivityState_State) *channelzpb.Channel {
+		return &channelzpb.Channel{
+			Ref: &channelzpb.ChannelRef{ChannelId: id},
+			Data: &channelzpb.ChannelData{
+				Target:         "localhost:9093",
+				State:          &channelzpb.ChannelConnectivityState{State: state},
+				CallsStarted:   2,
+				CallsSucceeded: 1,
+				CallsFailed:    1,
+			},
+			SubchannelRef: []*channelzpb.SubchannelRef{{SubchannelId: id + 100}},
+		}
+	}
+	return &channelzpb.GetTopChannelsResponse{
+		Channel: []*channelzpb.Channel{
+			channel(1, channelzpb.ChannelConnectivityState_READY),
+			channel(2, channelzpb.ChannelConnectivityState_IDLE),
+		},
+		End: true,
+	}, nil
+}
+
+func (f *fakeChannelz) GetSubchannel(_ context.Context, req *channelzpb.GetSubchannelRequest, _ ...grpc.CallOption) (*channelzpb.GetSubchannelResponse, error) {
+	return &channelzpb.GetSubchannelResponse{
+		Subchannel: &channelzpb.Subchannel{
+			Ref: &channelzpb.SubchannelRef{SubchannelId: req.GetSubchannelId()},
+			Data: &channelzpb.ChannelData{
+				Target:       "127.0.0.1:9093",
+				State:        &channelzpb.ChannelConnectivityState{State: channelzpb.ChannelConnectivityState_READY},
+				CallsStarted: 1,
+			},
+			SocketRef: []*channelzpb.SocketRef{{SocketId: req.GetSubchannelId() + 100}},
+		},
+	}, nil
+}
+
+func (f *fakeChannelz) GetServers(context.Context, *channelzpb.GetServersRequest, ...grpc.CallOption) (*channelzpb.GetServersResponse, error) {
+	return &channelzpb.GetServersResponse{
+		Server: []*channelzpb.Server{{
+			Ref:  &channelzpb.ServerRef{ServerId: 1},
+			Data: &channelzpb.ServerData{CallsStarted: 3, CallsSucceeded: 3},
+		}},
+		End: true,
+	}, nil
+}
+
+func (f *fakeChannelz) GetServerSockets(context.Context, *channelzpb.GetServerSocketsRequest, ...grpc.CallOption) (*channelzpb.GetServerSocketsResponse, error) {
+	refs := make([]*channelzpb.SocketRef, f.serverSockets)
+	for i := range refs {
+		refs[i] = &channelzpb.SocketRef{SocketId: int64(1000 + i)}
+	}
+	return &channelzpb.GetServerSocketsResponse{SocketRef: refs, End: true}, nil
+}
+
+func (f *fakeChannelz) GetSocket(_ context.Context, req *channelzpb.GetSocketRequest, _ ...grpc.CallOption) (*channelzpb.GetSocketResponse, error) {
+	f.socketQueries++
+	return &channelzpb.GetSocketResponse{
+		Socket: &channelzpb.Socket{
+			Ref:  &channelzpb.SocketRef{SocketId: req.GetSocketId()},
+			Data: &channelzpb.SocketData{StreamsStarted: 1, StreamsSucceeded: 1},
+		},
+	}, nil
+}
+
+func TestChannelzCollectorAggregated(t *testing.T) {
+	const maxSockets = 100
+
+	client := &fakeChannelz{serverSockets: 150}
+	reg := newRegistry(t, grpcprom.NewChannelzCollector(client))
+
+	// The ids of the channels and subchannels are not labels, and the streams are read from the
+	// first 100 sockets only.
+	assertMetrics(t, reg, `
+# HELP grpc_channelz_calls_started_total Total number of calls started on the channelz entity.
+# TYPE grpc_channelz_calls_started_total counter
+grpc_channelz_calls_started_total{kind="channel",target="localhost:9093"} 4
+grpc_channelz_calls_started_total{kind="server",target=""} 3
+grpc_channelz_calls_started_total{kind="subchannel",target="127.0.0.1:9093"} 2
+# HELP grpc_channelz_connectivity_state Number of channels and subchannels in the connectivity state.
+# TYPE grpc_channelz_connectivity_state gauge
+grpc_channelz_connectivity_state{kind="channel",state="IDLE",target="localhost:9093"} 1
+grpc_channelz_connectivity_state{kind="channel",state="READY",target="localhost:9093"} 1
+grpc_channelz_connectivity_state{kind="subchannel",state="READY",target="127.0.0.1:9093"} 2
+# HELP grpc_channelz_sockets Number of open sockets of the channelz entity.
+# TYPE grpc_channelz_sockets gauge
+grpc_channelz_sockets{kind="server",target=""} 150
+grpc_channelz_sockets{kind="subchannel",target="127.0.0.1:9093"} 2
+# HELP grpc_channelz_server_streams_started_total Total number of streams started on the sockets of the servers.
+# TYPE grpc_channelz_server_streams_started_total counter
+grpc_channelz_server_streams_started_total 100
+`, "grpc_channelz_calls_started_total", "grpc_channelz_connectivity_state", "grpc_channelz_sockets", "grpc_channelz_server_streams_started_total")
+
+	if client.socketQueries != maxSockets {
+		t.Errorf("%d sockets queried, want %d", client.socketQueries, maxSockets)
+	}
+}
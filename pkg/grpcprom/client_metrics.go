@@ -0,0 +1,91 @@
+package grpcprom
+
+import (
+	"context"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// ClientMetrics represents a collection of metrics to be registered on a Prometheus metrics
+// registry for a gRPC client.
+type ClientMetrics struct {
+	labels                 []string
+	clientHandledCounter   *prom.CounterVec
+	clientHandledHistogram *prom.HistogramVec
+}
+
+// NewClientMetrics returns a ClientMetrics which exposes the grpc client metrics for prometheus.
+// It mirrors the ServerMetrics so both sides of a call can be compared.
+func NewClientMetrics() *ClientMetrics {
+	labels := []string{"grpc_service", "grpc_method", "grpc_status"}
+	return &ClientMetrics{
+		labels: labels,
+		clientHandledCounter: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_client_handled_total",
+				Help: "Total number of RPCs completed by the client, regardless of success or failure.",
+			}, labels,
+		),
+		clientHandledHistogram: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_client_handling_seconds",
+				Help:    "Histogram of response latency (seconds) of the gRPC until it is finished by the application.",
+				Buckets: prom.DefBuckets,
+			}, labels,
+		),
+	}
+}
+
+func (m *ClientMetrics) Describe(ch chan<- *prom.Desc) {
+	m.clientHandledCounter.Describe(ch)
+	m.clientHandledHistogram.Describe(ch)
+}
+
+func (m *ClientMetrics) Collect(ch chan<- prom.Metric) {
+	m.clientHandledCounter.Collect(ch)
+	m.clientHandledHistogram.Collect(ch)
+}
+
+// UnaryClientInterceptor is a gRPC client-side interceptor that provides Prometheus monitoring for Unary RPCs.
+func (m *ClientMetrics) UnaryClientInterceptor() func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		service, name := splitMethodName(method)
+		monitor := newClientReporter(m, map[string]string{
+			"grpc_service": service,
+			"grpc_method":  name,
+		})
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		st, _ := status.FromError(err)
+		monitor.labels["grpc_status"] = st.Code().String()
+		monitor.Handled()
+		return err
+	}
+}
+
+type clientReporter struct {
+	metrics   *ClientMetrics
+	labels    map[string]string
+	startTime time.Time
+}
+
+func newClientReporter(m *ClientMetrics, labels map[string]string) *clientReporter {
+	r := &clientReporter{
+		metrics:   m,
+		labels:    labels,
+		startTime: time.Now(),
+	}
+	return r
+}
+
+func (r *clientReporter) Handled() {
+	var orderedLabels []string
+	for _, labelName := range r.metrics.labels {
+		orderedLabels = append(orderedLabels, r.labels[labelName])
+	}
+
+	r.metrics.clientHandledCounter.WithLabelValues(orderedLabels...).Inc()
+	r.metrics.clientHandledHistogram.WithLabelValues(orderedLabels...).Observe(time.Since(r.startTime).Seconds())
+}
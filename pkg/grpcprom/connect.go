@@ -0,0 +1,69 @@
+package grpcprom
+
+import (
+	"context"
+
+	"connectrpc.com/connect"
+	"google.golang.org/grpc/codes"
+)
+
+// ConnectInterceptor is a connect.Interceptor that records the ServerMetrics for the handlers of
+// a connect-go server, with the same metric names and labels as the gRPC interceptors so services
+// migrating from grpc-go keep their dashboards.
+type ConnectInterceptor struct {
+	metrics *ServerMetrics
+}
+
+var _ connect.Interceptor = (*ConnectInterceptor)(nil)
+
+// ConnectInterceptor returns a connect.Interceptor recording the metrics of the handlers. Pass it
+// to the handlers with connect.WithInterceptors.
+func (m *ServerMetrics) ConnectInterceptor() *ConnectInterceptor {
+	return &ConnectInterceptor{
+		metrics: m,
+	}
+}
+
+// WrapUnary records the metrics of unary handlers. Unary clients are not instrumented.
+func (i *ConnectInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+
+		metricLabels := i.metrics.metricLabels(contextWithRequest(ctx, req.Any()), req.Spec().Procedure)
+		monitor := newServerReporter(ctx, i.metrics, req.Spec().Procedure, metricLabels)
+		resp, err := next(i.metrics.contextWithLabels(i.metrics.contextWithRPCValues(ctx, monitor), monitor), req)
+		monitor.labels["grpc_status"] = connectStatus(err)
+		i.metrics.mergeErrorLabels(monitor.labels, err)
+		monitor.Handled()
+		return resp, err
+	}
+}
+
+// WrapStreamingClient does not instrument streaming clients.
+func (i *ConnectInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+// WrapStreamingHandler records the metrics of streaming handlers once the stream is finished.
+func (i *ConnectInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		metricLabels := i.metrics.metricLabels(ctx, conn.Spec().Procedure)
+		monitor := newServerReporter(ctx, i.metrics, conn.Spec().Procedure, metricLabels)
+		err := next(i.metrics.contextWithLabels(i.metrics.contextWithRPCValues(ctx, monitor), monitor), conn)
+		monitor.labels["grpc_status"] = connectStatus(err)
+		i.metrics.mergeErrorLabels(monitor.labels, err)
+		monitor.Handled()
+		return err
+	}
+}
+
+// connectStatus returns the grpc_status label for the error returned by a connect handler.
+// Connect codes have the same values as the gRPC ones, so they are named after the gRPC codes.
+func connectStatus(err error) string {
+	if err == nil {
+		return codes.OK.String()
+	}
+	return codes.Code(connect.CodeOf(err)).String()
+}
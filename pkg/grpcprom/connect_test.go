@@ -0,0 +1,63 @@
+package grpcprom_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestConnectInterceptor(t *testing.T) {
+	const procedure = "/demo.v1.Greeter/SayHello"
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "ok",
+			want: `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK"} 1`,
+		},
+		{
+			name: "connect error",
+			err:  connect.NewError(connect.CodeNotFound, errors.New("no such user")),
+			want: `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="NotFound"} 1`,
+		},
+		{
+			name: "plain error",
+			err:  errors.New("boom"),
+			want: `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="Unknown"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+			reg := newRegistry(t, m)
+
+			handler := connect.NewUnaryHandler(procedure,
+				func(context.Context, *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return connect.NewResponse(&emptypb.Empty{}), nil
+				},
+				connect.WithInterceptors(m.ConnectInterceptor()),
+			)
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			client := connect.NewClient[emptypb.Empty, emptypb.Empty](server.Client(), server.URL+procedure)
+			_, err := client.CallUnary(context.Background(), connect.NewRequest(&emptypb.Empty{}))
+			if (err != nil) != (tt.err != nil) {
+				t.Fatalf("call error %v, want %v", err, tt.err)
+			}
+
+			assertMetrics(t, reg, handledHeader+tt.want+"\n", "grpc_server_handled_total")
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package grpcprom
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/stats"
+)
+
+// connectionAgeLabel is the label of the ConnectionAgeLabelExtractor.
+const connectionAgeLabel = "connection_age_class"
+
+// ConnectionAgeLabelExtractor is a LabelExtractor labeling the RPCs with connection_age_class:
+// cold for the RPCs arriving on a freshly established connection, warm for the others, which
+// separates the TCP and TLS setup effects from the handler latency. It is also the
+// stats.Handler tagging the connections, which must be installed with grpc.StatsHandler; the
+// RPCs of untagged connections, like the ones of the other transports, get the default value.
+type ConnectionAgeLabelExtractor struct {
+	coldAge time.Duration
+}
+
+// connectionAge is the tag of a connection.
+type connectionAge struct {
+	established time.Time
+	rpcs        atomic.Int64
+}
+
+type connectionAgeKey struct{}
+
+type connectionAgeClassKey struct{}
+
+// NewConnectionAgeLabelExtractor returns a ConnectionAgeLabelExtractor labeling cold the first
+// RPC of every connection and the RPCs of the connections established less than coldAge ago.
+func NewConnectionAgeLabelExtractor(coldAge time.Duration) *ConnectionAgeLabelExtractor {
+	return &ConnectionAgeLabelExtractor{coldAge: coldAge}
+}
+
+// LabelNames returns the connection_age_class label
+func (e *ConnectionAgeLabelExtractor) LabelNames() []string {
+	return []string{connectionAgeLabel}
+}
+
+// Labels returns the age class of the connection of the RPC.
+func (e *ConnectionAgeLabelExtractor) Labels(ctx context.Context) map[string]string {
+	labels := map[string]string{}
+	if class, ok := ctx.Value(connectionAgeClassKey{}).(string); ok {
+		labels[connectionAgeLabel] = class
+	}
+	return labels
+}
+
+// TagConn tags the connection with its establishment time.
+func (e *ConnectionAgeLabelExtractor) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return context.WithValue(ctx, connectionAgeKey{}, &connectionAge{established: time.Now()})
+}
+
+// HandleConn does nothing.
+func (e *ConnectionAgeLabelExtractor) HandleConn(context.Context, stats.ConnStats) {}
+
+// TagRPC tags the RPC with the age class of its connection.
+func (e *ConnectionAgeLabelExtractor) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	conn, ok := ctx.Value(connectionAgeKey{}).(*connectionAge)
+	if !ok {
+		return ctx
+	}
+
+	class := "warm"
+	if conn.rpcs.Add(1) == 1 || time.Since(conn.established) < e.coldAge {
+		class = "cold"
+	}
+	return context.WithValue(ctx, connectionAgeClassKey{}, class)
+}
+
+// HandleRPC does nothing.
+func (e *ConnectionAgeLabelExtractor) HandleRPC(context.Context, stats.RPCStats) {}
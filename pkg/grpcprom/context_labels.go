@@ -0,0 +1,95 @@
+package grpcprom
+
+import (
+	"context"
+	"sync"
+)
+
+type contextLabelsKey struct{}
+
+// contextLabels are the labels stashed in the context of an RPC with ContextWithLabels.
+type contextLabels struct {
+	mu     sync.Mutex
+	labels map[string]string
+}
+
+// WithContextLabels declares labels set by the interceptors running before or inside the metrics
+// one, like the tenant or the principal established by an auth interceptor, with
+// ContextWithLabels, so the LabelExtractor doesn't need to derive them again. The labels not
+// stashed in the context of an RPC take the value of the LabelExtractor, or the default one.
+func WithContextLabels(labelNames ...string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.contextLabels = append(m.contextLabels, labelNames...)
+		for _, labelName := range labelNames {
+			if !containsLabel(m.labels, labelName) {
+				m.labels = append(m.labels, labelName)
+			}
+		}
+	}
+}
+
+// containsLabel reports if the label names contain name.
+func containsLabel(labelNames []string, name string) bool {
+	for _, labelName := range labelNames {
+		if labelName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ContextWithLabels stashes labels in the context of an RPC, for the labels declared with
+// WithContextLabels. It can be called by the interceptors running before the metrics one, which
+// must then give the returned context to the next handler, and by the ones running inside it or
+// the handler itself, until the RPC is handled.
+func ContextWithLabels(ctx context.Context, labels map[string]string) context.Context {
+	stashed, ok := ctx.Value(contextLabelsKey{}).(*contextLabels)
+	if !ok {
+		stashed = &contextLabels{labels: map[string]string{}}
+		ctx = context.WithValue(ctx, contextLabelsKey{}, stashed)
+	}
+
+	stashed.mu.Lock()
+	defer stashed.mu.Unlock()
+
+	for name, value := range labels {
+		stashed.labels[name] = value
+	}
+	return ctx
+}
+
+// contextWithLabels returns the context to give to the handler, with the labels stashed in the
+// context, or new ones the interceptors running inside the metrics one can stash labels in,
+// when the ServerMetrics declares context labels.
+func (m *ServerMetrics) contextWithLabels(ctx context.Context, r *serverReporter) context.Context {
+	if len(m.contextLabels) == 0 {
+		return ctx
+	}
+	if stashed, ok := ctx.Value(contextLabelsKey{}).(*contextLabels); ok {
+		r.stashed = stashed
+		return ctx
+	}
+	r.stashed = &contextLabels{labels: map[string]string{}}
+	return context.WithValue(ctx, contextLabelsKey{}, r.stashed)
+}
+
+// mergeContextLabels sets the declared context labels stashed in the context, redacted.
+func (m *ServerMetrics) mergeContextLabels(labels map[string]string, stashed *contextLabels) {
+	if stashed == nil {
+		return
+	}
+
+	merged := map[string]string{}
+	stashed.mu.Lock()
+	for _, labelName := range m.contextLabels {
+		if v, ok := stashed.labels[labelName]; ok {
+			merged[labelName] = v
+		}
+	}
+	stashed.mu.Unlock()
+
+	m.redact(merged)
+	for name, value := range merged {
+		labels[name] = value
+	}
+}
@@ -0,0 +1,23 @@
+package grpcprom
+
+import (
+	"syscall"
+	"time"
+)
+
+const threadCPUTimeSupported = true
+
+// threadCPUTime returns the user and system CPU time consumed by the current thread.
+func threadCPUTime() (time.Duration, error) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_THREAD, &usage); err != nil {
+		return 0, err
+	}
+	return cpuDuration(int64(usage.Utime.Sec), int64(usage.Utime.Usec)) +
+		cpuDuration(int64(usage.Stime.Sec), int64(usage.Stime.Usec)), nil
+}
+
+// cpuDuration converts the seconds and microseconds of a syscall.Timeval to a time.Duration.
+func cpuDuration(sec, usec int64) time.Duration {
+	return time.Duration(sec)*time.Second + time.Duration(usec)*time.Microsecond
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package grpcprom
+
+import (
+	"errors"
+	"time"
+)
+
+const threadCPUTimeSupported = false
+
+// threadCPUTime is not supported outside of Linux.
+func threadCPUTime() (time.Duration, error) {
+	return 0, errors.New("thread CPU time is only supported on Linux")
+}
@@ -0,0 +1,44 @@
+package grpcprom_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+)
+
+func TestCPUMetricsLockedThreads(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []grpcprom.CPUMetricsOption
+		want int
+	}{
+		{
+			name: "default",
+		},
+		{
+			name: "locked threads",
+			opts: []grpcprom.CPUMetricsOption{grpcprom.WithLockedThreads()},
+			want: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.want > 0 && runtime.GOOS != "linux" {
+				t.Skip("the CPU time is only recorded on Linux")
+			}
+			m := grpcprom.NewCPUMetrics(tt.opts...)
+			info := &grpc.UnaryServerInfo{FullMethod: "/demo.v1.Greeter/SayHello"}
+			_, _ = m.UnaryServerInterceptor()(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+
+			if n := testutil.CollectAndCount(m, "grpc_server_cpu_seconds"); n != tt.want {
+				t.Errorf("%d CPU time series, want %d", n, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package grpcprom
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// DefDeadlineBuckets are the default buckets of the deadline consumption histogram. Values
+// above 1 are RPCs which took longer than the deadline of the caller.
+var DefDeadlineBuckets = []float64{0.01, 0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 1, 1.5}
+
+// WithDeadlineHistogram makes the ServerMetrics export grpc_server_deadline_consumed_ratio, the
+// fraction of the deadline of the caller consumed by each RPC: the handling time divided by the
+// time left until the deadline when the RPC was received. RPCs without deadline are not recorded.
+func WithDeadlineHistogram(buckets []float64) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.deadlineHistogram = prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_server_deadline_consumed_ratio",
+				Help:    "Histogram of the fraction of the caller deadline consumed by the RPCs handled by the server.",
+				Buckets: buckets,
+			}, []string{"grpc_service", "grpc_method", "grpc_status"},
+		)
+	}
+}
+
+// observeDeadline records the deadline consumption of an RPC received at start, with the given
+// deadline, which finished after elapsed.
+func (m *ServerMetrics) observeDeadline(labels map[string]string, start, deadline time.Time, elapsed time.Duration) {
+	if m.deadlineHistogram == nil || deadline.IsZero() {
+		return
+	}
+
+	budget := deadline.Sub(start)
+	if budget <= 0 {
+		return
+	}
+	m.deadlineHistogram.WithLabelValues(
+		labels["grpc_service"], labels["grpc_method"], labels["grpc_status"],
+	).Observe(float64(elapsed) / float64(budget))
+}
@@ -0,0 +1,94 @@
+package grpcprom
+
+import (
+	"context"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefBudgetBuckets are the default buckets of the deadline budget histogram, in seconds.
+var DefBudgetBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// DeadlineBudgetMetrics is a client interceptor propagating the deadline budget of the server
+// handling a call to the calls it makes downstream: the outgoing deadline is shrunk by a reserve
+// kept for the server to process the response. The budget passed to every downstream method is
+// observed, and the calls with no budget left fail right away with DeadlineExceeded instead of
+// being sent, which helps diagnosing cascading deadline exhaustion across services.
+type DeadlineBudgetMetrics struct {
+	reserve time.Duration
+
+	budget     *prom.HistogramVec
+	exhausted  *prom.CounterVec
+	noDeadline *prom.CounterVec
+}
+
+// NewDeadlineBudgetMetrics returns a DeadlineBudgetMetrics keeping reserve of the remaining
+// budget for the server itself, with the given buckets of the budget histogram.
+func NewDeadlineBudgetMetrics(reserve time.Duration, buckets []float64) *DeadlineBudgetMetrics {
+	labels := []string{"grpc_service", "grpc_method"}
+	return &DeadlineBudgetMetrics{
+		reserve: reserve,
+		budget: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_client_deadline_budget_seconds",
+				Help:    "Histogram of the deadline budget (seconds) passed to the downstream calls.",
+				Buckets: buckets,
+			}, labels,
+		),
+		exhausted: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_client_deadline_budget_exhausted_total",
+				Help: "Total number of downstream calls not sent because the deadline budget was exhausted.",
+			}, labels,
+		),
+		noDeadline: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_client_deadline_budget_unbounded_total",
+				Help: "Total number of downstream calls sent without deadline.",
+			}, labels,
+		),
+	}
+}
+
+// Describe describes the deadline budget metrics.
+func (m *DeadlineBudgetMetrics) Describe(ch chan<- *prom.Desc) {
+	m.budget.Describe(ch)
+	m.exhausted.Describe(ch)
+	m.noDeadline.Describe(ch)
+}
+
+// Collect collects the deadline budget metrics.
+func (m *DeadlineBudgetMetrics) Collect(ch chan<- prom.Metric) {
+	m.budget.Collect(ch)
+	m.exhausted.Collect(ch)
+	m.noDeadline.Collect(ch)
+}
+
+// UnaryClientInterceptor shrinks the deadline of the outgoing calls by the reserve and records the
+// budget they are given.
+func (m *DeadlineBudgetMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		service, name := splitMethodName(method)
+
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			m.noDeadline.WithLabelValues(service, name).Inc()
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		budget := time.Until(deadline) - m.reserve
+		if budget <= 0 {
+			m.exhausted.WithLabelValues(service, name).Inc()
+			return status.Errorf(codes.DeadlineExceeded, "deadline budget exhausted before calling %s", method)
+		}
+		m.budget.WithLabelValues(service, name).Observe(budget.Seconds())
+
+		ctx, cancel := context.WithTimeout(ctx, budget)
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,103 @@
+package grpcprom
+
+import (
+	"sync"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// deltaState is the cumulative state of a series at the previous export.
+type deltaState struct {
+	value   float64
+	count   uint64
+	buckets []uint64
+}
+
+// DeltaGatherer is a prom.Gatherer converting the cumulative counters, histograms and summaries
+// of the wrapped gatherer to deltas since the previous Gather, for the push exporters of backends
+// which require delta temporality. Every Gather starts a new export period, so it must have a
+// single consumer. Gauges are exported as they are, and series which reset since the previous
+// export report their whole value.
+type DeltaGatherer struct {
+	gatherer prom.Gatherer
+
+	mu       sync.Mutex
+	previous map[string]deltaState
+}
+
+// NewDeltaGatherer returns a DeltaGatherer wrapping gatherer. The first Gather reports the
+// cumulative values.
+func NewDeltaGatherer(gatherer prom.Gatherer) *DeltaGatherer {
+	return &DeltaGatherer{
+		gatherer: gatherer,
+		previous: map[string]deltaState{},
+	}
+}
+
+// delta returns current minus previous, or current if the series reset.
+func delta(current, previous float64) float64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+func deltaCount(current, previous uint64) uint64 {
+	if current < previous {
+		return current
+	}
+	return current - previous
+}
+
+// Gather gathers the metrics of the wrapped gatherer and replaces the cumulative values by
+// their deltas.
+func (g *DeltaGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	current := make(map[string]deltaState, len(g.previous))
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			key := counterKey(family.GetName(), metric)
+			previous := g.previous[key]
+
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value := metric.GetCounter().GetValue()
+				current[key] = deltaState{value: value}
+				metric.Counter.Value = proto.Float64(delta(value, previous.value))
+
+			case dto.MetricType_SUMMARY:
+				s := metric.GetSummary()
+				current[key] = deltaState{value: s.GetSampleSum(), count: s.GetSampleCount()}
+				reset := s.GetSampleCount() < previous.count
+				s.SampleCount = proto.Uint64(deltaCount(s.GetSampleCount(), previous.count))
+				if !reset {
+					s.SampleSum = proto.Float64(s.GetSampleSum() - previous.value)
+				}
+
+			case dto.MetricType_HISTOGRAM:
+				h := metric.GetHistogram()
+				state := deltaState{value: h.GetSampleSum(), count: h.GetSampleCount()}
+				reset := h.GetSampleCount() < previous.count || len(h.GetBucket()) != len(previous.buckets)
+				for i, bucket := range h.GetBucket() {
+					state.buckets = append(state.buckets, bucket.GetCumulativeCount())
+					if !reset && previous.buckets != nil {
+						bucket.CumulativeCount = proto.Uint64(deltaCount(bucket.GetCumulativeCount(), previous.buckets[i]))
+					}
+				}
+				current[key] = state
+				if !reset {
+					h.SampleCount = proto.Uint64(h.GetSampleCount() - previous.count)
+					h.SampleSum = proto.Float64(h.GetSampleSum() - previous.value)
+				}
+			}
+		}
+	}
+	g.previous = current
+	return families, err
+}
@@ -0,0 +1,66 @@
+package grpcprom_test
+
+import (
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestDeltaGatherer(t *testing.T) {
+	calls := 5.0
+	counter := prom.NewCounterFunc(prom.CounterOpts{Name: "demo_calls_total", Help: "Calls."}, func() float64 {
+		return calls
+	})
+	histogram := prom.NewHistogram(prom.HistogramOpts{Name: "demo_latency_seconds", Help: "Latency.", Buckets: []float64{0.1, 1}})
+	histogram.Observe(0.05)
+	gauge := prom.NewGauge(prom.GaugeOpts{Name: "demo_in_flight", Help: "In flight."})
+	gauge.Set(3)
+
+	g := grpcprom.NewDeltaGatherer(newRegistry(t, counter, histogram, gauge))
+	names := []string{"demo_calls_total", "demo_latency_seconds", "demo_in_flight"}
+
+	// The first gather reports the cumulative values.
+	assertMetrics(t, g, `
+# HELP demo_calls_total Calls.
+# TYPE demo_calls_total counter
+demo_calls_total 5
+# HELP demo_in_flight In flight.
+# TYPE demo_in_flight gauge
+demo_in_flight 3
+# HELP demo_latency_seconds Latency.
+# TYPE demo_latency_seconds histogram
+demo_latency_seconds_bucket{le="0.1"} 1
+demo_latency_seconds_bucket{le="1"} 1
+demo_latency_seconds_bucket{le="+Inf"} 1
+demo_latency_seconds_sum 0.05
+demo_latency_seconds_count 1
+`, names...)
+
+	// The next ones the deltas, except for the gauges.
+	calls = 7
+	histogram.Observe(0.5)
+	assertMetrics(t, g, `
+# HELP demo_calls_total Calls.
+# TYPE demo_calls_total counter
+demo_calls_total 2
+# HELP demo_in_flight In flight.
+# TYPE demo_in_flight gauge
+demo_in_flight 3
+# HELP demo_latency_seconds Latency.
+# TYPE demo_latency_seconds histogram
+demo_latency_seconds_bucket{le="0.1"} 0
+demo_latency_seconds_bucket{le="1"} 1
+demo_latency_seconds_bucket{le="+Inf"} 1
+demo_latency_seconds_sum 0.5
+demo_latency_seconds_count 1
+`, names...)
+
+	// A counter which reset reports its whole value.
+	calls = 1
+	assertMetrics(t, g, `
+# HELP demo_calls_total Calls.
+# TYPE demo_calls_total counter
+demo_calls_total 1
+`, "demo_calls_total")
+}
@@ -0,0 +1,55 @@
+package grpcprom
+
+import (
+	"context"
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/metadata"
+)
+
+// maxDeprecatedUserAgents bounds the user_agent values of the deprecated calls. The user-agent is
+// sent by the clients, so the calls of the next ones are labeled other.
+const maxDeprecatedUserAgents = 64
+
+// WithDeprecatedMethods marks the full methods (/package.Service/Method) as deprecated: their
+// calls are counted in grpc_server_deprecated_method_calls_total by user_agent, the first
+// product/version of the client user-agent, e.g. myapp/1.2 for "myapp/1.2 grpc-go/1.62.0", giving
+// the API owners hard data for their removal timelines. Only the first 64 user-agents are labeled
+// with their name, the calls of the next ones are labeled other.
+func WithDeprecatedMethods(fullMethods ...string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		if m.deprecated == nil {
+			m.deprecated = map[string]bool{}
+			m.deprecatedAgents = newBoundedValues(maxDeprecatedUserAgents)
+			m.deprecatedCalls = prom.NewCounterVec(
+				prom.CounterOpts{
+					Name: "grpc_server_deprecated_method_calls_total",
+					Help: "Total number of calls of the deprecated methods, by client user-agent.",
+				}, []string{"grpc_service", "grpc_method", "user_agent"},
+			)
+		}
+		for _, fullMethod := range fullMethods {
+			m.deprecated[fullMethod] = true
+		}
+	}
+}
+
+// countDeprecated counts the call of a deprecated method, with its service and method labels.
+func (m *ServerMetrics) countDeprecated(ctx context.Context, fullMethod string, labels map[string]string) {
+	if m.deprecatedCalls == nil || !m.deprecated[fullMethod] {
+		return
+	}
+	agent := m.deprecatedAgents.value(userAgent(ctx))
+	m.deprecatedCalls.WithLabelValues(labels["grpc_service"], labels["grpc_method"], agent).Inc()
+}
+
+// userAgent returns the first product/version of the user-agent of the incoming context.
+func userAgent(ctx context.Context) string {
+	values := metadata.ValueFromIncomingContext(ctx, "user-agent")
+	if len(values) == 0 {
+		return unknownName
+	}
+	product, _, _ := strings.Cut(strings.TrimSpace(values[0]), " ")
+	return sanitizeName(product)
+}
@@ -0,0 +1,45 @@
+package grpcprom_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestDeprecatedMethodsUserAgents(t *testing.T) {
+	m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, grpcprom.WithDeprecatedMethods("/demo.v1.Greeter/SayHello"))
+	reg := newRegistry(t, m)
+
+	call := func(userAgent string) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", userAgent))
+		callUnary(m, ctx, nil, "/demo.v1.Greeter/SayHello", nil)
+	}
+	// Every client sends its own user-agent, only the first ones get their own series.
+	for i := 0; i < 70; i++ {
+		call(fmt.Sprintf("app%d/1.0 grpc-go/1.62.0", i))
+	}
+	call("app0/1.0 grpc-go/1.62.0")
+	call("late/1.0")
+	callUnary(m, context.Background(), nil, "/demo.v1.Greeter/Chat", nil)
+
+	if n := testutil.CollectAndCount(reg, "grpc_server_deprecated_method_calls_total"); n != 65 {
+		t.Errorf("%d user_agent series, want 64 and other", n)
+	}
+	want := `
+# HELP grpc_server_deprecated_method_calls_total Total number of calls of the deprecated methods, by client user-agent.
+# TYPE grpc_server_deprecated_method_calls_total counter
+`
+	for i := 0; i < 64; i++ {
+		calls := 1
+		if i == 0 {
+			calls = 2
+		}
+		want += fmt.Sprintf("grpc_server_deprecated_method_calls_total{grpc_method=\"SayHello\",grpc_service=\"demo.v1.Greeter\",user_agent=\"app%d/1.0\"} %d\n", i, calls)
+	}
+	want += `grpc_server_deprecated_method_calls_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",user_agent="other"} 7` + "\n"
+	assertMetrics(t, reg, want, "grpc_server_deprecated_method_calls_total")
+}
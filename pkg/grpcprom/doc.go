@@ -0,0 +1,13 @@
+// Package grpcprom provides Prometheus monitoring for gRPC servers and clients.
+//
+// ServerMetrics and ClientMetrics are prometheus collectors exposing the handled RPCs counter and
+// the handling time histogram. Their interceptors label every RPC with its service, method and
+// status, plus the custom labels returned by a LabelExtractor:
+//
+//	metrics := grpcprom.NewServerMetrics(labelExtractor)
+//	registry.MustRegister(metrics)
+//	server := grpc.NewServer(grpc.UnaryInterceptor(metrics.UnaryServerInterceptor()))
+//
+// The same metric families can be fed by connect-go (ConnectInterceptor) and Twirp (TwirpHooks)
+// servers, and HTTPMetrics instruments plain HTTP handlers with the same custom labels.
+package grpcprom
@@ -0,0 +1,38 @@
+package grpcprom
+
+import (
+	"errors"
+)
+
+// ErrorLabeler is implemented by the errors carrying domain-specific failure labels, like the
+// reason of a failed payment. The interceptors merge them into the labels of the failed RPCs,
+// also when the error is wrapped.
+type ErrorLabeler interface {
+	MetricLabels() map[string]string
+}
+
+// mergeErrorLabels sets the labels of err, when it is an ErrorLabeler. Only the declared custom
+// labels are set, so errors can't override the reserved labels or create undeclared labels. The
+// values go through the same sanitizing, schema and redaction as the extracted labels.
+func (m *ServerMetrics) mergeErrorLabels(labels map[string]string, err error) {
+	var labeler ErrorLabeler
+	if err == nil || !errors.As(err, &labeler) {
+		return
+	}
+
+	errorLabels := labeler.MetricLabels()
+	merged := map[string]string{}
+	for _, labelName := range m.labels {
+		if reservedLabels[labelName] {
+			continue
+		}
+		if v, ok := errorLabels[labelName]; ok {
+			merged[labelName] = m.labelSchema.conformValue(labelName, sanitizeLabelValue(v))
+		}
+	}
+
+	m.redact(merged)
+	for name, value := range merged {
+		labels[name] = value
+	}
+}
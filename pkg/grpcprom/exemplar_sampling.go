@@ -0,0 +1,108 @@
+package grpcprom
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// quantileLearningRate is the step, in log space, of the online quantile estimates of the
+// exemplar sampling: large enough to follow a latency shift within a few hundred RPCs, small
+// enough to keep the estimate stable.
+const quantileLearningRate = 0.05
+
+// ExemplarSampling is the policy choosing the RPCs whose trace ID is attached as exemplar to the
+// handling time observation. The failed RPCs always get one.
+type ExemplarSampling struct {
+	// SuccessEvery attaches the exemplar to 1 in SuccessEvery successful RPCs of each method.
+	// Zero or one attaches it to all of them.
+	SuccessEvery uint64
+	// SlowQuantile also attaches the exemplar to the successful RPCs slower than this quantile of
+	// the handling time of their method, e.g. 0.99, estimated online. Zero disables it.
+	SlowQuantile float64
+}
+
+// WithExemplarSampling makes the ServerMetrics attach the exemplars, enabled by WithTracer, to a
+// sample of the RPCs chosen by the policy, so the high-QPS methods don't blow the exemplar storage
+// limits of Prometheus while the errors and the slow RPCs keep theirs.
+func WithExemplarSampling(policy ExemplarSampling) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.exemplarSampling = &exemplarSampling{policy: policy}
+	}
+}
+
+// exemplarSampling holds the sampling state of every method.
+type exemplarSampling struct {
+	policy   ExemplarSampling
+	methods  sync.Map
+	size     atomic.Int64
+	overflow methodExemplarSampler
+}
+
+// methodExemplarSampler is the sampling state of a method.
+type methodExemplarSampler struct {
+	successes atomic.Uint64
+
+	mu sync.Mutex
+	// logQuantile is the estimate of the log of the SlowQuantile, once seen.
+	logQuantile float64
+	seen        bool
+}
+
+// sampleExemplar reports whether the handling time observation of the RPC, with the given status
+// before collapsing, gets its exemplar.
+func (m *ServerMetrics) sampleExemplar(labels map[string]string, status string, elapsed time.Duration) bool {
+	s := m.exemplarSampling
+	if s == nil {
+		return true
+	}
+	if status != codes.OK.String() || s.policy.SuccessEvery <= 1 {
+		return true
+	}
+
+	sampler := s.sampler(labels["grpc_service"] + "/" + labels["grpc_method"])
+	slow := s.policy.SlowQuantile > 0 && sampler.slow(s.policy.SlowQuantile, elapsed)
+	return sampler.successes.Add(1)%s.policy.SuccessEvery == 1 || slow
+}
+
+// sampler returns the sampling state of the method. Beyond maxLabelPrototypes methods, the new
+// ones share the same state.
+func (s *exemplarSampling) sampler(method string) *methodExemplarSampler {
+	if sampler, ok := s.methods.Load(method); ok {
+		return sampler.(*methodExemplarSampler)
+	}
+	if s.size.Load() >= maxLabelPrototypes {
+		return &s.overflow
+	}
+	sampler, loaded := s.methods.LoadOrStore(method, &methodExemplarSampler{})
+	if !loaded {
+		s.size.Add(1)
+	}
+	return sampler.(*methodExemplarSampler)
+}
+
+// slow updates the online estimate of the quantile with the handling time and reports whether
+// it's above the estimate. The estimate moves up by q steps when a value is above it and down by
+// 1-q steps otherwise, so it settles where a fraction 1-q of the values is above it.
+func (s *methodExemplarSampler) slow(q float64, elapsed time.Duration) bool {
+	v := math.Log(math.Max(elapsed.Seconds(), minSketchValue))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.seen {
+		s.logQuantile = v
+		s.seen = true
+		return false
+	}
+	above := v > s.logQuantile
+	if above {
+		s.logQuantile += quantileLearningRate * q
+	} else {
+		s.logQuantile -= quantileLearningRate * (1 - q)
+	}
+	return above
+}
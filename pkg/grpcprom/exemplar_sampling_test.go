@@ -0,0 +1,78 @@
+package grpcprom
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestExemplarSampling(t *testing.T) {
+	labels := map[string]string{"grpc_service": "demo.v1.Greeter", "grpc_method": "SayHello"}
+	ok, internal := codes.OK.String(), codes.Internal.String()
+
+	tests := []struct {
+		name   string
+		policy ExemplarSampling
+		calls  []time.Duration
+		status string
+		want   int
+	}{
+		{
+			name:   "every success",
+			policy: ExemplarSampling{},
+			calls:  []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond},
+			status: ok,
+			want:   3,
+		},
+		{
+			name:   "one in three successes",
+			policy: ExemplarSampling{SuccessEvery: 3},
+			calls:  []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond, time.Millisecond},
+			status: ok,
+			want:   2,
+		},
+		{
+			name:   "every failure",
+			policy: ExemplarSampling{SuccessEvery: 3},
+			calls:  []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond},
+			status: internal,
+			want:   3,
+		},
+		{
+			name:   "slow successes",
+			policy: ExemplarSampling{SuccessEvery: 100, SlowQuantile: 0.99},
+			calls:  []time.Duration{time.Millisecond, 500 * time.Microsecond, 250 * time.Microsecond, time.Second},
+			status: ok,
+			// The first success is sampled, and the slow one.
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewServerMetrics(&DefaultLabelExtractor{}, WithExemplarSampling(tt.policy))
+
+			sampled := 0
+			for _, elapsed := range tt.calls {
+				if m.sampleExemplar(labels, tt.status, elapsed) {
+					sampled++
+				}
+			}
+			if sampled != tt.want {
+				t.Errorf("sampled %d exemplars, want %d", sampled, tt.want)
+			}
+		})
+	}
+}
+
+func TestExemplarSamplingPerMethod(t *testing.T) {
+	m := NewServerMetrics(&DefaultLabelExtractor{}, WithExemplarSampling(ExemplarSampling{SuccessEvery: 10}))
+
+	// The first success of every method is sampled.
+	for _, method := range []string{"SayHello", "Chat"} {
+		labels := map[string]string{"grpc_service": "demo.v1.Greeter", "grpc_method": method}
+		if !m.sampleExemplar(labels, codes.OK.String(), time.Millisecond) {
+			t.Errorf("first success of %s not sampled", method)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package grpcprom
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// ExpositionOptions configures the metrics handler returned by NewExpositionHandler.
+type ExpositionOptions struct {
+	// EnableOpenMetrics offers the OpenMetrics format, needed to expose the exemplars.
+	EnableOpenMetrics bool
+	// DisableCompression serves the metrics uncompressed even if the scraper accepts gzip.
+	DisableCompression bool
+	// Logger logs, once, that native histograms were scraped in a text format, which can't
+	// expose them. Nothing is logged when it is nil.
+	Logger Logger
+}
+
+// ExpositionHandler serves the metrics of a gatherer like promhttp.HandlerFor, negotiating the
+// protobuf format needed to scrape the native histograms, and counts the scrapes by format. The
+// scrapes of native histograms in a text format, which silently drops their buckets, are counted
+// in metrics_native_histogram_text_scrapes_total.
+type ExpositionHandler struct {
+	handler http.Handler
+	options ExpositionOptions
+
+	// native tells if the last gather returned native histograms.
+	native atomic.Bool
+	warned sync.Once
+
+	formats    *prom.CounterVec
+	textScrape prom.Counter
+}
+
+// NewExpositionHandler returns an ExpositionHandler serving the metrics of the gatherer.
+func NewExpositionHandler(gatherer prom.Gatherer, options ExpositionOptions) *ExpositionHandler {
+	h := &ExpositionHandler{
+		options: options,
+		formats: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "metrics_exposition_format_total",
+				Help: "Total number of scrapes of the metrics endpoint, by negotiated exposition format.",
+			}, []string{"format"},
+		),
+		textScrape: prom.NewCounter(
+			prom.CounterOpts{
+				Name: "metrics_native_histogram_text_scrapes_total",
+				Help: "Total number of scrapes of native histograms in a text format, which can't expose them.",
+			},
+		),
+	}
+
+	inspecting := prom.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		h.native.Store(hasNativeHistograms(families))
+		return families, err
+	})
+	h.handler = promhttp.HandlerFor(inspecting, promhttp.HandlerOpts{
+		EnableOpenMetrics:  options.EnableOpenMetrics,
+		DisableCompression: options.DisableCompression,
+	})
+	return h
+}
+
+// hasNativeHistograms reports if any of the families has a native histogram.
+func hasNativeHistograms(families []*dto.MetricFamily) bool {
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_HISTOGRAM && family.GetType() != dto.MetricType_GAUGE_HISTOGRAM {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if metric.GetHistogram().Schema != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formatName returns the format label of the negotiated format.
+func formatName(format expfmt.Format) string {
+	switch format.FormatType() {
+	case expfmt.TypeProtoDelim, expfmt.TypeProtoCompact, expfmt.TypeProtoText:
+		return "protobuf"
+	case expfmt.TypeOpenMetrics:
+		return "openmetrics"
+	default:
+		return "text"
+	}
+}
+
+// ServeHTTP serves the metrics in the format negotiated with the scraper.
+func (h *ExpositionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var format expfmt.Format
+	if h.options.EnableOpenMetrics {
+		format = expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	} else {
+		format = expfmt.Negotiate(r.Header)
+	}
+
+	h.handler.ServeHTTP(w, r)
+
+	name := formatName(format)
+	h.formats.WithLabelValues(name).Inc()
+	if name == "protobuf" || !h.native.Load() {
+		return
+	}
+	h.textScrape.Inc()
+	if h.options.Logger != nil {
+		h.warned.Do(func() {
+			h.options.Logger.Printf("native histograms scraped in the %s format, which can't expose them: enable the protobuf scrape protocol in Prometheus", name)
+		})
+	}
+}
+
+// Describe describes the exposition metrics.
+func (h *ExpositionHandler) Describe(ch chan<- *prom.Desc) {
+	h.formats.Describe(ch)
+	h.textScrape.Describe(ch)
+}
+
+// Collect collects the exposition metrics.
+func (h *ExpositionHandler) Collect(ch chan<- prom.Metric) {
+	h.formats.Collect(ch)
+	h.textScrape.Collect(ch)
+}
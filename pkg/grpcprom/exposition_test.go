@@ -0,0 +1,50 @@
+package grpcprom_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExpositionHandler(t *testing.T) {
+	histogram := prom.NewHistogram(prom.HistogramOpts{
+		Name:                        "demo_latency_seconds",
+		Help:                        "Latency.",
+		NativeHistogramBucketFactor: 1.1,
+	})
+	histogram.Observe(0.05)
+
+	h := grpcprom.NewExpositionHandler(newRegistry(t, histogram), grpcprom.ExpositionOptions{EnableOpenMetrics: true})
+	reg := newRegistry(t, h)
+
+	for _, accept := range []string{
+		"text/plain;version=0.0.4",
+		"application/openmetrics-text;version=1.0.0",
+		"application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "demo_latency_seconds") {
+			t.Errorf("Accept %s: got status %d and body %q", accept, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Only the text scrapes drop the native buckets.
+	assertMetrics(t, reg, `
+# HELP metrics_exposition_format_total Total number of scrapes of the metrics endpoint, by negotiated exposition format.
+# TYPE metrics_exposition_format_total counter
+metrics_exposition_format_total{format="openmetrics"} 1
+metrics_exposition_format_total{format="protobuf"} 1
+metrics_exposition_format_total{format="text"} 1
+# HELP metrics_native_histogram_text_scrapes_total Total number of scrapes of native histograms in a text format, which can't expose them.
+# TYPE metrics_native_histogram_text_scrapes_total counter
+metrics_native_histogram_text_scrapes_total 2
+`, "metrics_exposition_format_total", "metrics_native_histogram_text_scrapes_total")
+}
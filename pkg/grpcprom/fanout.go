@@ -0,0 +1,81 @@
+package grpcprom
+
+import (
+	"context"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// noInboundMethod is the inbound service and method label of the calls made outside of an RPC.
+const noInboundMethod = "none"
+
+// FanOutMetrics is a client interceptor correlating the downstream calls of a process to the
+// inbound RPC they are made for, found in their context. It counts the calls per inbound and
+// downstream method, which divided by grpc_server_handled_total gives the fan-out of every
+// inbound method.
+type FanOutMetrics struct {
+	calls *prom.CounterVec
+}
+
+// NewFanOutMetrics returns a FanOutMetrics.
+func NewFanOutMetrics() *FanOutMetrics {
+	return &FanOutMetrics{
+		calls: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_client_fanout_calls_total",
+				Help: "Total number of downstream calls started, by inbound RPC method.",
+			}, []string{"grpc_inbound_service", "grpc_inbound_method", "grpc_service", "grpc_method"},
+		),
+	}
+}
+
+// Describe describes the fan-out counter.
+func (m *FanOutMetrics) Describe(ch chan<- *prom.Desc) {
+	m.calls.Describe(ch)
+}
+
+// Collect collects the fan-out counter.
+func (m *FanOutMetrics) Collect(ch chan<- prom.Metric) {
+	m.calls.Collect(ch)
+}
+
+// UnaryClientInterceptor counts the outgoing calls by inbound RPC method.
+func (m *FanOutMetrics) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		m.count(ctx, method)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor counts the outgoing streams by inbound RPC method.
+func (m *FanOutMetrics) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		m.count(ctx, method)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+func (m *FanOutMetrics) count(ctx context.Context, method string) {
+	inboundService, inboundMethod := noInboundMethod, noInboundMethod
+	if fullMethod := inboundFullMethod(ctx); fullMethod != "" {
+		inboundService, inboundMethod = splitMethodName(fullMethod)
+	}
+	service, name := splitMethodName(method)
+	m.calls.WithLabelValues(inboundService, inboundMethod, service, name).Inc()
+}
+
+type fullMethodKey struct{}
+
+// inboundFullMethod returns the full method of the RPC handled with the context, or an empty
+// string outside of an RPC. The full method is set by the ServerMetrics for its label extractor,
+// and else found in the context of the gRPC and Twirp RPCs.
+func inboundFullMethod(ctx context.Context) string {
+	if fullMethod, ok := ctx.Value(fullMethodKey{}).(string); ok {
+		return fullMethod
+	}
+	if fullMethod, ok := grpc.Method(ctx); ok {
+		return fullMethod
+	}
+	return twirpFullMethod(ctx)
+}
@@ -0,0 +1,137 @@
+package grpcprom
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// checkLabelValue fails the test if the value is not a bounded label value.
+func checkLabelValue(t *testing.T, kind, value string) {
+	t.Helper()
+
+	if !utf8.ValidString(value) {
+		t.Fatalf("%s %q is not valid UTF-8", kind, value)
+	}
+	if len(value) > maxNameLength {
+		t.Fatalf("%s %q is %d bytes long, want at most %d", kind, value, len(value), maxNameLength)
+	}
+	if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		t.Fatalf("%s %q has control characters", kind, value)
+	}
+}
+
+func FuzzSplitMethodName(f *testing.F) {
+	for _, seed := range []string{
+		"/demo.v1.Greeter/SayHello",
+		"",
+		"/",
+		"//",
+		"SayHello",
+		"/demo.v1.Greeter/",
+		"/démo.v1.Grüßer/Sägen",
+		"/demo\x00/\xff\xfe",
+		"/" + strings.Repeat("é", 100) + "/" + strings.Repeat("m", 200),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, fullMethod string) {
+		service, method := splitMethodName(fullMethod)
+		checkLabelValue(t, "service", service)
+		checkLabelValue(t, "method", method)
+		if service == "" || method == "" {
+			t.Fatalf("splitMethodName(%q) = %q, %q, want non-empty labels", fullMethod, service, method)
+		}
+
+		// The well-formed short names are kept as they are.
+		s, m, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+		if ok && s != "" && m != "" && s == sanitizeLabelValue(s) && m == sanitizeLabelValue(m) && (s != service || m != method) {
+			t.Fatalf("splitMethodName(%q) = %q, %q, want %q, %q", fullMethod, service, method, s, m)
+		}
+	})
+}
+
+func FuzzLabelExtractors(f *testing.F) {
+	f.Add("acme", "batch")
+	f.Add("", "")
+	f.Add("\xff\x00tenant", "BATCH")
+	f.Add(strings.Repeat("ü", 200), "interactive\n")
+
+	metadataExtractor := NewMetadataLabelExtractor(map[string]string{"x-tenant-id": "tenant", "authorization": "token"})
+	qosExtractor := NewQoSLabelExtractor()
+	f.Fuzz(func(t *testing.T, tenant, priority string) {
+		md := metadata.Pairs("x-tenant-id", tenant, "authorization", tenant, PriorityMetadataKey, priority)
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+
+		labels := metadataExtractor.Labels(ctx)
+		if _, ok := labels["token"]; ok {
+			t.Fatalf("labels %v read the denied authorization key", labels)
+		}
+		checkLabelValue(t, "tenant", labels["tenant"])
+
+		class := qosExtractor.Labels(ctx)[qosLabel]
+		if class != "interactive" && class != "batch" {
+			t.Fatalf("priority %q got the qos class %q", priority, class)
+		}
+	})
+}
+
+func FuzzRelabelRedact(f *testing.F) {
+	f.Add("acme", "bob@example.com")
+	f.Add("", "Bearer abc.def")
+	f.Add("\xffACME", "mail a@b.c or x@y.z, bearer")
+	f.Add(strings.Repeat("İ", 100), "")
+
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	f.Fuzz(func(t *testing.T, tenant, user string) {
+		m := NewServerMetrics(
+			NewMetadataLabelExtractor(map[string]string{"x-tenant-id": "tenant", "x-user": "user"}),
+			WithRedaction(RedactEmails, RedactBearerTokens),
+			WithRelabeler(func(labels map[string]string) map[string]string {
+				relabeled := make(map[string]string, len(labels))
+				for name, value := range labels {
+					relabeled[name] = value
+				}
+				relabeled["tenant"] = strings.ToUpper(labels["tenant"])
+				return relabeled
+			}),
+		)
+		reg := prom.NewRegistry()
+		reg.MustRegister(m)
+
+		md := metadata.Pairs("x-tenant-id", tenant, "x-user", user)
+		ctx := metadata.NewIncomingContext(context.Background(), md)
+		_, _ = m.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/demo.v1.Greeter/SayHello"}, handler)
+
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, family := range families {
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if !utf8.ValidString(label.GetValue()) {
+						t.Fatalf("%s label %s=%q is not valid UTF-8", family.GetName(), label.GetName(), label.GetValue())
+					}
+					if label.GetName() != "user" {
+						continue
+					}
+					for _, rule := range []RedactionRule{RedactEmails, RedactBearerTokens} {
+						if rule.Pattern.MatchString(label.GetValue()) {
+							t.Fatalf("user %q recorded as %q, which still matches %v", user, label.GetValue(), rule.Pattern)
+						}
+					}
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package grpcprom
+
+import (
+	"runtime/metrics"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// gcPausesMetric is the runtime metric of the distribution of the stop-the-world pauses of the
+// GC. Every GC cycle pauses twice, when it starts and when its marking ends.
+const gcPausesMetric = "/sched/pauses/total/gc:seconds"
+
+// WithGCAffectedCounter makes the ServerMetrics count the RPCs during which a stop-the-world
+// pause of the GC happened in grpc_server_gc_affected_total, with the RPC labels, so the tail
+// latency caused by the GC can be told apart from slow handlers by comparing it with
+// grpc_server_handled_total. The pauses of the cycles still running when the RPC ends are
+// counted too, not only the ones of the cycles completed during the RPC.
+func WithGCAffectedCounter() ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.gcAffectedEnabled = true
+	}
+}
+
+// newGCAffectedCounter creates the counter of WithGCAffectedCounter.
+func (m *ServerMetrics) newGCAffectedCounter() {
+	if !m.gcAffectedEnabled {
+		return
+	}
+
+	m.gcAffected = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "grpc_server_gc_affected_total",
+			Help: "Total number of RPCs during which a GC stop-the-world pause happened.",
+		}, m.labels,
+	)
+}
+
+// gcPauses returns the number of stop-the-world pauses of the GC so far.
+func gcPauses() uint64 {
+	sample := []metrics.Sample{{Name: gcPausesMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return 0
+	}
+
+	var pauses uint64
+	for _, count := range sample[0].Value.Float64Histogram().Counts {
+		pauses += count
+	}
+	return pauses
+}
+
+// countGCAffected counts the RPC if the GC paused since it started, at startPauses.
+func (m *ServerMetrics) countGCAffected(labels map[string]string, startPauses uint64) {
+	if m.gcAffected == nil {
+		return
+	}
+	if gcPauses() != startPauses {
+		m.gcAffected.With(labels).Inc()
+	}
+}
@@ -0,0 +1,37 @@
+package grpcprom
+
+import (
+	"context"
+	"runtime"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+)
+
+func TestGCPausesCountsEveryPause(t *testing.T) {
+	before := gcPauses()
+	runtime.GC()
+
+	// A GC cycle pauses when it starts and when its marking ends.
+	if got := gcPauses() - before; got < 2 {
+		t.Errorf("%d GC pauses counted, want at least 2", got)
+	}
+}
+
+func TestGCAffectedCounter(t *testing.T) {
+	m := NewServerMetrics(&DefaultLabelExtractor{}, WithGCAffectedCounter())
+
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		runtime.GC()
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/demo.v1.Greeter/SayHello"}
+	_, _ = m.UnaryServerInterceptor()(context.Background(), nil, info, handler)
+
+	labels := prom.Labels{"grpc_service": "demo.v1.Greeter", "grpc_method": "SayHello", "grpc_status": "OK"}
+	if got := testutil.ToFloat64(m.gcAffected.With(labels)); got != 1 {
+		t.Errorf("%v RPCs affected by the GC, want 1", got)
+	}
+}
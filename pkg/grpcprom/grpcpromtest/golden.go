@@ -0,0 +1,139 @@
+package grpcpromtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// UpdateGoldenEnv is the environment variable which, set to 1, makes AssertGolden write the golden
+// files instead of comparing them, e.g. UPDATE_GOLDEN=1 go test ./...
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// maskedValue replaces the timing values in the golden files.
+const maskedValue = "*"
+
+// Exposition renders the metric families of the gatherer in the text exposition format, only the
+// ones named in metricNames if any. The families and series are sorted by the gatherer, so the
+// output is stable. The values of the families measured in seconds, except the sample counts, are
+// masked as they depend on the timing of the test.
+func Exposition(g prom.Gatherer, metricNames ...string) (string, error) {
+	families, err := g.Gather()
+	if err != nil {
+		return "", err
+	}
+
+	wanted := make(map[string]bool, len(metricNames))
+	for _, name := range metricNames {
+		wanted[name] = true
+	}
+
+	var buf bytes.Buffer
+	for _, family := range families {
+		if len(wanted) > 0 && !wanted[family.GetName()] {
+			continue
+		}
+
+		var familyBuf bytes.Buffer
+		enc := expfmt.NewEncoder(&familyBuf, expfmt.NewFormat(expfmt.TypeTextPlain))
+		if err := enc.Encode(family); err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(family.GetName(), "_seconds") {
+			buf.Write(familyBuf.Bytes())
+			continue
+		}
+		maskTimings(&buf, familyBuf.String(), family.GetName())
+	}
+	return buf.String(), nil
+}
+
+// maskTimings writes the lines of the family with the values of the samples masked, except the
+// ones of the _count series.
+func maskTimings(buf *bytes.Buffer, family string, name string) {
+	for _, line := range strings.SplitAfter(family, "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, name+"_count") {
+			buf.WriteString(line)
+			continue
+		}
+		i := strings.LastIndexByte(strings.TrimSuffix(line, "\n"), ' ')
+		buf.WriteString(line[:i+1] + maskedValue + "\n")
+	}
+}
+
+// AssertGolden fails the test if the exposition of the metric families of the gatherer, see
+// Exposition, differs from the golden file. The golden file is written instead when the
+// UPDATE_GOLDEN environment variable is 1.
+func AssertGolden(t testing.TB, g prom.Gatherer, goldenFile string, metricNames ...string) {
+	t.Helper()
+
+	got, err := Exposition(g, metricNames...)
+	if err != nil {
+		t.Fatalf("rendering the metrics: %v", err)
+	}
+
+	if os.Getenv(UpdateGoldenEnv) == "1" {
+		if err := os.MkdirAll(filepath.Dir(goldenFile), 0o755); err != nil {
+			t.Fatalf("creating the golden file directory: %v", err)
+		}
+		if err := os.WriteFile(goldenFile, []byte(got), 0o644); err != nil {
+			t.Fatalf("writing the golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("golden file %s does not exist, run the test with %s=1 to create it", goldenFile, UpdateGoldenEnv)
+	} else if err != nil {
+		t.Fatalf("reading the golden file: %v", err)
+	}
+
+	if diff := lineDiff(string(want), got); diff != "" {
+		t.Errorf("the metrics differ from %s (-want +got):\n%s", goldenFile, diff)
+	}
+}
+
+// lineDiff returns the lines only in want, prefixed with -, and the lines only in got, prefixed
+// with +. It is empty when both have the same lines.
+func lineDiff(want, got string) string {
+	wantLines := strings.Split(strings.TrimSuffix(want, "\n"), "\n")
+	gotLines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+
+	inWant := make(map[string]int, len(wantLines))
+	for _, line := range wantLines {
+		inWant[line]++
+	}
+	inGot := make(map[string]int, len(gotLines))
+	for _, line := range gotLines {
+		inGot[line]++
+	}
+
+	var diff strings.Builder
+	for _, line := range wantLines {
+		if inGot[line] > 0 {
+			inGot[line]--
+			continue
+		}
+		fmt.Fprintf(&diff, "-%s\n", line)
+	}
+	for _, line := range gotLines {
+		if inWant[line] > 0 {
+			inWant[line]--
+			continue
+		}
+		fmt.Fprintf(&diff, "+%s\n", line)
+	}
+	return diff.String()
+}
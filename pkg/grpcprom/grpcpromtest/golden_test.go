@@ -0,0 +1,74 @@
+package grpcpromtest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcpromtest"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestExposition(t *testing.T) {
+	reg := prom.NewRegistry()
+	reg.MustRegister(newServerMetrics())
+
+	got, err := grpcpromtest.Exposition(reg, "grpc_server_handling_seconds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "grpc_server_handled_total") {
+		t.Errorf("exposition has the unselected families:\n%s", got)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(got), "\n") {
+		switch {
+		case strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "grpc_server_handling_seconds_count"):
+			if strings.HasSuffix(line, " *") {
+				t.Errorf("sample count masked: %s", line)
+			}
+		case !strings.HasSuffix(line, " *"):
+			t.Errorf("timing value not masked: %s", line)
+		}
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	reg := prom.NewRegistry()
+	reg.MustRegister(newServerMetrics())
+
+	grpcpromtest.AssertGolden(t, reg, filepath.Join("testdata", "handled.golden"))
+
+	// A different exposition fails.
+	goldenFile := filepath.Join(t.TempDir(), "handled.golden")
+	if err := os.WriteFile(goldenFile, []byte("grpc_server_handled_total 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeT{TB: t}
+	grpcpromtest.AssertGolden(fake, reg, goldenFile)
+	if fake.failures != 1 {
+		t.Errorf("%d failures comparing with a different golden file, want 1", fake.failures)
+	}
+}
+
+func TestAssertGoldenUpdate(t *testing.T) {
+	reg := prom.NewRegistry()
+	reg.MustRegister(newServerMetrics())
+	goldenFile := filepath.Join(t.TempDir(), "golden", "handled.golden")
+
+	t.Setenv(grpcpromtest.UpdateGoldenEnv, "1")
+	grpcpromtest.AssertGolden(t, reg, goldenFile, "grpc_server_handled_total")
+
+	want, err := grpcpromtest.Exposition(reg, "grpc_server_handled_total")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("golden file:\n%s\nwant:\n%s", got, want)
+	}
+}
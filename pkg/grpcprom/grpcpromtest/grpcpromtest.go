@@ -0,0 +1,132 @@
+// Package grpcpromtest provides helpers to unit test that the handlers instrumented with grpcprom
+// produce the expected metrics, without scraping an endpoint.
+package grpcpromtest
+
+import (
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	handledMetric  = "grpc_server_handled_total"
+	handlingMetric = "grpc_server_handling_seconds"
+)
+
+// gather collects the metrics of the collector, e.g. a *grpcprom.ServerMetrics, in a registry of
+// its own.
+func gather(c prom.Collector) ([]*dto.MetricFamily, error) {
+	reg := prom.NewPedanticRegistry()
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return reg.Gather()
+}
+
+// matches reports if the metric is one of the full method (/package.Service/Method) with the
+// code.
+func matches(metric *dto.Metric, fullMethod string, code codes.Code) bool {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	want := map[string]string{
+		"grpc_service": service,
+		"grpc_method":  method,
+		"grpc_status":  code.String(),
+	}
+
+	found := 0
+	for _, pair := range metric.GetLabel() {
+		if v, ok := want[pair.GetName()]; ok {
+			if v != pair.GetValue() {
+				return false
+			}
+			found++
+		}
+	}
+	return found == len(want)
+}
+
+// HandledCount returns the number of RPCs of the full method handled with the code, summed over
+// the custom labels.
+func HandledCount(c prom.Collector, fullMethod string, code codes.Code) (float64, error) {
+	families, err := gather(c)
+	if err != nil {
+		return 0, err
+	}
+
+	var total float64
+	for _, family := range families {
+		if family.GetName() != handledMetric {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if matches(metric, fullMethod, code) {
+				total += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return total, nil
+}
+
+// HistogramSamples returns the number of handling time samples of the full method with the code,
+// summed over the custom labels.
+func HistogramSamples(c prom.Collector, fullMethod string, code codes.Code) (uint64, error) {
+	families, err := gather(c)
+	if err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for _, family := range families {
+		if family.GetName() != handlingMetric {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if matches(metric, fullMethod, code) {
+				total += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return total, nil
+}
+
+// AssertHandledCount fails the test if the number of RPCs of the full method handled with the
+// code isn't n.
+func AssertHandledCount(t testing.TB, c prom.Collector, fullMethod string, code codes.Code, n float64) {
+	t.Helper()
+
+	got, err := HandledCount(c, fullMethod, code)
+	if err != nil {
+		t.Fatalf("gathering the metrics: %v", err)
+	}
+	if got != n {
+		t.Errorf("%s{%s, %s} = %v, want %v", handledMetric, fullMethod, code, got, n)
+	}
+}
+
+// AssertHistogramSamples fails the test if the number of handling time samples of the full
+// method with the code isn't n.
+func AssertHistogramSamples(t testing.TB, c prom.Collector, fullMethod string, code codes.Code, n uint64) {
+	t.Helper()
+
+	got, err := HistogramSamples(c, fullMethod, code)
+	if err != nil {
+		t.Fatalf("gathering the metrics: %v", err)
+	}
+	if got != n {
+		t.Errorf("%s samples{%s, %s} = %v, want %v", handlingMetric, fullMethod, code, got, n)
+	}
+}
+
+// AssertSeriesCount fails the test if the collector doesn't export n series of the metric, e.g.
+// to check the custom labels don't create unexpected series.
+func AssertSeriesCount(t testing.TB, c prom.Collector, metricName string, n int) {
+	t.Helper()
+
+	if got := testutil.CollectAndCount(c, metricName); got != n {
+		t.Errorf("%s has %d series, want %d", metricName, got, n)
+	}
+}
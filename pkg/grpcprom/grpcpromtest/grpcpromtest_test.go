@@ -0,0 +1,137 @@
+package grpcpromtest_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcpromtest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const fullMethod = "/demo.v1.Greeter/SayHello"
+
+// call handles an RPC of the full method with the interceptor of the metrics, failing with the
+// code, from the tenant.
+func call(m *grpcprom.ServerMetrics, fullMethod string, code codes.Code, tenant string) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", tenant))
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(code, code.String())
+	}
+	_, _ = m.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: fullMethod}, handler)
+}
+
+// newServerMetrics returns ServerMetrics labeling the RPCs with their tenant, after handling
+// 3 OK RPCs of acme, 2 of globex and 1 NotFound RPC of acme.
+func newServerMetrics() *grpcprom.ServerMetrics {
+	m := grpcprom.NewServerMetrics(grpcprom.NewMetadataLabelExtractor(map[string]string{"x-tenant-id": "tenant"}))
+	for i := 0; i < 3; i++ {
+		call(m, fullMethod, codes.OK, "acme")
+	}
+	for i := 0; i < 2; i++ {
+		call(m, fullMethod, codes.OK, "globex")
+	}
+	call(m, fullMethod, codes.NotFound, "acme")
+	return m
+}
+
+func TestHandledCount(t *testing.T) {
+	m := newServerMetrics()
+
+	tests := []struct {
+		fullMethod string
+		code       codes.Code
+		want       float64
+	}{
+		{fullMethod: fullMethod, code: codes.OK, want: 5},
+		{fullMethod: fullMethod, code: codes.NotFound, want: 1},
+		{fullMethod: fullMethod, code: codes.Internal, want: 0},
+		{fullMethod: "/demo.v1.Greeter/SayGoodbye", code: codes.OK, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.fullMethod, tt.code), func(t *testing.T) {
+			got, err := grpcpromtest.HandledCount(m, tt.fullMethod, tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("HandledCount = %v, want %v", got, tt.want)
+			}
+			samples, err := grpcpromtest.HistogramSamples(m, tt.fullMethod, tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if samples != uint64(tt.want) {
+				t.Errorf("HistogramSamples = %v, want %v", samples, tt.want)
+			}
+
+			grpcpromtest.AssertHandledCount(t, m, tt.fullMethod, tt.code, tt.want)
+			grpcpromtest.AssertHistogramSamples(t, m, tt.fullMethod, tt.code, uint64(tt.want))
+		})
+	}
+}
+
+// fakeT records the failures of the assertions instead of failing the test.
+type fakeT struct {
+	testing.TB
+	failures int
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(string, ...interface{}) {
+	t.failures++
+}
+
+func (t *fakeT) Fatalf(string, ...interface{}) {
+	t.failures++
+}
+
+func TestAssertionsFail(t *testing.T) {
+	m := newServerMetrics()
+
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+	}{
+		{
+			name: "handled count",
+			assert: func(t testing.TB) {
+				grpcpromtest.AssertHandledCount(t, m, fullMethod, codes.OK, 4)
+			},
+		},
+		{
+			name: "histogram samples",
+			assert: func(t testing.TB) {
+				grpcpromtest.AssertHistogramSamples(t, m, fullMethod, codes.NotFound, 2)
+			},
+		},
+		{
+			name: "series count",
+			assert: func(t testing.TB) {
+				grpcpromtest.AssertSeriesCount(t, m, "grpc_server_handled_total", 2)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeT{TB: t}
+			tt.assert(fake)
+			if fake.failures != 1 {
+				t.Errorf("%d failures, want 1", fake.failures)
+			}
+		})
+	}
+}
+
+func TestAssertSeriesCount(t *testing.T) {
+	m := newServerMetrics()
+
+	// OK for acme and globex, NotFound for acme.
+	grpcpromtest.AssertSeriesCount(t, m, "grpc_server_handled_total", 3)
+	grpcpromtest.AssertSeriesCount(t, m, "grpc_server_handling_seconds", 3)
+}
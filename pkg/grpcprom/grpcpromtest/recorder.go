@@ -0,0 +1,112 @@
+package grpcpromtest
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+var _ grpcprom.MetricsSink = (*RecordingSink)(nil)
+
+// Record is one RPC recorded by the ServerMetrics.
+type Record struct {
+	// Labels are the labels of the RPC: grpc_service, grpc_method, grpc_status and the labels of
+	// the LabelExtractor.
+	Labels map[string]string
+	// Duration is the handling time of the RPC.
+	Duration time.Duration
+	// Code is the grpc_status label of the RPC.
+	Code string
+}
+
+// RecordingSink is an in-memory grpcprom.MetricsSink keeping every RPC the interceptors record,
+// so tests can assert on them without a registry:
+//
+//	sink := grpcpromtest.NewRecordingSink()
+//	metrics := grpcprom.NewServerMetrics(labelExtractor, grpcprom.WithSink(sink))
+type RecordingSink struct {
+	mu      sync.Mutex
+	handled int
+	records []Record
+}
+
+// NewRecordingSink returns an empty RecordingSink.
+func NewRecordingSink() *RecordingSink {
+	return &RecordingSink{}
+}
+
+// Inc counts one handled RPC.
+func (s *RecordingSink) Inc(labels map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handled++
+}
+
+// Observe records the RPC with its handling time, in seconds.
+func (s *RecordingSink) Observe(labels map[string]string, v float64) {
+	copied := copyLabels(labels)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.records = append(s.records, Record{
+		Labels:   copied,
+		Duration: time.Duration(v * float64(time.Second)),
+		Code:     labels["grpc_status"],
+	})
+}
+
+// Handled returns the number of RPCs counted.
+func (s *RecordingSink) Handled() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.handled
+}
+
+// Records returns copies of the recorded RPCs, in the order they were handled.
+func (s *RecordingSink) Records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := make([]Record, len(s.records))
+	for i, record := range s.records {
+		records[i] = record
+		records[i].Labels = copyLabels(record.Labels)
+	}
+	return records
+}
+
+// RecordsFor returns the recorded RPCs of the full method (/package.Service/Method).
+func (s *RecordingSink) RecordsFor(fullMethod string) []Record {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+
+	var records []Record
+	for _, record := range s.Records() {
+		if record.Labels["grpc_service"] == service && record.Labels["grpc_method"] == method {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Reset forgets the recorded RPCs.
+func (s *RecordingSink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handled = 0
+	s.records = nil
+}
+
+// copyLabels returns a copy of the labels.
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for name, value := range labels {
+		copied[name] = value
+	}
+	return copied
+}
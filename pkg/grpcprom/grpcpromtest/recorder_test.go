@@ -0,0 +1,57 @@
+package grpcpromtest_test
+
+import (
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcpromtest"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRecordingSink(t *testing.T) {
+	sink := grpcpromtest.NewRecordingSink()
+	m := grpcprom.NewServerMetrics(grpcprom.NewMetadataLabelExtractor(map[string]string{"x-tenant-id": "tenant"}), grpcprom.WithSink(sink))
+
+	call(m, fullMethod, codes.OK, "acme")
+	call(m, "/demo.v1.Greeter/SayGoodbye", codes.Unavailable, "globex")
+	call(m, fullMethod, codes.NotFound, "acme")
+
+	if got := sink.Handled(); got != 3 {
+		t.Errorf("Handled = %d, want 3", got)
+	}
+
+	records := sink.Records()
+	wantCodes := []string{"OK", "Unavailable", "NotFound"}
+	if len(records) != len(wantCodes) {
+		t.Fatalf("%d records, want %d", len(records), len(wantCodes))
+	}
+	for i, record := range records {
+		if record.Code != wantCodes[i] || record.Labels["grpc_status"] != wantCodes[i] {
+			t.Errorf("record %d has the code %q and the labels %v, want the code %q", i, record.Code, record.Labels, wantCodes[i])
+		}
+		if record.Duration <= 0 {
+			t.Errorf("record %d has the duration %v, want a positive one", i, record.Duration)
+		}
+	}
+	if got := records[1].Labels["tenant"]; got != "globex" {
+		t.Errorf("record 1 has the tenant %q, want globex", got)
+	}
+
+	// The records are copies: modifying them doesn't change the sink.
+	records[0].Labels["tenant"] = "modified"
+	if got := sink.Records()[0].Labels["tenant"]; got != "acme" {
+		t.Errorf("record 0 has the tenant %q after modifying a copy, want acme", got)
+	}
+
+	if got := len(sink.RecordsFor(fullMethod)); got != 2 {
+		t.Errorf("%d records of %s, want 2", got, fullMethod)
+	}
+	if got := len(sink.RecordsFor("/demo.v1.Greeter/Unknown")); got != 0 {
+		t.Errorf("%d records of an unknown method, want 0", got)
+	}
+
+	sink.Reset()
+	if sink.Handled() != 0 || len(sink.Records()) != 0 {
+		t.Errorf("Handled = %d and %d records after Reset, want none", sink.Handled(), len(sink.Records()))
+	}
+}
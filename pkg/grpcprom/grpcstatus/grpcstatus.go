@@ -0,0 +1,47 @@
+// Package grpcstatus converts the errors returned by the handlers to the gRPC status used as
+// grpc_status label.
+package grpcstatus
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcStatus is implemented by the errors carrying a gRPC status.
+type grpcStatus interface {
+	GRPCStatus() *status.Status
+}
+
+// FromError returns the gRPC status of err. Errors wrapping a status error with %w, like
+// fmt.Errorf("loading user: %w", err), get the code of the wrapped status and their own message.
+// It returns an OK status for a nil error, and false for the errors which don't carry a gRPC
+// status: the errors classified by a registered Mapper get its code, the context errors get the
+// DeadlineExceeded and Canceled codes, also when wrapped, and the other ones Unknown.
+func FromError(err error) (*status.Status, bool) {
+	if err == nil {
+		return status.New(codes.OK, ""), true
+	}
+
+	if se, ok := err.(grpcStatus); ok && se.GRPCStatus() != nil {
+		return se.GRPCStatus(), true
+	}
+
+	var se grpcStatus
+	if errors.As(err, &se) && se.GRPCStatus() != nil {
+		p := se.GRPCStatus().Proto()
+		p.Message = err.Error()
+		return status.FromProto(p), true
+	}
+
+	if code, _, ok := classify(err); ok {
+		return status.New(code, err.Error()), false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return status.FromContextError(err), false
+	}
+	return status.New(codes.Unknown, err.Error()), false
+}
@@ -0,0 +1,82 @@
+package grpcstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantMessage string
+		wantOK      bool
+	}{
+		{
+			name:     "nil",
+			err:      nil,
+			wantCode: codes.OK,
+			wantOK:   true,
+		},
+		{
+			name:        "status",
+			err:         status.Error(codes.NotFound, "no user"),
+			wantCode:    codes.NotFound,
+			wantMessage: "no user",
+			wantOK:      true,
+		},
+		{
+			name:        "wrapped status",
+			err:         fmt.Errorf("loading user: %w", status.Error(codes.NotFound, "no user")),
+			wantCode:    codes.NotFound,
+			wantMessage: "loading user: rpc error: code = NotFound desc = no user",
+			wantOK:      true,
+		},
+		{
+			name:        "twice wrapped status",
+			err:         fmt.Errorf("handler: %w", fmt.Errorf("loading user: %w", status.Error(codes.PermissionDenied, "denied"))),
+			wantCode:    codes.PermissionDenied,
+			wantMessage: "handler: loading user: rpc error: code = PermissionDenied desc = denied",
+			wantOK:      true,
+		},
+		{
+			name:        "canceled",
+			err:         context.Canceled,
+			wantCode:    codes.Canceled,
+			wantMessage: "context canceled",
+		},
+		{
+			name:        "deadline exceeded",
+			err:         context.DeadlineExceeded,
+			wantCode:    codes.DeadlineExceeded,
+			wantMessage: "context deadline exceeded",
+		},
+		{
+			name:        "wrapped deadline exceeded",
+			err:         fmt.Errorf("querying: %w", context.DeadlineExceeded),
+			wantCode:    codes.DeadlineExceeded,
+			wantMessage: "querying: context deadline exceeded",
+		},
+		{
+			name:        "plain error",
+			err:         errors.New("boom"),
+			wantCode:    codes.Unknown,
+			wantMessage: "boom",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, ok := FromError(tt.err)
+			if st.Code() != tt.wantCode || st.Message() != tt.wantMessage || ok != tt.wantOK {
+				t.Errorf("got (%v, %q, %v), want (%v, %q, %v)",
+					st.Code(), st.Message(), ok, tt.wantCode, tt.wantMessage, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package grpcstatus
+
+import (
+	"errors"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// NoErrorType is the error type of the RPCs which didn't fail.
+	NoErrorType = "none"
+	// OtherErrorType is the error type of the errors no Mapper classified.
+	OtherErrorType = "other"
+)
+
+// Mapper classifies the application errors it knows, returning their code and error type.
+type Mapper func(err error) (code codes.Code, errorType string, ok bool)
+
+var (
+	mappersMu sync.RWMutex
+	mappers   []Mapper
+)
+
+// Register adds a Mapper used by FromError and ErrorType for the errors which don't carry a gRPC
+// status. The mappers are tried in registration order.
+func Register(mapper Mapper) {
+	mappersMu.Lock()
+	defer mappersMu.Unlock()
+
+	mappers = append(mappers, mapper)
+}
+
+// RegisterError maps the errors matching target with errors.Is, usually a sentinel error, to the
+// code and error type.
+func RegisterError(target error, code codes.Code, errorType string) {
+	Register(func(err error) (codes.Code, string, bool) {
+		return code, errorType, errors.Is(err, target)
+	})
+}
+
+// classify returns the code and error type of the first Mapper classifying err.
+func classify(err error) (codes.Code, string, bool) {
+	mappersMu.RLock()
+	defer mappersMu.RUnlock()
+
+	for _, mapper := range mappers {
+		if code, errorType, ok := mapper(err); ok {
+			return code, errorType, true
+		}
+	}
+	return codes.Unknown, "", false
+}
+
+// ErrorType returns the error type of err given by the registered mappers, NoErrorType for a nil
+// error and OtherErrorType for the errors no Mapper classified.
+func ErrorType(err error) string {
+	if err == nil {
+		return NoErrorType
+	}
+	if _, errorType, ok := classify(err); ok {
+		return errorType
+	}
+	return OtherErrorType
+}
@@ -0,0 +1,123 @@
+package grpcstatus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errQuota    = errors.New("quota exceeded")
+)
+
+// withMappers replaces the registered mappers for the duration of the test.
+func withMappers(t *testing.T, register func()) {
+	t.Helper()
+
+	mappersMu.Lock()
+	saved := mappers
+	mappers = nil
+	mappersMu.Unlock()
+	t.Cleanup(func() {
+		mappersMu.Lock()
+		mappers = saved
+		mappersMu.Unlock()
+	})
+
+	register()
+}
+
+func TestMappers(t *testing.T) {
+	withMappers(t, func() {
+		RegisterError(errNotFound, codes.NotFound, "not_found")
+		// The first mapper classifying an error wins, so this one never classifies errNotFound.
+		Register(func(err error) (codes.Code, string, bool) {
+			return codes.Internal, "any", errors.Is(err, errNotFound) || errors.Is(err, errQuota)
+		})
+		RegisterError(errQuota, codes.ResourceExhausted, "quota")
+	})
+
+	tests := []struct {
+		name          string
+		err           error
+		wantCode      codes.Code
+		wantErrorType string
+	}{
+		{
+			name:          "nil",
+			err:           nil,
+			wantCode:      codes.OK,
+			wantErrorType: NoErrorType,
+		},
+		{
+			name:          "sentinel",
+			err:           errNotFound,
+			wantCode:      codes.NotFound,
+			wantErrorType: "not_found",
+		},
+		{
+			name:          "wrapped sentinel",
+			err:           fmt.Errorf("loading user: %w", errNotFound),
+			wantCode:      codes.NotFound,
+			wantErrorType: "not_found",
+		},
+		{
+			name:          "registration order",
+			err:           errQuota,
+			wantCode:      codes.Internal,
+			wantErrorType: "any",
+		},
+		{
+			name:          "status not classified",
+			err:           status.Error(codes.Aborted, "conflict"),
+			wantCode:      codes.Aborted,
+			wantErrorType: OtherErrorType,
+		},
+		{
+			name:          "context error not classified",
+			err:           context.Canceled,
+			wantCode:      codes.Canceled,
+			wantErrorType: OtherErrorType,
+		},
+		{
+			name:          "unknown error",
+			err:           errors.New("boom"),
+			wantCode:      codes.Unknown,
+			wantErrorType: OtherErrorType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, _ := FromError(tt.err)
+			if st.Code() != tt.wantCode {
+				t.Errorf("got code %v, want %v", st.Code(), tt.wantCode)
+			}
+			if got := ErrorType(tt.err); got != tt.wantErrorType {
+				t.Errorf("got error type %q, want %q", got, tt.wantErrorType)
+			}
+		})
+	}
+}
+
+func TestMapperStatusPrecedence(t *testing.T) {
+	withMappers(t, func() {
+		Register(func(err error) (codes.Code, string, bool) {
+			return codes.Internal, "any", true
+		})
+	})
+
+	// The errors carrying a status keep their code, the mappers only classify the other ones.
+	st, ok := FromError(fmt.Errorf("wrapped: %w", status.Error(codes.NotFound, "no user")))
+	if st.Code() != codes.NotFound || !ok {
+		t.Errorf("got (%v, %v), want (NotFound, true)", st.Code(), ok)
+	}
+	st, ok = FromError(errors.New("boom"))
+	if st.Code() != codes.Internal || ok {
+		t.Errorf("got (%v, %v), want (Internal, false)", st.Code(), ok)
+	}
+}
@@ -0,0 +1,99 @@
+package grpcprom
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// HistogramFamily is a handling time histogram family of WithHistogramSplit.
+type HistogramFamily struct {
+	// Name is the name of the family, e.g. grpc_server_search_handling_seconds.
+	Name    string
+	Buckets []float64
+}
+
+// histogramSplit routes the handling time observations to a family per value of a label.
+type histogramSplit struct {
+	label    string
+	families map[string]HistogramFamily
+}
+
+// WithHistogramSplit makes the ServerMetrics observe the handling time of the RPCs with the
+// listed values of the label, e.g. grpc_service, in separate histogram families, so the scrape
+// size and the buckets of very different services of one binary can be tuned independently. The
+// RPCs with other values are observed in grpc_server_handling_seconds. The families have the same
+// labels as grpc_server_handling_seconds. It is ignored with WithSink and
+// WithHandlingTimeObserver.
+func WithHistogramSplit(label string, families map[string]HistogramFamily) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.histogramSplit = &histogramSplit{label: label, families: families}
+	}
+}
+
+// splitSink is the prometheus sink observing the handling time of some values of a label in
+// their own families.
+type splitSink struct {
+	*prometheusSink
+	label    string
+	families map[string]*prom.HistogramVec
+}
+
+func newSplitSink(sink *prometheusSink, split *histogramSplit) *splitSink {
+	families := make(map[string]*prom.HistogramVec, len(split.families))
+	for value, family := range split.families {
+		families[value] = prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    family.Name,
+				Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server, for the " + split.label + " " + value + ".",
+				Buckets: family.Buckets,
+			}, sink.labels,
+		)
+	}
+	return &splitSink{
+		prometheusSink: sink,
+		label:          split.label,
+		families:       families,
+	}
+}
+
+// observerFor returns the observer of the labels, the one of their family if they have one.
+func (s *splitSink) observerFor(labels map[string]string) prom.Observer {
+	if family, ok := s.families[labels[s.label]]; ok {
+		return family.WithLabelValues(s.orderedLabels(labels)...)
+	}
+	return s.prometheusSink.observer.WithLabelValues(s.orderedLabels(labels)...)
+}
+
+func (s *splitSink) Observe(labels map[string]string, v float64) {
+	s.observerFor(labels).Observe(v)
+}
+
+func (s *splitSink) ObserveWithExemplar(labels map[string]string, v float64, exemplar prom.Labels) {
+	observeWithExemplar(s.observerFor(labels), v, exemplar)
+}
+
+func (s *splitSink) observeValues(labels map[string]string, values []string, v float64, exemplar prom.Labels) {
+	if family, ok := s.families[labels[s.label]]; ok {
+		observeWithExemplar(family.WithLabelValues(values...), v, exemplar)
+		return
+	}
+	s.prometheusSink.observeValues(labels, values, v, exemplar)
+}
+
+func (s *splitSink) Init(labels map[string]string) {
+	s.counter.WithLabelValues(s.orderedLabels(labels)...)
+	s.observerFor(labels)
+}
+
+func (s *splitSink) Describe(ch chan<- *prom.Desc) {
+	s.prometheusSink.Describe(ch)
+	for _, family := range s.families {
+		family.Describe(ch)
+	}
+}
+
+func (s *splitSink) Collect(ch chan<- prom.Metric) {
+	s.prometheusSink.Collect(ch)
+	for _, family := range s.families {
+		family.Collect(ch)
+	}
+}
@@ -0,0 +1,188 @@
+package grpcprom
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// HTTPMetrics exposes the metrics of plain HTTP handlers, like the REST gateway, with the same
+// custom labels used by the ServerMetrics so REST and gRPC traffic can share dashboards.
+type HTTPMetrics struct {
+	labels               []string
+	httpHandledCounter   *prom.CounterVec
+	httpHandledHistogram *prom.HistogramVec
+
+	extractorMu    sync.RWMutex
+	labelExtractor LabelExtractor
+}
+
+// NewHTTPMetrics returns a HTTPMetrics which exposes the http handler metrics for prometheus.
+// The labelExtractor should be the same one used for the ServerMetrics.
+func NewHTTPMetrics(labelExtractor LabelExtractor) *HTTPMetrics {
+	labels := append([]string{"http_route", "http_method", "http_status"}, labelExtractor.LabelNames()...)
+	return &HTTPMetrics{
+		labels:         labels,
+		labelExtractor: labelExtractor,
+		httpHandledCounter: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "http_server_handled_total",
+				Help: "Total number of HTTP requests completed on the server, regardless of success or failure.",
+			}, labels,
+		),
+		httpHandledHistogram: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "http_server_handling_seconds",
+				Help:    "Histogram of response latency (seconds) of HTTP requests that had been application-level handled by the server.",
+				Buckets: prom.DefBuckets,
+			}, labels,
+		),
+	}
+}
+
+// SetLabelExtractor replaces the LabelExtractor of the HTTPMetrics. It returns an error if the new
+// extractor doesn't declare the same label names as the current one.
+func (m *HTTPMetrics) SetLabelExtractor(labelExtractor LabelExtractor) error {
+	m.extractorMu.Lock()
+	defer m.extractorMu.Unlock()
+
+	if err := checkLabelNames(m.labelExtractor, labelExtractor); err != nil {
+		return err
+	}
+	m.labelExtractor = labelExtractor
+	return nil
+}
+
+// extractor returns the current LabelExtractor of the HTTPMetrics.
+func (m *HTTPMetrics) extractor() LabelExtractor {
+	m.extractorMu.RLock()
+	defer m.extractorMu.RUnlock()
+
+	return m.labelExtractor
+}
+
+func (m *HTTPMetrics) Describe(ch chan<- *prom.Desc) {
+	m.httpHandledCounter.Describe(ch)
+	m.httpHandledHistogram.Describe(ch)
+}
+
+func (m *HTTPMetrics) Collect(ch chan<- prom.Metric) {
+	m.httpHandledCounter.Collect(ch)
+	m.httpHandledHistogram.Collect(ch)
+}
+
+// unmatchedRoute is the http_route of the requests which no handler claimed, so unknown paths
+// don't create one series each.
+const unmatchedRoute = "unmatched"
+
+type httpRouteKey struct{}
+
+// httpRoute holds the route of a request. The middleware puts it in the request context before
+// calling the handler, and the handler fills it once it knows which route matched.
+type httpRoute struct {
+	route string
+}
+
+// SetHTTPRoute sets the http_route label of the request handled with the given context. The
+// route must be the pattern (e.g. /v1/hello/{name}) and not the actual path, to keep the label
+// cardinality bounded.
+func SetHTTPRoute(ctx context.Context, route string) {
+	if r, ok := ctx.Value(httpRouteKey{}).(*httpRoute); ok {
+		r.route = route
+	}
+}
+
+// statusRecorder captures the status code written by the wrapped handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// otherHTTPMethod labels the requests with a non-standard method.
+const otherHTTPMethod = "other"
+
+// standardHTTPMethods are the methods of RFC 9110 and PATCH, which label the requests as is.
+var standardHTTPMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodConnect: true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+}
+
+// httpMethod returns the label value of the request method, which the client chooses freely.
+func httpMethod(method string) string {
+	if standardHTTPMethods[method] {
+		return method
+	}
+	return otherHTTPMethod
+}
+
+// Middleware is a http.Handler wrapper that provides Prometheus monitoring for HTTP requests. The
+// wrapped handler must call SetHTTPRoute, otherwise the requests are labeled as unmatched. Use
+// Handler or InstrumentMux for handlers which don't know their route.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+		route := &httpRoute{route: unmatchedRoute}
+		ctx := context.WithValue(r.Context(), httpRouteKey{}, route)
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		labels := map[string]string{
+			"http_route":  route.route,
+			"http_method": httpMethod(r.Method),
+			"http_status": strconv.Itoa(recorder.status),
+		}
+		populateCustomLabels(labels, m.labels, m.extractor(), ctx)
+
+		var orderedLabels []string
+		for _, labelName := range m.labels {
+			orderedLabels = append(orderedLabels, labels[labelName])
+		}
+
+		m.httpHandledCounter.WithLabelValues(orderedLabels...).Inc()
+		m.httpHandledHistogram.WithLabelValues(orderedLabels...).Observe(time.Since(startTime).Seconds())
+	})
+}
+
+// Handler wraps next with the Middleware, labeling all its requests with the given route. It is
+// meant for the non-RPC endpoints living in the same binary, like health checks.
+func (m *HTTPMetrics) Handler(route string, next http.Handler) http.Handler {
+	return m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetHTTPRoute(r.Context(), route)
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// InstrumentMux wraps the mux with the Middleware, labeling every request with the pattern of
+// the mux handler it is routed to.
+func (m *HTTPMetrics) InstrumentMux(mux *http.ServeMux) http.Handler {
+	return m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			SetHTTPRoute(r.Context(), pattern)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,91 @@
+package grpcprom_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+const httpHandledHeader = `
+# HELP http_server_handled_total Total number of HTTP requests completed on the server, regardless of success or failure.
+# TYPE http_server_handled_total counter
+`
+
+func TestHTTPMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/hello/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		handler func(m *grpcprom.HTTPMetrics) http.Handler
+		method  string
+		path    string
+		want    string
+	}{
+		{
+			name: "route set by the handler",
+			handler: func(m *grpcprom.HTTPMetrics) http.Handler {
+				return m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					grpcprom.SetHTTPRoute(r.Context(), "/v1/hello/{name}")
+				}))
+			},
+			method: http.MethodGet,
+			path:   "/v1/hello/bob",
+			want:   `http_server_handled_total{http_method="GET",http_route="/v1/hello/{name}",http_status="200",qos="interactive"} 1`,
+		},
+		{
+			name: "unmatched route",
+			handler: func(m *grpcprom.HTTPMetrics) http.Handler {
+				return m.Middleware(http.NotFoundHandler())
+			},
+			method: http.MethodGet,
+			path:   "/nope",
+			want:   `http_server_handled_total{http_method="GET",http_route="unmatched",http_status="404",qos="interactive"} 1`,
+		},
+		{
+			name: "fixed route",
+			handler: func(m *grpcprom.HTTPMetrics) http.Handler {
+				return m.Handler("/healthz", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}))
+			},
+			method: http.MethodGet,
+			path:   "/healthz",
+			want:   `http_server_handled_total{http_method="GET",http_route="/healthz",http_status="503",qos="interactive"} 1`,
+		},
+		{
+			name: "mux pattern",
+			handler: func(m *grpcprom.HTTPMetrics) http.Handler {
+				return m.InstrumentMux(mux)
+			},
+			method: http.MethodPost,
+			path:   "/v1/hello/alice",
+			want:   `http_server_handled_total{http_method="POST",http_route="/v1/hello/",http_status="405",qos="interactive"} 1`,
+		},
+		{
+			name: "non-standard method",
+			handler: func(m *grpcprom.HTTPMetrics) http.Handler {
+				return m.InstrumentMux(mux)
+			},
+			method: "PROPFIND",
+			path:   "/v1/hello/alice",
+			want:   `http_server_handled_total{http_method="other",http_route="/v1/hello/",http_status="405",qos="interactive"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewHTTPMetrics(grpcprom.NewQoSLabelExtractor())
+			reg := newRegistry(t, m)
+
+			tt.handler(m).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.path, nil))
+
+			assertMetrics(t, reg, httpHandledHeader+tt.want+"\n", "http_server_handled_total")
+		})
+	}
+}
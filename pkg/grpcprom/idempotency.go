@@ -0,0 +1,247 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcstatus"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// maxIdempotencyEntries bounds the number of responses in the idempotency cache. Once it is full,
+// the RPCs with a new key are handled without caching them, like the RPCs without key.
+const maxIdempotencyEntries = 16384
+
+// IdempotencyScope returns the scope of the idempotency keys of an RPC, like the identity of the
+// client or its tenant, so the keys of different clients never collide.
+type IdempotencyScope func(ctx context.Context) string
+
+// PeerIdempotencyScope scopes the idempotency keys by the identity of the client: the subject of
+// its TLS certificate, or its IP address without TLS.
+func PeerIdempotencyScope(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+		return info.State.PeerCertificates[0].Subject.String()
+	}
+	if p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
+
+// MetadataIdempotencyScope returns the IdempotencyScope scoping the idempotency keys by the value
+// of the metadata key, e.g. the tenant set by an authenticating proxy.
+func MetadataIdempotencyScope(key string) IdempotencyScope {
+	return func(ctx context.Context) string {
+		if values := metadata.ValueFromIncomingContext(ctx, key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+}
+
+// idempotencyCache caches the responses of the RPCs by the idempotency key sent by the clients.
+type idempotencyCache struct {
+	key   string
+	ttl   time.Duration
+	scope IdempotencyScope
+
+	mu        sync.Mutex
+	entries   map[string]*idempotencyEntry
+	nextSweep time.Time
+
+	hits   *prom.CounterVec
+	misses *prom.CounterVec
+}
+
+// idempotencyEntry is the response of an RPC, available once done is closed.
+type idempotencyEntry struct {
+	done    chan struct{}
+	resp    interface{}
+	err     error
+	expires time.Time
+}
+
+// WithIdempotencyCache makes the gRPC unary interceptor short-circuit the duplicate RPCs, which
+// have the same value of the metadata key as an RPC of the same method and scope handled less
+// than ttl ago: they get the response of the first one, or wait for it while it is being handled.
+// The duplicates are counted in grpc_server_idempotency_hits_total instead of the RPC metrics, and
+// the RPCs with a key handled for the first time in grpc_server_idempotency_misses_total, both
+// with the RPC labels, so the retries don't inflate the handled counts. The failed RPCs are not
+// cached, so they can be retried, and the duplicates of a panicking RPC fail with Aborted.
+//
+// The keys must be unique within a scope, usually the client identity with PeerIdempotencyScope:
+// a client reusing a key gets the response of another RPC. A nil scope is PeerIdempotencyScope.
+// At most maxIdempotencyEntries responses are cached; beyond that the new keys are not cached.
+func WithIdempotencyCache(metadataKey string, ttl time.Duration, scope IdempotencyScope) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		if scope == nil {
+			scope = PeerIdempotencyScope
+		}
+		m.idempotency = &idempotencyCache{
+			key:     metadataKey,
+			ttl:     ttl,
+			scope:   scope,
+			entries: map[string]*idempotencyEntry{},
+		}
+	}
+}
+
+// newIdempotencyCounters creates the counters of the WithIdempotencyCache cache.
+func (m *ServerMetrics) newIdempotencyCounters() {
+	if m.idempotency == nil {
+		return
+	}
+
+	m.idempotency.hits = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "grpc_server_idempotency_hits_total",
+			Help: "Total number of duplicate RPCs answered from the idempotency cache.",
+		}, m.labels,
+	)
+	m.idempotency.misses = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "grpc_server_idempotency_misses_total",
+			Help: "Total number of RPCs with an idempotency key handled for the first time.",
+		}, m.labels,
+	)
+}
+
+// lookup returns the entry of the RPC handled with the context, and whether it is a duplicate.
+// New entries are stored and must be completed with complete. It returns a nil entry when the
+// RPC has no idempotency key, or when the cache is full.
+func (c *idempotencyCache) lookup(ctx context.Context, fullMethod string) (string, *idempotencyEntry, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, c.key)
+	if len(values) == 0 || values[0] == "" {
+		return "", nil, false
+	}
+	key := fmt.Sprintf("%s\x00%s\x00%s", c.scope(ctx), fullMethod, values[0])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.After(c.nextSweep) {
+		c.sweep(now)
+	}
+	if entry, ok := c.entries[key]; ok && (entry.expires.IsZero() || now.Before(entry.expires)) {
+		return key, entry, true
+	}
+	if len(c.entries) >= maxIdempotencyEntries {
+		return "", nil, false
+	}
+	entry := &idempotencyEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	return key, entry, false
+}
+
+// complete stores the response of the entry, or removes it if the RPC failed.
+func (c *idempotencyCache) complete(key string, entry *idempotencyEntry, resp interface{}, err error) {
+	c.mu.Lock()
+	entry.resp, entry.err = resp, err
+	entry.expires = time.Now().Add(c.ttl)
+	if err != nil {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(entry.done)
+}
+
+// sweep removes the expired entries, at most once per ttl.
+func (c *idempotencyCache) sweep(now time.Time) {
+	for key, entry := range c.entries {
+		if !entry.expires.IsZero() && !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.nextSweep = now.Add(c.ttl)
+}
+
+// wait returns the response of the entry once it is done, or the context error.
+func (e *idempotencyEntry) wait(ctx context.Context) (interface{}, error) {
+	select {
+	case <-e.done:
+		return e.resp, e.err
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+}
+
+// idempotentRPC is the cache entry of an RPC with an idempotency key handled for the first time.
+type idempotentRPC struct {
+	key       string
+	entry     *idempotencyEntry
+	completed bool
+}
+
+// errIdempotentRPCAborted is the error of the duplicates of an RPC which never completed, because
+// its handler panicked.
+var errIdempotentRPCAborted = status.Error(codes.Aborted, "the RPC with the same idempotency key did not complete")
+
+// duplicate returns the cache entry of the RPC if it is a duplicate. Otherwise the RPC is
+// attached to the reporter when it has an idempotency key, for completeIdempotent.
+func (m *ServerMetrics) duplicate(ctx context.Context, fullMethod string, r *serverReporter) *idempotencyEntry {
+	if m.idempotency == nil {
+		return nil
+	}
+
+	key, entry, duplicate := m.idempotency.lookup(ctx, fullMethod)
+	if duplicate {
+		return entry
+	}
+	if entry != nil {
+		r.idempotent = &idempotentRPC{key: key, entry: entry}
+	}
+	return nil
+}
+
+// completeIdempotent stores the response of the RPC attached to the reporter by duplicate.
+func (m *ServerMetrics) completeIdempotent(r *serverReporter, resp interface{}, err error) {
+	if r.idempotent == nil || r.idempotent.completed {
+		return
+	}
+	r.idempotent.completed = true
+	m.idempotency.complete(r.idempotent.key, r.idempotent.entry, resp, err)
+}
+
+// abortIdempotent completes the RPC attached to the reporter by duplicate with an error if it
+// wasn't completed, e.g. because its handler panicked, so its duplicates don't wait forever and
+// the key can be retried. It must be deferred.
+func (m *ServerMetrics) abortIdempotent(r *serverReporter) {
+	m.completeIdempotent(r, nil, errIdempotentRPCAborted)
+}
+
+// countDuplicate counts a duplicate RPC answered from the cache, with the labels of its response.
+func (m *ServerMetrics) countDuplicate(r *serverReporter, err error) {
+	st, _ := grpcstatus.FromError(err)
+	r.labels["grpc_status"] = st.Code().String()
+	if m.errorType {
+		r.labels["error_type"] = grpcstatus.ErrorType(err)
+	}
+	m.mergeErrorLabels(r.labels, err)
+
+	labels, _ := r.declaredLabels()
+	m.idempotency.hits.With(labels).Inc()
+}
+
+// countIdempotencyMiss counts an RPC with an idempotency key handled for the first time.
+func (m *ServerMetrics) countIdempotencyMiss(labels map[string]string, idempotent *idempotentRPC) {
+	if idempotent == nil {
+		return
+	}
+	m.idempotency.misses.With(labels).Inc()
+}
@@ -0,0 +1,118 @@
+package grpcprom
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// idempotentContext returns the context of an RPC from the peer with the idempotency key.
+func idempotentContext(peerAddr, key string) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("idempotency-key", key))
+	addr, _ := net.ResolveTCPAddr("tcp", peerAddr)
+	return peer.NewContext(ctx, &peer.Peer{Addr: addr})
+}
+
+func TestIdempotencyCacheScope(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope IdempotencyScope
+		peers []string
+		want  int64
+	}{
+		{name: "same peer", peers: []string{"10.0.0.1:1000", "10.0.0.1:2000"}, want: 1},
+		{name: "different peers", peers: []string{"10.0.0.1:1000", "10.0.0.2:1000"}, want: 2},
+		{
+			name:  "unscoped",
+			scope: func(context.Context) string { return "" },
+			peers: []string{"10.0.0.1:1000", "10.0.0.2:1000"},
+			want:  1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewServerMetrics(&DefaultLabelExtractor{}, WithIdempotencyCache("idempotency-key", time.Minute, tt.scope))
+			var handled atomic.Int64
+			handler := func(context.Context, interface{}) (interface{}, error) {
+				handled.Add(1)
+				return "response", nil
+			}
+
+			for _, peerAddr := range tt.peers {
+				ctx := idempotentContext(peerAddr, "key-1")
+				resp, err := m.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/shop.v1.Shop/Buy"}, handler)
+				if resp != "response" || err != nil {
+					t.Fatalf("got %v, %v, want the response", resp, err)
+				}
+			}
+			if got := handled.Load(); got != tt.want {
+				t.Errorf("handled %d RPCs, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdempotencyCachePanic(t *testing.T) {
+	m := NewServerMetrics(&DefaultLabelExtractor{}, WithIdempotencyCache("idempotency-key", time.Minute, nil))
+	interceptor := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/shop.v1.Shop/Buy"}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		_, _ = interceptor(idempotentContext("10.0.0.1:1000", "key-1"), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			close(started)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-started
+
+	// The duplicates wait for the first RPC, which panics.
+	_, entry, duplicate := m.idempotency.lookup(idempotentContext("10.0.0.1:1000", "key-1"), info.FullMethod)
+	if !duplicate {
+		t.Fatal("RPC with the key of the running one is not a duplicate")
+	}
+	close(release)
+	if r := <-panicked; r != "boom" {
+		t.Fatalf("recovered %v, want the panic of the handler", r)
+	}
+	if _, err := entry.wait(context.Background()); status.Code(err) != codes.Aborted {
+		t.Fatalf("duplicate of the panicking RPC got %v, want Aborted", err)
+	}
+
+	// The key can be retried.
+	resp, err := interceptor(idempotentContext("10.0.0.1:1000", "key-1"), nil, info, func(context.Context, interface{}) (interface{}, error) {
+		return "response", nil
+	})
+	if resp != "response" || err != nil {
+		t.Fatalf("retry got %v, %v, want the response", resp, err)
+	}
+}
+
+func TestIdempotencyCacheLimit(t *testing.T) {
+	m := NewServerMetrics(&DefaultLabelExtractor{}, WithIdempotencyCache("idempotency-key", time.Minute, nil))
+	for i := 0; i < maxIdempotencyEntries; i++ {
+		_, entry, duplicate := m.idempotency.lookup(idempotentContext("10.0.0.1:1000", strconv.Itoa(i)), "/shop.v1.Shop/Buy")
+		if entry == nil || duplicate {
+			t.Fatalf("key %d not cached", i)
+		}
+	}
+
+	if _, entry, _ := m.idempotency.lookup(idempotentContext("10.0.0.1:1000", "one-more"), "/shop.v1.Shop/Buy"); entry != nil {
+		t.Errorf("new key cached in a full cache")
+	}
+	if _, entry, duplicate := m.idempotency.lookup(idempotentContext("10.0.0.1:1000", "0"), "/shop.v1.Shop/Buy"); entry == nil || !duplicate {
+		t.Errorf("cached key not found in a full cache")
+	}
+}
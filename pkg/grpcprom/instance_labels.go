@@ -0,0 +1,62 @@
+package grpcprom
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// InstanceLabelSource tells where the value of an instance label is read from: an environment
+// variable or a file, like the ones mounted by the Kubernetes downward API. The environment
+// variable takes precedence when both are set.
+type InstanceLabelSource struct {
+	Env  string
+	File string
+}
+
+// DefaultInstanceLabels are the instance labels read from the environment variables usually
+// set from the downward API of the pods.
+var DefaultInstanceLabels = map[string]InstanceLabelSource{
+	"pod":       {Env: "POD_NAME"},
+	"namespace": {Env: "POD_NAMESPACE"},
+	"zone":      {Env: "ZONE"},
+	"version":   {Env: "VERSION"},
+}
+
+// InstanceLabels reads the values of the instance labels from their sources. Labels without
+// value, because the variable is not set or the file does not exist, are left out.
+func InstanceLabels(sources map[string]InstanceLabelSource) (prom.Labels, error) {
+	labels := prom.Labels{}
+	for name, source := range sources {
+		value := os.Getenv(source.Env)
+		if value == "" && source.File != "" {
+			b, err := os.ReadFile(source.File)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("reading the %s label: %w", name, err)
+			}
+			value = strings.TrimSpace(string(b))
+		}
+
+		if value != "" {
+			labels[name] = value
+		}
+	}
+	return labels, nil
+}
+
+// WrapRegistererWithInstanceLabels returns a Registerer adding the instance labels as const
+// labels of every metric registered with it, so the metrics can be broken down per pod or zone
+// without any custom collector.
+func WrapRegistererWithInstanceLabels(reg prom.Registerer, sources map[string]InstanceLabelSource) (prom.Registerer, error) {
+	labels, err := InstanceLabels(sources)
+	if err != nil {
+		return nil, err
+	}
+	return prom.WrapRegistererWith(labels, reg), nil
+}
@@ -0,0 +1,81 @@
+package grpcprom
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+// metricsInterceptorName is the function name of the gRPC unary interceptor of the ServerMetrics.
+const metricsInterceptorName = "grpcprom.(*ServerMetrics).unaryServerInterceptor."
+
+// InterceptorInfo describes an interceptor of a chain built with UnaryServerChain.
+type InterceptorInfo struct {
+	// Position is the position of the interceptor in the chain, 0 being the outermost.
+	Position int
+	// Name is the function name of the interceptor.
+	Name string
+	// Metrics tells if it is the interceptor of a ServerMetrics.
+	Metrics bool
+}
+
+// UnaryServerChain returns the server option chaining the unary interceptors like
+// grpc.ChainUnaryInterceptor, the first one being the outermost, and keeps their positions,
+// returned by InterceptorChain. The chain must include the UnaryServerInterceptor of the
+// ServerMetrics. The mis-orderings silently losing observations are logged with logger, when
+// it isn't nil: the recovery interceptors running outside of the metrics one, which then never
+// sees the panics, and the auth ones, whose rejected RPCs it never sees.
+func (m *ServerMetrics) UnaryServerChain(logger Logger, interceptors ...grpc.UnaryServerInterceptor) grpc.ServerOption {
+	chain := make([]InterceptorInfo, len(interceptors))
+	metrics := -1
+	for i, interceptor := range interceptors {
+		name := runtime.FuncForPC(reflect.ValueOf(interceptor).Pointer()).Name()
+		chain[i] = InterceptorInfo{
+			Position: i,
+			Name:     name,
+			Metrics:  strings.Contains(name, metricsInterceptorName),
+		}
+		if chain[i].Metrics && metrics < 0 {
+			metrics = i
+		}
+	}
+
+	m.chainMu.Lock()
+	m.interceptorChain = chain
+	m.chainMu.Unlock()
+
+	if logger != nil {
+		checkInterceptorOrder(logger, chain, metrics)
+	}
+	return grpc.ChainUnaryInterceptor(interceptors...)
+}
+
+// InterceptorChain returns the interceptors of the chain built with UnaryServerChain, from the
+// outermost.
+func (m *ServerMetrics) InterceptorChain() []InterceptorInfo {
+	m.chainMu.Lock()
+	defer m.chainMu.Unlock()
+
+	return append([]InterceptorInfo(nil), m.interceptorChain...)
+}
+
+// checkInterceptorOrder logs the recovery and auth interceptors running outside of the metrics
+// one, at position metrics.
+func checkInterceptorOrder(logger Logger, chain []InterceptorInfo, metrics int) {
+	if metrics < 0 {
+		logger.Printf("the interceptor chain has no grpcprom metrics interceptor")
+		return
+	}
+
+	for _, info := range chain[:metrics] {
+		name := strings.ToLower(info.Name)
+		switch {
+		case strings.Contains(name, "recover"):
+			logger.Printf("the recovery interceptor %s runs outside of the metrics interceptor, which won't observe the panics", info.Name)
+		case strings.Contains(name, "auth"):
+			logger.Printf("the auth interceptor %s runs outside of the metrics interceptor, which won't observe the auth failures", info.Name)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+// Package kitsink records the grpcprom metrics with go-kit metrics, so teams standardized on
+// go-kit instrumentation can use the interceptors without the Prometheus client.
+package kitsink
+
+import (
+	"sort"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+// Sink is a grpcprom.MetricsSink recording the handled RPCs with go-kit metrics, for teams
+// standardized on go-kit instrumentation. The counter and histogram are given the labels as
+// alternating name and value pairs, sorted by label name.
+type Sink struct {
+	counter   metrics.Counter
+	histogram metrics.Histogram
+}
+
+// New returns a Sink counting the handled RPCs with counter and observing their
+// handling time, in seconds, with histogram.
+func New(counter metrics.Counter, histogram metrics.Histogram) *Sink {
+	return &Sink{
+		counter:   counter,
+		histogram: histogram,
+	}
+}
+
+func labelValues(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lvs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		lvs = append(lvs, name, labels[name])
+	}
+	return lvs
+}
+
+func (s *Sink) Inc(labels map[string]string) {
+	s.counter.With(labelValues(labels)...).Add(1)
+}
+
+func (s *Sink) Observe(labels map[string]string, v float64) {
+	s.histogram.With(labelValues(labels)...).Observe(v)
+}
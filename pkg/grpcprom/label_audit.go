@@ -0,0 +1,160 @@
+package grpcprom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LabelDecision tells how a label of an RPC got its value.
+type LabelDecision struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Source is the type of the LabelExtractor which produced the label, empty when defaulted.
+	Source string `json:"source,omitempty"`
+	// Defaulted is set when no extractor returned the label.
+	Defaulted bool `json:"defaulted,omitempty"`
+	// Redacted is set when a redaction rule changed the value.
+	Redacted bool `json:"redacted,omitempty"`
+	// Dropped is set when the label is not declared, so it is not recorded.
+	Dropped bool `json:"dropped,omitempty"`
+}
+
+// LabelAuditEntry holds the label decisions of one RPC.
+type LabelAuditEntry struct {
+	Time       time.Time       `json:"time"`
+	FullMethod string          `json:"full_method"`
+	Labels     []LabelDecision `json:"labels"`
+}
+
+// LabelAudit keeps the label decisions of the last RPCs in a ring buffer, to debug dashboards
+// showing unexpected "default" values. It is an http.Handler serving the entries as JSON, meant
+// for an admin endpoint.
+type LabelAudit struct {
+	logger Logger
+
+	mu      sync.Mutex
+	entries []LabelAuditEntry
+	next    int
+	full    bool
+}
+
+// NewLabelAudit returns a LabelAudit keeping the last size entries. When logger is not nil every
+// entry is logged too.
+func NewLabelAudit(size int, logger Logger) *LabelAudit {
+	return &LabelAudit{
+		logger:  logger,
+		entries: make([]LabelAuditEntry, size),
+	}
+}
+
+// WithLabelAudit makes the ServerMetrics record the label decisions of every RPC in audit. The
+// labels are extracted differently to find their source, so it is meant for debugging only, but
+// they get the same values, from the same cached base labels and schema, as without the audit.
+// The changes of the WithRelabeler hook are not audited.
+func WithLabelAudit(audit *LabelAudit) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.audit = audit
+	}
+}
+
+// Entries returns the recorded entries, oldest first.
+func (a *LabelAudit) Entries() []LabelAuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.full {
+		return append([]LabelAuditEntry(nil), a.entries[:a.next]...)
+	}
+	return append(append([]LabelAuditEntry(nil), a.entries[a.next:]...), a.entries[:a.next]...)
+}
+
+// ServeHTTP writes the recorded entries as JSON.
+func (a *LabelAudit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.Entries()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *LabelAudit) record(entry LabelAuditEntry) {
+	if a.logger != nil {
+		a.logger.Printf("labels of %s: %+v", entry.FullMethod, entry.Labels)
+	}
+	if len(a.entries) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.entries[a.next] = entry
+	a.next++
+	if a.next == len(a.entries) {
+		a.next, a.full = 0, true
+	}
+}
+
+// extractWithSources returns the labels of the extractor and the type of the extractor which
+// produced each of them, looking into the chained extractors.
+func extractWithSources(labelExtractor LabelExtractor, ctx context.Context) (map[string]string, map[string]string) {
+	labels, sources := map[string]string{}, map[string]string{}
+
+	if c, ok := labelExtractor.(*chainedLabelExtractor); ok {
+		for _, e := range c.extractors {
+			l, s := extractWithSources(e, ctx)
+			for k, v := range l {
+				labels[k], sources[k] = v, s[k]
+			}
+		}
+		return labels, sources
+	}
+
+	source := fmt.Sprintf("%T", labelExtractor)
+	for k, v := range labelExtractor.Labels(ctx) {
+		labels[k], sources[k] = v, source
+	}
+	return labels, sources
+}
+
+// auditLabels records the decisions taken for the labels of an RPC in the audit: the labels the
+// extractors didn't return, or the schema didn't allow, took their default value, and the labels
+// whose value changed from unredacted were redacted. The labels stashed in the context are merged
+// afterwards, so they are not audited.
+func (m *ServerMetrics) auditLabels(fullMethod string, labels, unredacted, extracted, sources map[string]string, conformed []string) {
+	declared := map[string]bool{}
+	for _, labelName := range m.labels {
+		declared[labelName] = true
+	}
+	defaulted := map[string]bool{}
+	for _, labelName := range conformed {
+		defaulted[labelName] = true
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entry := LabelAuditEntry{Time: time.Now(), FullMethod: fullMethod}
+	for _, name := range names {
+		if name == "grpc_service" || name == "grpc_method" || name == "grpc_status" {
+			continue
+		}
+		_, ok := extracted[name]
+		entry.Labels = append(entry.Labels, LabelDecision{
+			Name:      name,
+			Value:     labels[name],
+			Source:    sources[name],
+			Defaulted: !ok || defaulted[name],
+			Redacted:  labels[name] != unredacted[name],
+			Dropped:   !declared[name],
+		})
+	}
+	m.audit.record(entry)
+}
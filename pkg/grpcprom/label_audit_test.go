@@ -0,0 +1,66 @@
+package grpcprom_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+// tierExtractor declares the tier and region labels and only returns the tier, which the schema
+// doesn't allow.
+type tierExtractor struct{}
+
+func (tierExtractor) LabelNames() []string {
+	return []string{"tier", "region"}
+}
+
+func (tierExtractor) Labels(context.Context) map[string]string {
+	return map[string]string{"tier": "gold"}
+}
+
+func TestLabelAuditSameLabels(t *testing.T) {
+	schema := grpcprom.MustNewLabelSchema(
+		grpcprom.LabelDefinition{Name: "tier", Values: []string{"free", "paid"}, Default: "free"},
+		grpcprom.LabelDefinition{Name: "region", Default: "global"},
+	)
+	newServerMetrics := func(opts ...grpcprom.ServerMetricsOption) *grpcprom.ServerMetrics {
+		return grpcprom.NewServerMetrics(tierExtractor{}, append([]grpcprom.ServerMetricsOption{
+			grpcprom.WithLabelSchema(schema),
+			grpcprom.WithContextLabels("tenant"),
+			grpcprom.WithMethodRewrites(grpcprom.MethodRewrite{Pattern: regexp.MustCompile(`[0-9]+$`), Replacement: ""}),
+		}, opts...)...)
+	}
+
+	want := handledHeader + `
+grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK",region="global",tenant="acme",tier="free"} 1
+`
+	audit := grpcprom.NewLabelAudit(1, nil)
+	for name, m := range map[string]*grpcprom.ServerMetrics{
+		"without audit": newServerMetrics(),
+		"with audit":    newServerMetrics(grpcprom.WithLabelAudit(audit)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			reg := newRegistry(t, m)
+			ctx := grpcprom.ContextWithLabels(context.Background(), map[string]string{"tenant": "acme"})
+			callUnary(m, ctx, nil, "/demo.v1.Greeter/SayHello7", nil)
+			assertMetrics(t, reg, want, "grpc_server_handled_total")
+		})
+	}
+
+	entries := audit.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("%d audit entries, want 1", len(entries))
+	}
+	decisions := map[string]grpcprom.LabelDecision{}
+	for _, decision := range entries[0].Labels {
+		decisions[decision.Name] = decision
+	}
+	if d := decisions["tier"]; d.Value != "free" || !d.Defaulted || d.Source == "" {
+		t.Errorf("tier decision %+v, want defaulted by the schema", d)
+	}
+	if d := decisions["region"]; d.Value != "global" || !d.Defaulted || d.Source != "" {
+		t.Errorf("region decision %+v, want the default value of the schema", d)
+	}
+}
@@ -0,0 +1,51 @@
+package grpcprom
+
+import (
+	"context"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// EchoLabelsKey is the metadata key asking the server to echo the labels of the call, with
+	// any value, when the method is in the WithLabelEcho allowlist.
+	EchoLabelsKey = "x-grpcprom-echo-labels"
+	// EchoedLabelsKey is the trailer key of the echoed labels, one name=value per value.
+	EchoedLabelsKey = "x-grpcprom-labels"
+)
+
+// WithLabelEcho is a debug option making the server attach the labels each call was recorded
+// with as EchoedLabelsKey trailers, so the engineers of the clients can check the labels their
+// calls produce without access to the server logs. Only the calls of the listed full methods
+// (/package.Service/Method) carrying the EchoLabelsKey metadata get them.
+func WithLabelEcho(fullMethods ...string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		if m.labelEcho == nil {
+			m.labelEcho = map[string]bool{}
+		}
+		for _, fullMethod := range fullMethods {
+			m.labelEcho[fullMethod] = true
+		}
+	}
+}
+
+// echoLabels reports if the labels of the call must be echoed.
+func (m *ServerMetrics) echoLabels(ctx context.Context, fullMethod string) bool {
+	if !m.labelEcho[fullMethod] {
+		return false
+	}
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get(EchoLabelsKey)) > 0
+}
+
+// setEchoedLabels sets the labels as trailers of the call, sorted by name.
+func setEchoedLabels(ctx context.Context, labels map[string]string) {
+	pairs := make([]string, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	_ = grpc.SetTrailer(ctx, metadata.MD{EchoedLabelsKey: pairs})
+}
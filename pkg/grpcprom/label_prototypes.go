@@ -0,0 +1,75 @@
+package grpcprom
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxLabelPrototypes bounds the number of full methods whose base labels are cached, so the
+// cache can't grow without bound when the method names come from the clients.
+const maxLabelPrototypes = 4096
+
+// labelPrototypes caches the base label values of every full method, in the order of the labels
+// of the ServerMetrics: the grpc_service and grpc_method labels, after the allowlist and the
+// rewrites, and the default value of every other label. They are computed at the first RPC of the
+// method and copied for the next ones, so only the labels returned by the LabelExtractor are
+// written in the hot path.
+type labelPrototypes struct {
+	byMethod sync.Map
+	size     atomic.Int64
+}
+
+// baseLabels returns the base labels of the full method, with room for the labels of the
+// extractor.
+func (m *ServerMetrics) baseLabels(fullMethod string) map[string]string {
+	prototype := m.labelPrototype(fullMethod)
+	labels := make(map[string]string, len(m.labels))
+	for i, labelName := range m.labels {
+		labels[labelName] = prototype[i]
+	}
+	return labels
+}
+
+// labelPrototype returns the cached base label values of the full method, which must not be
+// modified.
+func (m *ServerMetrics) labelPrototype(fullMethod string) []string {
+	if prototype, ok := m.prototypes.byMethod.Load(fullMethod); ok {
+		return prototype.([]string)
+	}
+
+	prototype := m.newLabelPrototype(fullMethod)
+	if m.prototypes.size.Load() < maxLabelPrototypes {
+		if cached, loaded := m.prototypes.byMethod.LoadOrStore(fullMethod, prototype); loaded {
+			return cached.([]string)
+		}
+		m.prototypes.size.Add(1)
+	}
+	return prototype
+}
+
+// newLabelPrototype computes the base label values of the full method.
+func (m *ServerMetrics) newLabelPrototype(fullMethod string) []string {
+	service, method := m.methodLabels(fullMethod)
+	prototype := make([]string, len(m.labels))
+	for i, labelName := range m.labels {
+		switch labelName {
+		case "grpc_service":
+			prototype[i] = service
+		case "grpc_method":
+			prototype[i] = method
+		default:
+			prototype[i] = m.labelSchema.defaultValue(labelName)
+		}
+	}
+	return prototype
+}
+
+// labelValues returns the values of the labels of the ServerMetrics, in their order, as the
+// prometheus vectors take them.
+func (m *ServerMetrics) labelValues(labels map[string]string) []string {
+	values := make([]string, len(m.labels))
+	for i, labelName := range m.labels {
+		values[i] = labels[labelName]
+	}
+	return values
+}
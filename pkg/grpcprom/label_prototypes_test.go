@@ -0,0 +1,147 @@
+package grpcprom
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// benchExtractor declares the custom labels and returns the value of the first one only, so the
+// others take the default value like in most servers.
+type benchExtractor struct {
+	names []string
+}
+
+func (e *benchExtractor) LabelNames() []string {
+	return e.names
+}
+
+func (e *benchExtractor) Labels(context.Context) map[string]string {
+	if len(e.names) == 0 {
+		return map[string]string{}
+	}
+	return map[string]string{e.names[0]: "value"}
+}
+
+func newBenchExtractor(labels int) *benchExtractor {
+	extractor := &benchExtractor{}
+	for i := 0; i < labels; i++ {
+		extractor.names = append(extractor.names, "label_"+strconv.Itoa(i))
+	}
+	return extractor
+}
+
+func benchFullMethods(methods int) []string {
+	fullMethods := make([]string, methods)
+	for i := range fullMethods {
+		fullMethods[i] = "/bench.v1.Service/Method" + strconv.Itoa(i)
+	}
+	return fullMethods
+}
+
+// BenchmarkUnaryServerInterceptor measures the hot path of every RPC: building its labels and
+// recording it in the default prometheus vectors.
+func BenchmarkUnaryServerInterceptor(b *testing.B) {
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	for _, labels := range []int{0, 4} {
+		b.Run(strconv.Itoa(labels)+"_labels", func(b *testing.B) {
+			interceptor := NewServerMetrics(newBenchExtractor(labels)).UnaryServerInterceptor()
+			fullMethods := benchFullMethods(20)
+			infos := make([]*grpc.UnaryServerInfo, len(fullMethods))
+			for i, fullMethod := range fullMethods {
+				infos[i] = &grpc.UnaryServerInfo{FullMethod: fullMethod}
+			}
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, _ = interceptor(ctx, nil, infos[i%len(infos)], handler)
+			}
+		})
+	}
+}
+
+// mapLabelPrototypes is the map-based approach the ordered prototypes replaced: a copy of a
+// cached labels map per RPC, ordered again by the sink for every recorded metric.
+type mapLabelPrototypes struct {
+	byMethod sync.Map
+}
+
+func (p *mapLabelPrototypes) labels(m *ServerMetrics, fullMethod string) map[string]string {
+	prototype, ok := p.byMethod.Load(fullMethod)
+	if !ok {
+		labels := make(map[string]string, len(m.labels))
+		for i, value := range m.newLabelPrototype(fullMethod) {
+			labels[m.labels[i]] = value
+		}
+		prototype, _ = p.byMethod.LoadOrStore(fullMethod, labels)
+	}
+
+	base := prototype.(map[string]string)
+	labels := make(map[string]string, len(base))
+	for name, value := range base {
+		labels[name] = value
+	}
+	return labels
+}
+
+// BenchmarkLabelPrototypes compares building the labels of an RPC and ordering them for the
+// handled counter and the handling time histogram with the map-based prototypes and the ordered
+// ones.
+func BenchmarkLabelPrototypes(b *testing.B) {
+	m := NewServerMetrics(newBenchExtractor(4))
+	sink := m.sink.(*prometheusSink)
+	fullMethods := benchFullMethods(20)
+	extracted := map[string]string{"label_0": "value"}
+
+	b.Run("map", func(b *testing.B) {
+		var prototypes mapLabelPrototypes
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			labels := prototypes.labels(m, fullMethods[i%len(fullMethods)])
+			for name, value := range extracted {
+				labels[name] = value
+			}
+			_ = sink.orderedLabels(labels)
+			_ = sink.orderedLabels(labels)
+		}
+	})
+	b.Run("ordered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			labels := m.baseLabels(fullMethods[i%len(fullMethods)])
+			for name, value := range extracted {
+				labels[name] = value
+			}
+			_ = m.labelValues(labels)
+		}
+	})
+}
+
+func TestLabelPrototypeOrder(t *testing.T) {
+	m := NewServerMetrics(newBenchExtractor(2), WithMethodRewrites(MethodRewrite{Pattern: regexp.MustCompile(`^/bench.v1.Service/Method[0-9]+$`), Replacement: "/bench.v1.Service/Method"}))
+
+	got := m.labelPrototype("/bench.v1.Service/Method7")
+	want := []string{"bench.v1.Service", "Method", "default", "default", "default"}
+	if len(got) != len(want) {
+		t.Fatalf("prototype %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("prototype %v, want %v for the labels %v", got, want, m.labels)
+		}
+	}
+
+	labels := m.baseLabels("/bench.v1.Service/Method7")
+	labels["label_1"] = "value"
+	if values := m.labelValues(labels); values[4] != "value" || m.labelPrototype("/bench.v1.Service/Method7")[4] != "default" {
+		t.Fatalf("label values %v, the writes must not reach the cached prototype", values)
+	}
+}
@@ -0,0 +1,246 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/prometheus/common/model"
+)
+
+// LabelDefinition declares a custom label of a LabelSchema.
+type LabelDefinition struct {
+	// Name is the label name.
+	Name string
+	// Values are the allowed values. Any value is allowed when it is empty, unless Pattern is set.
+	Values []string
+	// Pattern is a regular expression the values must fully match, e.g. "[a-z]+".
+	Pattern string
+	// Default is the value of the calls without the label or with a value not allowed. It is
+	// "default" when empty.
+	Default string
+}
+
+// LabelSchema declares the custom labels of the metrics, their allowed values and their default
+// values. It is shared by the LabelExtractors and the ServerMetrics, so a mismatch between the
+// labels the extractor declares and the ones the metrics expect fails at construction instead of
+// silently defaulting the labels, or attributing the values to the wrong ones.
+type LabelSchema struct {
+	definitions []LabelDefinition
+	allowed     []map[string]bool
+	patterns    []*regexp.Regexp
+}
+
+// reservedLabels are the labels set by the ServerMetrics itself, by its options or by the
+// QoSLabelExtractor, which the custom labels of a schema can't redefine.
+var reservedLabels = map[string]bool{
+	"grpc_service":  true,
+	"grpc_method":   true,
+	"grpc_status":   true,
+	"error_type":    true,
+	serverNameLabel: true,
+	warmupLabel:     true,
+	qosLabel:        true,
+	pidLabel:        true,
+}
+
+// NewLabelSchema returns the LabelSchema of the label definitions, in their order. It returns an
+// error if a name is invalid, reserved for the labels set by the ServerMetrics, like grpc_status,
+// error_type, server_name or qos, or declared twice, if a pattern doesn't compile, or if a
+// default value is not allowed.
+func NewLabelSchema(definitions ...LabelDefinition) (*LabelSchema, error) {
+	s := &LabelSchema{
+		definitions: make([]LabelDefinition, len(definitions)),
+		allowed:     make([]map[string]bool, len(definitions)),
+		patterns:    make([]*regexp.Regexp, len(definitions)),
+	}
+	seen := map[string]bool{}
+	for i, def := range definitions {
+		switch {
+		case !model.LabelName(def.Name).IsValid():
+			return nil, fmt.Errorf("invalid label name %q", def.Name)
+		case reservedLabels[def.Name]:
+			return nil, fmt.Errorf("label %q is reserved", def.Name)
+		case seen[def.Name]:
+			return nil, fmt.Errorf("label %q declared twice", def.Name)
+		}
+		seen[def.Name] = true
+
+		if def.Default == "" {
+			def.Default = "default"
+		}
+		if len(def.Values) > 0 {
+			s.allowed[i] = make(map[string]bool, len(def.Values))
+			for _, value := range def.Values {
+				s.allowed[i][value] = true
+			}
+		}
+		if def.Pattern != "" {
+			pattern, err := regexp.Compile("^(?:" + def.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("label %q: %w", def.Name, err)
+			}
+			s.patterns[i] = pattern
+		}
+		s.definitions[i] = def
+		if !s.valid(i, def.Default) {
+			return nil, fmt.Errorf("label %q: default value %q is not allowed", def.Name, def.Default)
+		}
+	}
+	return s, nil
+}
+
+// MustNewLabelSchema is like NewLabelSchema but panics on errors, for the schemas declared as
+// package variables.
+func MustNewLabelSchema(definitions ...LabelDefinition) *LabelSchema {
+	s, err := NewLabelSchema(definitions...)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// LabelNames returns the names of the labels of the schema, in their order.
+func (s *LabelSchema) LabelNames() []string {
+	names := make([]string, len(s.definitions))
+	for i, def := range s.definitions {
+		names[i] = def.Name
+	}
+	return names
+}
+
+// Check returns an error if the LabelExtractor doesn't declare the labels of the schema, in the
+// same order. The reserved labels it declares, like the qos label of a chained
+// QoSLabelExtractor, are not part of the schema.
+func (s *LabelSchema) Check(labelExtractor LabelExtractor) error {
+	want := s.LabelNames()
+	var got []string
+	for _, labelName := range labelExtractor.LabelNames() {
+		if !reservedLabels[labelName] {
+			got = append(got, labelName)
+		}
+	}
+	if len(want) != len(got) {
+		return fmt.Errorf("label extractor declares the labels %v, the schema %v", got, want)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			return fmt.Errorf("label extractor declares the labels %v, the schema %v", got, want)
+		}
+	}
+	return nil
+}
+
+// Extractor returns a LabelExtractor declaring the labels of the schema, whose values are
+// returned by labels and conformed to the schema.
+func (s *LabelSchema) Extractor(labels func(context.Context) map[string]string) LabelExtractor {
+	return &schemaLabelExtractor{schema: s, labels: labels}
+}
+
+// valid reports whether the value is allowed for the i-th label.
+func (s *LabelSchema) valid(i int, value string) bool {
+	if s.allowed[i] != nil && !s.allowed[i][value] {
+		return false
+	}
+	if s.patterns[i] != nil && !s.patterns[i].MatchString(value) {
+		return false
+	}
+	return true
+}
+
+// conform sets the default value of the labels of the schema which are missing or not allowed,
+// and returns their names.
+func (s *LabelSchema) conform(labels map[string]string) []string {
+	var defaulted []string
+	for i, def := range s.definitions {
+		if value, ok := labels[def.Name]; !ok || !s.valid(i, value) {
+			labels[def.Name] = def.Default
+			defaulted = append(defaulted, def.Name)
+		}
+	}
+	return defaulted
+}
+
+// conformValue returns the value of the label, or its default value if the schema declares the
+// label and doesn't allow the value.
+func (s *LabelSchema) conformValue(labelName, value string) string {
+	if s == nil {
+		return value
+	}
+	for i, def := range s.definitions {
+		if def.Name == labelName && !s.valid(i, value) {
+			return def.Default
+		}
+	}
+	return value
+}
+
+// defines reports whether the label is declared by the schema.
+func (s *LabelSchema) defines(labelName string) bool {
+	for _, def := range s.definitions {
+		if def.Name == labelName {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultValue returns the default value of the label, or "default" if it's not in the schema.
+func (s *LabelSchema) defaultValue(labelName string) string {
+	if s != nil {
+		for _, def := range s.definitions {
+			if def.Name == labelName {
+				return def.Default
+			}
+		}
+	}
+	return "default"
+}
+
+// schemaLabelExtractor is the LabelExtractor of a LabelSchema.
+type schemaLabelExtractor struct {
+	schema *LabelSchema
+	labels func(context.Context) map[string]string
+}
+
+// LabelNames returns the labels of the schema
+func (e *schemaLabelExtractor) LabelNames() []string {
+	return e.schema.LabelNames()
+}
+
+// Labels returns the labels of the call conformed to the schema. They are conformed in a copy, as
+// the returned map may be shared, e.g. cached by the function.
+func (e *schemaLabelExtractor) Labels(ctx context.Context) map[string]string {
+	extracted := e.labels(ctx)
+	labels := make(map[string]string, len(extracted)+len(e.schema.definitions))
+	for name, value := range extracted {
+		labels[name] = value
+	}
+	e.schema.conform(labels)
+	return labels
+}
+
+// WithLabelSchema makes the ServerMetrics validate the custom labels with the schema: the values
+// not allowed take the default value of the label, like the missing ones. NewServerMetrics panics
+// if the LabelExtractor doesn't declare the labels of the schema in the same order, or if a label
+// of the schema is also declared with WithContextLabels, e.g. the tenant.
+func WithLabelSchema(schema *LabelSchema) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.labelSchema = schema
+	}
+}
+
+// checkLabelSchema panics if the LabelExtractor doesn't match the label schema.
+func (m *ServerMetrics) checkLabelSchema() {
+	if m.labelSchema == nil {
+		return
+	}
+	if err := m.labelSchema.Check(m.labelExtractor); err != nil {
+		panic(err.Error())
+	}
+	for _, labelName := range m.contextLabels {
+		if m.labelSchema.defines(labelName) {
+			panic(fmt.Sprintf("label %q of the schema is also set with WithContextLabels", labelName))
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package grpcprom_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestLabelSchemaExtractorCopiesLabels(t *testing.T) {
+	schema := grpcprom.MustNewLabelSchema(
+		grpcprom.LabelDefinition{Name: "tier", Values: []string{"free", "paid"}, Default: "free"},
+		grpcprom.LabelDefinition{Name: "region", Pattern: "[a-z]+-[0-9]", Default: "global-0"},
+	)
+	// The labels are shared by every call, like the ones cached by an extractor.
+	shared := map[string]string{"tier": "gold"}
+	extractor := schema.Extractor(func(context.Context) map[string]string { return shared })
+
+	labels := extractor.Labels(context.Background())
+	if labels["tier"] != "free" || labels["region"] != "global-0" {
+		t.Errorf("labels %v, want the default values", labels)
+	}
+	if len(shared) != 1 || shared["tier"] != "gold" {
+		t.Errorf("labels of the function %v, they must not be conformed in place", shared)
+	}
+}
+
+func TestLabelSchemaReservedLabels(t *testing.T) {
+	for _, name := range []string{"grpc_status", "error_type", "server_name", "warmup", "qos", "pid"} {
+		if _, err := grpcprom.NewLabelSchema(grpcprom.LabelDefinition{Name: name}); err == nil || !strings.Contains(err.Error(), "reserved") {
+			t.Errorf("label %s: error %v, want it reserved", name, err)
+		}
+	}
+
+	// The qos label of a chained QoSLabelExtractor is not part of the schema.
+	schema := grpcprom.MustNewLabelSchema(grpcprom.LabelDefinition{Name: "tenant"})
+	extractor := grpcprom.ChainLabelExtractors(
+		schema.Extractor(func(context.Context) map[string]string { return nil }),
+		grpcprom.NewQoSLabelExtractor(),
+	)
+	if err := schema.Check(extractor); err != nil {
+		t.Errorf("check: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic with the tenant label in the schema and the context labels")
+		}
+	}()
+	grpcprom.NewServerMetrics(extractor, grpcprom.WithLabelSchema(schema), grpcprom.WithContextLabels("tenant"))
+}
@@ -0,0 +1,61 @@
+package grpcprom
+
+import (
+	"context"
+)
+
+// LabelExtractor must extract the needed labels for each one of the metrics and return
+// an array of labels in the SAME ORDER than the ServerMetricLabels used for creating a NewServerMetrics()
+type LabelExtractor interface {
+	LabelNames() []string
+	Labels(context.Context) map[string]string
+}
+
+// DefaultLabelExtractor is a dummy LabelExtractor which returns the empty
+// list when processing the context to get the CustomLabels
+type DefaultLabelExtractor struct{}
+
+// LabelNames returns the names of the extra labels per metric
+func (d *DefaultLabelExtractor) LabelNames() []string {
+	return []string{}
+}
+
+// Labels returns the empty list
+func (d *DefaultLabelExtractor) Labels(ctx context.Context) map[string]string {
+	res := map[string]string{}
+	for _, l := range d.LabelNames() {
+		res[l] = "default"
+	}
+	return res
+}
+
+// chainedLabelExtractor combines the labels of several LabelExtractors.
+type chainedLabelExtractor struct {
+	extractors []LabelExtractor
+}
+
+// ChainLabelExtractors returns a LabelExtractor exposing the labels of all the given extractors.
+// When two extractors return the same label the last one wins.
+func ChainLabelExtractors(extractors ...LabelExtractor) LabelExtractor {
+	return &chainedLabelExtractor{extractors: extractors}
+}
+
+// LabelNames returns the label names of all the chained extractors
+func (c *chainedLabelExtractor) LabelNames() []string {
+	var names []string
+	for _, e := range c.extractors {
+		names = append(names, e.LabelNames()...)
+	}
+	return names
+}
+
+// Labels returns the merged labels of all the chained extractors
+func (c *chainedLabelExtractor) Labels(ctx context.Context) map[string]string {
+	res := map[string]string{}
+	for _, e := range c.extractors {
+		for k, v := range e.Labels(ctx) {
+			res[k] = v
+		}
+	}
+	return res
+}
@@ -0,0 +1,169 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// ConcurrencyLimiter is a unary server interceptor limiting the number of RPCs in flight, both
+// globally and per method. RPCs wait up to maxWait for a free slot and are rejected with
+// ResourceExhausted after that. The RPCs canceled, or whose deadline expired, while waiting fail
+// with Canceled or DeadlineExceeded and are not counted as rejected. It exports the accepted and
+// rejected RPCs and the time they waited for a slot, so load shedding can be observed with the
+// same labels as the RPC metrics.
+// The rejected RPCs carry a RetryInfo detail asking the clients to retry after maxWait, and are
+// counted in grpc_server_backpressure_signaled_total by method.
+type ConcurrencyLimiter struct {
+	global  chan struct{}
+	methods map[string]chan struct{}
+	maxWait time.Duration
+
+	accepted     *prom.CounterVec
+	rejected     *prom.CounterVec
+	queueWait    *prom.HistogramVec
+	backpressure *prom.CounterVec
+}
+
+// ConcurrencyLimiterOption configures the ConcurrencyLimiter returned by NewConcurrencyLimiter.
+type ConcurrencyLimiterOption func(*ConcurrencyLimiter)
+
+// WithMethodLimit limits the RPCs in flight of the method, given as full method name
+// (/package.Service/Method), on top of the global limit. NewConcurrencyLimiter panics if
+// maxInFlight is not positive, as no RPC of the method could ever be accepted.
+func WithMethodLimit(fullMethod string, maxInFlight int) ConcurrencyLimiterOption {
+	return func(l *ConcurrencyLimiter) {
+		if maxInFlight <= 0 {
+			panic(fmt.Sprintf("limit of %s must be positive, not %d", fullMethod, maxInFlight))
+		}
+		l.methods[fullMethod] = make(chan struct{}, maxInFlight)
+	}
+}
+
+// NewConcurrencyLimiter returns a ConcurrencyLimiter allowing maxInFlight RPCs at the same time,
+// zero meaning no global limit, which waits up to maxWait for a free slot.
+func NewConcurrencyLimiter(maxInFlight int, maxWait time.Duration, opts ...ConcurrencyLimiterOption) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{
+		methods: map[string]chan struct{}{},
+		maxWait: maxWait,
+		accepted: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_limiter_accepted_total",
+				Help: "Total number of RPCs accepted by the concurrency limiter.",
+			}, []string{"grpc_service", "grpc_method"},
+		),
+		rejected: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_limiter_rejected_total",
+				Help: "Total number of RPCs rejected by the concurrency limiter, by the global or the method limit.",
+			}, []string{"grpc_service", "grpc_method", "limit"},
+		),
+		queueWait: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_server_limiter_queue_wait_seconds",
+				Help:    "Histogram of the time (seconds) the accepted RPCs waited for a slot of the concurrency limiter.",
+				Buckets: LatencyFastBuckets,
+			}, []string{"grpc_service", "grpc_method"},
+		),
+		backpressure: newBackpressureCounter("concurrency"),
+	}
+	if maxInFlight > 0 {
+		l.global = make(chan struct{}, maxInFlight)
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Describe describes the limiter metrics.
+func (l *ConcurrencyLimiter) Describe(ch chan<- *prom.Desc) {
+	l.accepted.Describe(ch)
+	l.rejected.Describe(ch)
+	l.queueWait.Describe(ch)
+	l.backpressure.Describe(ch)
+}
+
+// Collect collects the limiter metrics.
+func (l *ConcurrencyLimiter) Collect(ch chan<- prom.Metric) {
+	l.accepted.Collect(ch)
+	l.rejected.Collect(ch)
+	l.queueWait.Collect(ch)
+	l.backpressure.Collect(ch)
+}
+
+// acquire takes a slot of sem, waiting until the timer fires or the context is done.
+func acquire(ctx context.Context, sem chan struct{}, timer <-chan time.Time) bool {
+	if sem == nil {
+		return true
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func release(sem chan struct{}) {
+	if sem != nil {
+		<-sem
+	}
+}
+
+// retryDelay returns the delay the clients of the rejected RPCs are asked to wait.
+func (l *ConcurrencyLimiter) retryDelay() time.Duration {
+	if l.maxWait <= 0 {
+		return defaultRetryDelay
+	}
+	return l.maxWait
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor enforcing the concurrency limits. Put
+// it after the ServerMetrics interceptor so the rejected RPCs are also counted as handled.
+func (l *ConcurrencyLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethodName(info.FullMethod)
+		start := time.Now()
+		timer := time.NewTimer(l.maxWait)
+		defer timer.Stop()
+
+		methodSem := l.methods[info.FullMethod]
+		if !acquire(ctx, methodSem, timer.C) {
+			if ctx.Err() != nil {
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			l.rejected.WithLabelValues(service, method, "method").Inc()
+			l.backpressure.WithLabelValues(service, method).Inc()
+			return nil, backpressureError(l.retryDelay(), "too many %s requests in flight", info.FullMethod)
+		}
+		defer release(methodSem)
+
+		if !acquire(ctx, l.global, timer.C) {
+			if ctx.Err() != nil {
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+			l.rejected.WithLabelValues(service, method, "global").Inc()
+			l.backpressure.WithLabelValues(service, method).Inc()
+			return nil, backpressureError(l.retryDelay(), "too many requests in flight")
+		}
+		defer release(l.global)
+
+		l.accepted.WithLabelValues(service, method).Inc()
+		l.queueWait.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+		return handler(ctx, req)
+	}
+}
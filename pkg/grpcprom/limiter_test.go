@@ -0,0 +1,94 @@
+package grpcprom_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithMethodLimitNotPositive(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic with a method limit of 0")
+		}
+	}()
+	grpcprom.NewConcurrencyLimiter(0, time.Second, grpcprom.WithMethodLimit("/demo.v1.Greeter/SayHello", 0))
+}
+
+func TestConcurrencyLimiterWaitEnded(t *testing.T) {
+	const fullMethod = "/demo.v1.Greeter/SayHello"
+
+	tests := []struct {
+		name     string
+		maxWait  time.Duration
+		ctx      func() (context.Context, context.CancelFunc)
+		want     codes.Code
+		rejected int
+	}{
+		{
+			name:    "canceled",
+			maxWait: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(10*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			want: codes.Canceled,
+		},
+		{
+			name:    "deadline exceeded",
+			maxWait: time.Minute,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 10*time.Millisecond)
+			},
+			want: codes.DeadlineExceeded,
+		},
+		{
+			name:    "max wait",
+			maxWait: 10 * time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Minute)
+			},
+			want:     codes.ResourceExhausted,
+			rejected: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := grpcprom.NewConcurrencyLimiter(0, tt.maxWait, grpcprom.WithMethodLimit(fullMethod, 1))
+			interceptor := l.UnaryServerInterceptor()
+			info := &grpc.UnaryServerInfo{FullMethod: fullMethod}
+
+			// The first RPC holds the only slot of the method until the second one is done.
+			running, done := make(chan struct{}), make(chan struct{})
+			go func() {
+				_, _ = interceptor(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+					close(running)
+					<-done
+					return nil, nil
+				})
+			}()
+			<-running
+			defer close(done)
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			_, err := interceptor(ctx, nil, info, func(context.Context, interface{}) (interface{}, error) {
+				t.Error("the waiting RPC must not be handled")
+				return nil, nil
+			})
+			if code := status.Code(err); code != tt.want {
+				t.Errorf("code %s, want %s", code, tt.want)
+			}
+			if n := testutil.CollectAndCount(l, "grpc_server_limiter_rejected_total"); n != tt.rejected {
+				t.Errorf("%d rejected series, want %d", n, tt.rejected)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package grpcprom
+
+import (
+	"context"
+	"runtime/metrics"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// heapObjectsMetric is the runtime metric of the bytes of the heap objects, live or not yet swept.
+const heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+
+// Watermarks are the overload thresholds of a LoadShedder. The zero value of a watermark
+// disables it.
+type Watermarks struct {
+	// InFlight is the number of RPCs in flight in the LoadShedder interceptor.
+	InFlight int64
+	// QueueDelay is the queue delay of the RPC, from the SendTimeKey metadata of its client.
+	QueueDelay time.Duration
+	// HeapBytes is the size of the heap objects.
+	HeapBytes uint64
+}
+
+// LoadShedder is a unary server interceptor rejecting the low-priority RPCs, with the
+// PriorityMetadataKey metadata of a sheddable class, while the in-flight, queue delay or memory
+// watermarks are exceeded. The other RPCs are never shed. The shed RPCs are counted by the
+// exceeded watermark, and the watermarks are exported with the current levels, so the overload
+// behavior is both active and observable.
+type LoadShedder struct {
+	watermarks Watermarks
+	sheddable  []string
+
+	inFlight   atomic.Int64
+	queueDelay atomic.Int64
+
+	shed      *prom.CounterVec
+	watermark *prom.Desc
+	level     *prom.Desc
+}
+
+// NewLoadShedder returns a LoadShedder enforcing the watermarks on the RPCs of the sheddable
+// QoS classes, or of the DefaultQoSClasses but the first one, i.e. batch.
+func NewLoadShedder(watermarks Watermarks, sheddable ...string) *LoadShedder {
+	if len(sheddable) == 0 {
+		sheddable = DefaultQoSClasses[1:]
+	}
+	return &LoadShedder{
+		watermarks: watermarks,
+		sheddable:  sheddable,
+		shed: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_load_shedder_shed_total",
+				Help: "Total number of RPCs shed by the load shedder, by QoS class and exceeded watermark.",
+			}, []string{"grpc_service", "grpc_method", "qos", "watermark"},
+		),
+		watermark: prom.NewDesc(
+			"grpc_server_load_shedder_watermark",
+			"Watermarks above which the load shedder sheds the low-priority RPCs.",
+			[]string{"watermark"}, nil,
+		),
+		level: prom.NewDesc(
+			"grpc_server_load_shedder_level",
+			"Current levels of the watermarks of the load shedder; the last queue delay for the queue_delay_seconds one.",
+			[]string{"watermark"}, nil,
+		),
+	}
+}
+
+// Describe describes the load shedder metrics.
+func (l *LoadShedder) Describe(ch chan<- *prom.Desc) {
+	l.shed.Describe(ch)
+	ch <- l.watermark
+	ch <- l.level
+}
+
+// Collect collects the load shedder metrics, with the levels of the enabled watermarks.
+func (l *LoadShedder) Collect(ch chan<- prom.Metric) {
+	l.shed.Collect(ch)
+	if l.watermarks.InFlight > 0 {
+		ch <- prom.MustNewConstMetric(l.watermark, prom.GaugeValue, float64(l.watermarks.InFlight), "in_flight")
+		ch <- prom.MustNewConstMetric(l.level, prom.GaugeValue, float64(l.inFlight.Load()), "in_flight")
+	}
+	if l.watermarks.QueueDelay > 0 {
+		ch <- prom.MustNewConstMetric(l.watermark, prom.GaugeValue, l.watermarks.QueueDelay.Seconds(), "queue_delay_seconds")
+		ch <- prom.MustNewConstMetric(l.level, prom.GaugeValue, time.Duration(l.queueDelay.Load()).Seconds(), "queue_delay_seconds")
+	}
+	if l.watermarks.HeapBytes > 0 {
+		ch <- prom.MustNewConstMetric(l.watermark, prom.GaugeValue, float64(l.watermarks.HeapBytes), "heap_bytes")
+		ch <- prom.MustNewConstMetric(l.level, prom.GaugeValue, float64(heapObjectBytes()), "heap_bytes")
+	}
+}
+
+// class returns the sheddable class of the RPC, if it has one.
+func (l *LoadShedder) class(ctx context.Context) (string, bool) {
+	values := metadata.ValueFromIncomingContext(ctx, PriorityMetadataKey)
+	if len(values) == 0 {
+		return "", false
+	}
+	for _, class := range l.sheddable {
+		if strings.EqualFold(values[0], class) {
+			return class, true
+		}
+	}
+	return "", false
+}
+
+// exceeded returns the first watermark exceeded while handling the RPC, if any.
+func (l *LoadShedder) exceeded(inFlight int64, queueDelay time.Duration) (string, bool) {
+	if l.watermarks.InFlight > 0 && inFlight > l.watermarks.InFlight {
+		return "in_flight", true
+	}
+	if l.watermarks.QueueDelay > 0 && queueDelay > l.watermarks.QueueDelay {
+		return "queue_delay_seconds", true
+	}
+	if l.watermarks.HeapBytes > 0 && heapObjectBytes() > l.watermarks.HeapBytes {
+		return "heap_bytes", true
+	}
+	return "", false
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor shedding the low-priority RPCs above
+// the watermarks with ResourceExhausted. Put it after the ServerMetrics interceptor so the shed
+// RPCs are also counted as handled.
+func (l *LoadShedder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		inFlight := l.inFlight.Add(1)
+		defer l.inFlight.Add(-1)
+
+		var queueDelay time.Duration
+		if sent, ok := sendTime(ctx); ok && l.watermarks.QueueDelay > 0 {
+			queueDelay = time.Since(sent)
+			l.queueDelay.Store(int64(queueDelay))
+		}
+
+		if class, ok := l.class(ctx); ok {
+			if watermark, ok := l.exceeded(inFlight, queueDelay); ok {
+				service, method := splitMethodName(info.FullMethod)
+				l.shed.WithLabelValues(service, method, class, watermark).Inc()
+				return nil, status.Errorf(codes.ResourceExhausted, "%s request shed: %s watermark exceeded", class, watermark)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// heapObjectBytes returns the bytes of the heap objects.
+func heapObjectBytes() uint64 {
+	sample := []metrics.Sample{{Name: heapObjectsMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,102 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// DeniedMetadataKeys are the metadata keys carrying credentials. The built-in extractors never
+// read them, and WithStrictLabels refuses label names matching them.
+var DeniedMetadataKeys = []string{
+	"authorization",
+	"proxy-authorization",
+	"cookie",
+	"set-cookie",
+	"x-api-key",
+}
+
+// isDeniedKey reports whether the metadata key or label name matches a denied key. Label names
+// can't have dashes, so underscores match them too.
+func isDeniedKey(name string) bool {
+	name = strings.ReplaceAll(strings.ToLower(name), "_", "-")
+	for _, denied := range DeniedMetadataKeys {
+		if name == denied {
+			return true
+		}
+	}
+	return false
+}
+
+// MetadataLabelExtractor is a LabelExtractor labeling the RPCs with the values of an allowlist
+// of incoming metadata keys. The keys in DeniedMetadataKeys are never read, so their labels
+// always get the default value.
+type MetadataLabelExtractor struct {
+	// keys maps the metadata keys to label names.
+	keys map[string]string
+}
+
+// NewMetadataLabelExtractor returns a MetadataLabelExtractor exposing the metadata keys as the
+// labels they are mapped to, e.g. {"x-tenant-id": "tenant"}.
+func NewMetadataLabelExtractor(keys map[string]string) *MetadataLabelExtractor {
+	normalized := make(map[string]string, len(keys))
+	for key, label := range keys {
+		normalized[strings.ToLower(key)] = label
+	}
+	return &MetadataLabelExtractor{keys: normalized}
+}
+
+// LabelNames returns the label names of the metadata keys, sorted
+func (e *MetadataLabelExtractor) LabelNames() []string {
+	names := make([]string, 0, len(e.keys))
+	for _, name := range e.keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Labels returns the first value of the allowed metadata keys of the incoming context, sanitized
+// like the method names, as the clients control them
+func (e *MetadataLabelExtractor) Labels(ctx context.Context) map[string]string {
+	labels := map[string]string{}
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return labels
+	}
+
+	for key, label := range e.keys {
+		if isDeniedKey(key) {
+			continue
+		}
+		if values := md.Get(key); len(values) > 0 {
+			labels[label] = sanitizeLabelValue(values[0])
+		}
+	}
+	return labels
+}
+
+// WithStrictLabels makes NewServerMetrics panic when the LabelExtractor, or an option, declares a
+// label name matching one of the DeniedMetadataKeys, so a server leaking credentials into its
+// metrics refuses to start. The labels are checked once all the options are applied, so the
+// order of the options doesn't matter.
+func WithStrictLabels() ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.strictLabels = true
+	}
+}
+
+// checkStrictLabels panics if WithStrictLabels is given and a label is denied.
+func (m *ServerMetrics) checkStrictLabels() {
+	if !m.strictLabels {
+		return
+	}
+	for _, name := range m.labels {
+		if isDeniedKey(name) {
+			panic(fmt.Sprintf("label %q matches a denied metadata key", name))
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package grpcprom_test
+
+import (
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestWithStrictLabelsOptionOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []grpcprom.ServerMetricsOption
+	}{
+		{
+			name: "strict labels first",
+			opts: []grpcprom.ServerMetricsOption{grpcprom.WithStrictLabels(), grpcprom.WithContextLabels("authorization")},
+		},
+		{
+			name: "strict labels last",
+			opts: []grpcprom.ServerMetricsOption{grpcprom.WithContextLabels("authorization"), grpcprom.WithStrictLabels()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic with a denied label")
+				}
+			}()
+			grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, tt.opts...)
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package grpcprom
+
+import (
+	"regexp"
+)
+
+// MethodRewrite rewrites the full method names (/package.Service/Method) matching Pattern with
+// Replacement, which can refer to the submatches like regexp.Regexp.ReplaceAllString does.
+type MethodRewrite struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// WithMethodRewrites makes the ServerMetrics rewrite the full method names of the RPCs before
+// splitting them into the grpc_service and grpc_method labels. Only the first matching rule is
+// applied. Collapsing the generated per-entity methods or the versioned services into a
+// canonical name keeps the cardinality of large generated APIs under control, e.g.
+//
+//	MethodRewrite{regexp.MustCompile(`^/api\.v\d+\.(\w+)/`), "/api.$1/"}
+func WithMethodRewrites(rules ...MethodRewrite) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.methodRewrites = append(m.methodRewrites, rules...)
+	}
+}
+
+// rewriteMethod returns the full method name rewritten by the first matching rule.
+func (m *ServerMetrics) rewriteMethod(fullMethod string) string {
+	for _, rule := range m.methodRewrites {
+		if rule.Pattern.MatchString(fullMethod) {
+			return rule.Pattern.ReplaceAllString(fullMethod, rule.Replacement)
+		}
+	}
+	return fullMethod
+}
@@ -0,0 +1,149 @@
+package grpcprom
+
+import (
+	"sort"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcstatus"
+)
+
+// MethodType is the kind of RPC of a gRPC method.
+type MethodType string
+
+const (
+	Unary        MethodType = "unary"
+	ClientStream MethodType = "client_stream"
+	ServerStream MethodType = "server_stream"
+	BidiStream   MethodType = "bidi_stream"
+)
+
+// Method is a method of a service registered on a gRPC server.
+type Method struct {
+	Service string
+	Name    string
+	Type    MethodType
+}
+
+// FullMethod returns the full method name of the method, /service/method, as seen by the
+// interceptors.
+func (m Method) FullMethod() string {
+	return "/" + m.Service + "/" + m.Name
+}
+
+// ServiceInfoProvider is implemented by the servers exposing their registered services, like
+// *grpc.Server.
+type ServiceInfoProvider interface {
+	GetServiceInfo() map[string]grpc.ServiceInfo
+}
+
+// Methods returns the methods of all the services registered on the server, sorted by their full
+// method name.
+func Methods(server ServiceInfoProvider) []Method {
+	var methods []Method
+	for service, info := range server.GetServiceInfo() {
+		for _, mInfo := range info.Methods {
+			methods = append(methods, Method{
+				Service: service,
+				Name:    mInfo.Name,
+				Type:    methodType(mInfo),
+			})
+		}
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].FullMethod() < methods[j].FullMethod()
+	})
+	return methods
+}
+
+// registeredMethods are the full methods registered on a server, the only ones labeled with their
+// name by the metrics recorded before the routing, whose method names come from the clients, so
+// they can't create series of made up methods.
+type registeredMethods struct {
+	methods atomic.Pointer[map[string]bool]
+}
+
+// set sets the methods registered on the server, and returns them.
+func (r *registeredMethods) set(server ServiceInfoProvider) []Method {
+	registered := Methods(server)
+	methods := make(map[string]bool, len(registered))
+	for _, method := range registered {
+		methods[method.FullMethod()] = true
+	}
+	r.methods.Store(&methods)
+	return registered
+}
+
+// labels returns the grpc_service and grpc_method labels of the full method, unknown if it is not
+// registered on the server, or if the methods are not set yet.
+func (r *registeredMethods) labels(fullMethod string) (string, string) {
+	if methods := r.methods.Load(); methods == nil || !(*methods)[fullMethod] {
+		return unknownName, unknownName
+	}
+	return splitMethodName(fullMethod)
+}
+
+func methodType(info grpc.MethodInfo) MethodType {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return BidiStream
+	case info.IsClientStream:
+		return ClientStream
+	case info.IsServerStream:
+		return ServerStream
+	default:
+		return Unary
+	}
+}
+
+// sinkInitializer is implemented by the sinks which can create the series of a set of labels
+// before any RPC is recorded with them.
+type sinkInitializer interface {
+	Init(labels map[string]string)
+}
+
+// InitializeMetrics creates the series of every method registered on the server and every status
+// code, so they are exported with a zero value before the first RPC. The custom labels take the
+// default value and the method names go through the WithMethodAllowlist and WithMethodRewrites
+// rules. It does nothing for sinks which can't create series in advance.
+func (m *ServerMetrics) InitializeMetrics(server ServiceInfoProvider) {
+	m.initializeMetrics(defaultServerName, server)
+}
+
+func (m *ServerMetrics) initializeMetrics(serverName string, server ServiceInfoProvider) {
+	sink, ok := m.sink.(sinkInitializer)
+	if !ok {
+		return
+	}
+
+	for _, method := range Methods(server) {
+		service, name := m.methodLabels(method.FullMethod())
+		for c := codes.OK; c <= codes.Unauthenticated; c++ {
+			labels := map[string]string{
+				"grpc_service": service,
+				"grpc_method":  name,
+				"grpc_status":  m.collapseStatus(c.String()),
+			}
+			if m.serverName {
+				labels[serverNameLabel] = serverName
+			}
+			if m.warmup != nil && m.warmup.mode == WarmupLabel {
+				labels[warmupLabel] = "false"
+			}
+			if m.errorType && c == codes.OK {
+				labels["error_type"] = grpcstatus.NoErrorType
+			} else if m.errorType {
+				labels["error_type"] = grpcstatus.OtherErrorType
+			}
+			for _, labelName := range m.labels {
+				if _, ok := labels[labelName]; !ok {
+					labels[labelName] = m.labelSchema.defaultValue(labelName)
+				}
+			}
+			sink.Init(labels)
+		}
+	}
+}
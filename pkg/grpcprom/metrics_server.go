@@ -0,0 +1,153 @@
+package grpcprom
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Default timeouts of the MetricsServer, long enough for slow scrapes of big registries.
+const (
+	DefaultMetricsReadHeaderTimeout = 5 * time.Second
+	DefaultMetricsReadTimeout       = 10 * time.Second
+	DefaultMetricsWriteTimeout      = 30 * time.Second
+	DefaultMetricsIdleTimeout       = 2 * time.Minute
+)
+
+// MetricsServerOptions configures the MetricsServer returned by NewMetricsServer. The zero
+// timeouts take the default values.
+type MetricsServerOptions struct {
+	// Addr is the address to listen on, e.g. ":9092".
+	Addr string
+	// Handler serves the requests, e.g. a mux with the /metrics handler.
+	Handler http.Handler
+	// TLSConfig serves HTTPS when set. It must have the certificates of the server.
+	TLSConfig *tls.Config
+	// Authenticate authorizes the requests, e.g. with BasicAuth or BearerToken; the others get
+	// 401 Unauthorized. All the requests are served when it is nil.
+	Authenticate func(*http.Request) bool
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// OnError is called with the error of the server when it stops serving, other than by
+	// Shutdown. The errors are dropped when it is nil.
+	OnError func(error)
+}
+
+// MetricsServer is the HTTP server of the metrics endpoint, with timeouts, optional TLS and
+// authentication, so the users don't hand-roll an insecure metrics listener.
+type MetricsServer struct {
+	server   *http.Server
+	listener net.Listener
+	tls      bool
+	onError  func(error)
+}
+
+// NewMetricsServer returns a MetricsServer serving the handler of the options.
+func NewMetricsServer(opts MetricsServerOptions) *MetricsServer {
+	handler := opts.Handler
+	if opts.Authenticate != nil {
+		handler = authenticated(opts.Authenticate, handler)
+	}
+	return &MetricsServer{
+		server: &http.Server{
+			Addr:              opts.Addr,
+			Handler:           handler,
+			TLSConfig:         opts.TLSConfig,
+			ReadHeaderTimeout: durationOrDefault(opts.ReadHeaderTimeout, DefaultMetricsReadHeaderTimeout),
+			ReadTimeout:       durationOrDefault(opts.ReadTimeout, DefaultMetricsReadTimeout),
+			WriteTimeout:      durationOrDefault(opts.WriteTimeout, DefaultMetricsWriteTimeout),
+			IdleTimeout:       durationOrDefault(opts.IdleTimeout, DefaultMetricsIdleTimeout),
+		},
+		tls:     opts.TLSConfig != nil,
+		onError: opts.OnError,
+	}
+}
+
+// durationOrDefault returns d, or def when d is zero.
+func durationOrDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
+
+// authenticated returns the handler rejecting the requests not authorized by authenticate.
+func authenticated(authenticate func(*http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authenticate(r) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BasicAuth returns the MetricsServerOptions.Authenticate function accepting the requests with
+// the HTTP basic auth credentials.
+func BasicAuth(username, password string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		u, p, ok := r.BasicAuth()
+		return ok && secureEqual(u, username) && secureEqual(p, password)
+	}
+}
+
+// BearerToken returns the MetricsServerOptions.Authenticate function accepting the requests with
+// the bearer token, like the ones of Prometheus with an authorization credentials file.
+func BearerToken(token string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		const prefix = "Bearer "
+		header := r.Header.Get("Authorization")
+		return len(header) > len(prefix) && header[:len(prefix)] == prefix && secureEqual(header[len(prefix):], token)
+	}
+}
+
+// secureEqual compares the secrets in constant time.
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// Start listens on the address and serves in the background. The listen errors, like an address
+// in use, are returned, and the later serving errors are passed to OnError.
+func (s *MetricsServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	go func() {
+		var err error
+		if s.tls {
+			err = s.server.ServeTLS(listener, "", "")
+		} else {
+			err = s.server.Serve(listener)
+		}
+		if !errors.Is(err, http.ErrServerClosed) && s.onError != nil {
+			s.onError(err)
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the MetricsServer listens on, once started.
+func (s *MetricsServer) Addr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Shutdown stops the MetricsServer gracefully, waiting for the scrapes in flight until ctx is
+// done.
+func (s *MetricsServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,121 @@
+package grpcprom
+
+import (
+	"context"
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// MessageSizeMetrics is a stats.Handler counting the RPCs which failed because a message exceeded
+// the MaxRecvMsgSize or MaxSendMsgSize of the server, and the messages bigger than a soft limit,
+// to catch the payload growth before the hard limits are hit. The size errors happen while
+// decoding the request, before the interceptors, so they need a stats handler.
+type MessageSizeMetrics struct {
+	softLimit int
+	exceeded  *prom.CounterVec
+	oversized *prom.CounterVec
+
+	// methods are the full methods registered on the server, set by InitializeMetrics.
+	methods registeredMethods
+}
+
+// NewMessageSizeMetrics returns the MessageSizeMetrics counting the messages bigger than
+// softLimit bytes. A zero softLimit only counts the RPCs failed by the hard limits. Install them
+// on the server with grpc.StatsHandler, and call InitializeMetrics once the services are
+// registered: the method names come from the clients before any routing, so the RPCs of the
+// methods which aren't registered, or all of them until InitializeMetrics is called, are labeled
+// unknown.
+func NewMessageSizeMetrics(softLimit int) *MessageSizeMetrics {
+	labels := []string{"grpc_service", "grpc_method", "direction"}
+	return &MessageSizeMetrics{
+		softLimit: softLimit,
+		exceeded: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_msg_size_exceeded_total",
+				Help: "Total number of RPCs failed with ResourceExhausted because a message exceeded the maximum size.",
+			}, labels,
+		),
+		oversized: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_msg_oversized_total",
+				Help: "Total number of messages bigger than the soft size limit.",
+			}, labels,
+		),
+	}
+}
+
+// Describe describes the message size metrics.
+func (m *MessageSizeMetrics) Describe(ch chan<- *prom.Desc) {
+	m.exceeded.Describe(ch)
+	m.oversized.Describe(ch)
+}
+
+// Collect collects the message size metrics.
+func (m *MessageSizeMetrics) Collect(ch chan<- prom.Metric) {
+	m.exceeded.Collect(ch)
+	m.oversized.Collect(ch)
+}
+
+// InitializeMetrics sets the methods registered on the server, the only ones labeled with their
+// name.
+func (m *MessageSizeMetrics) InitializeMetrics(server ServiceInfoProvider) {
+	m.methods.set(server)
+}
+
+type msgSizeMethodKey struct{}
+
+// TagRPC keeps the method of the RPC in the context for HandleRPC.
+func (m *MessageSizeMetrics) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, msgSizeMethodKey{}, info.FullMethodName)
+}
+
+// HandleRPC counts the oversized messages and the RPCs failed by the size limits.
+func (m *MessageSizeMetrics) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	fullMethod, _ := ctx.Value(msgSizeMethodKey{}).(string)
+	service, method := m.methods.labels(fullMethod)
+
+	switch s := s.(type) {
+	case *stats.InPayload:
+		if m.softLimit > 0 && s.Length > m.softLimit {
+			m.oversized.WithLabelValues(service, method, "received").Inc()
+		}
+	case *stats.OutPayload:
+		if m.softLimit > 0 && s.Length > m.softLimit {
+			m.oversized.WithLabelValues(service, method, "sent").Inc()
+		}
+	case *stats.End:
+		if direction, ok := msgSizeErrorDirection(s.Error); ok {
+			m.exceeded.WithLabelValues(service, method, direction).Inc()
+		}
+	}
+}
+
+// msgSizeErrorDirection tells whether err is a message size error of grpc-go, and whether the
+// message was being received or sent.
+func msgSizeErrorDirection(err error) (string, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != codes.ResourceExhausted {
+		return "", false
+	}
+
+	switch msg := st.Message(); {
+	case strings.Contains(msg, "send message larger than max"):
+		return "sent", true
+	case strings.Contains(msg, "larger than max"):
+		return "received", true
+	default:
+		return "", false
+	}
+}
+
+// TagConn does nothing, the connections are not instrumented.
+func (m *MessageSizeMetrics) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+// HandleConn does nothing, the connections are not instrumented.
+func (m *MessageSizeMetrics) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,28 @@
+package grpcprom_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"google.golang.org/grpc/stats"
+)
+
+func TestMessageSizeMetricsUnknownMethods(t *testing.T) {
+	m := grpcprom.NewMessageSizeMetrics(10)
+	reg := newRegistry(t, m)
+	m.InitializeMetrics(fakeServer{})
+
+	for _, fullMethod := range []string{"/demo.v1.Greeter/SayHello", "/demo.v1.Greeter/Made1", "/made.Up/Made2"} {
+		ctx := m.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: fullMethod})
+		m.HandleRPC(ctx, &stats.InPayload{Length: 11})
+	}
+
+	want := `
+# HELP grpc_server_msg_oversized_total Total number of messages bigger than the soft size limit.
+# TYPE grpc_server_msg_oversized_total counter
+grpc_server_msg_oversized_total{direction="received",grpc_method="SayHello",grpc_service="demo.v1.Greeter"} 1
+grpc_server_msg_oversized_total{direction="received",grpc_method="unknown",grpc_service="unknown"} 2
+`
+	assertMetrics(t, reg, want, "grpc_server_msg_oversized_total")
+}
@@ -0,0 +1,225 @@
+package grpcprom
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+// multiProcessExt is the extension of the metrics files of the processes.
+const multiProcessExt = ".pb"
+
+// pidLabel is the label added to the gauges of every process by the MultiProcessGatherer.
+const pidLabel = "pid"
+
+// exportedPIDLabel is the name the pid label of the gauges of the processes is renamed to, so it
+// doesn't collide with the pidLabel added by the MultiProcessGatherer.
+const exportedPIDLabel = "exported_pid"
+
+// MultiProcessGatherer is a prom.Gatherer aggregating the metrics of the processes of a preforked
+// deployment, which run behind one scrape target, like the multiprocess mode of the Python
+// client. Every process writes the metrics of its gatherer to its own file of a shared
+// directory, and gathers the files of all of them: the counters, histograms and the count and
+// sum of the summaries are summed, while the gauges, which can't be summed in general, are
+// exported with a pid label, renaming the pid label of the gauges to exported_pid. The files of
+// the exited processes are kept, so the counters stay monotonic, but their gauges are dropped,
+// even when they crashed before removing them, on the platforms telling whether a process is
+// running. The directory must be emptied when the deployment starts.
+type MultiProcessGatherer struct {
+	gatherer prom.Gatherer
+	dir      string
+	pid      string
+}
+
+// NewMultiProcessGatherer returns a MultiProcessGatherer sharing the metrics of gatherer through
+// dir.
+func NewMultiProcessGatherer(gatherer prom.Gatherer, dir string) *MultiProcessGatherer {
+	return &MultiProcessGatherer{
+		gatherer: gatherer,
+		dir:      dir,
+		pid:      strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Run writes the metrics of the process every interval, so the other processes serve fresh
+// values, until ctx is done. It then writes them a last time without the gauges, which are
+// meaningless once the process exited.
+func (g *MultiProcessGatherer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = g.write(false)
+			return
+		case <-ticker.C:
+			_ = g.write(true)
+		}
+	}
+}
+
+// write writes the metrics of the process to its file, through a temporary file renamed over it
+// so the other processes never read a partial file.
+func (g *MultiProcessGatherer) write(gauges bool) error {
+	families, err := g.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		return err
+	}
+
+	// Concurrent scrapes write their own temporary files.
+	f, err := os.CreateTemp(g.dir, g.pid+".*.tmp")
+	if err != nil {
+		return err
+	}
+	encoder := expfmt.NewEncoder(f, expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for _, family := range families {
+		if !gauges && family.GetType() == dto.MetricType_GAUGE {
+			continue
+		}
+		if err := encoder.Encode(family); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(g.dir, g.pid+multiProcessExt))
+}
+
+// Gather writes the metrics of the process and aggregates the files of all the processes.
+func (g *MultiProcessGatherer) Gather() ([]*dto.MetricFamily, error) {
+	errs := []error{g.write(true)}
+
+	paths, err := filepath.Glob(filepath.Join(g.dir, "*"+multiProcessExt))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		names    []string
+		families = map[string]*dto.MetricFamily{}
+		series   = map[string]map[string]*dto.Metric{}
+	)
+	for _, path := range paths {
+		pid := strings.TrimSuffix(filepath.Base(path), multiProcessExt)
+		alive := pid == g.pid || processAlive(pid)
+		processFamilies, err := readMetricsFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading %s: %w", path, err))
+			continue
+		}
+
+		for _, family := range processFamilies {
+			name := family.GetName()
+			aggregate, ok := families[name]
+			if !ok {
+				aggregate = &dto.MetricFamily{Name: family.Name, Help: family.Help, Type: family.Type}
+				families[name] = aggregate
+				series[name] = map[string]*dto.Metric{}
+				names = append(names, name)
+			} else if aggregate.GetType() != family.GetType() {
+				errs = append(errs, fmt.Errorf("%s: %s has type %s, want %s", path, name, family.GetType(), aggregate.GetType()))
+				continue
+			}
+
+			for _, metric := range family.GetMetric() {
+				if family.GetType() == dto.MetricType_GAUGE {
+					if !alive {
+						continue
+					}
+					addPIDLabel(metric, pid)
+				}
+				mergeProcessMetric(series[name], metric)
+			}
+		}
+	}
+
+	sort.Strings(names)
+	res := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		family := families[name]
+		keys := make([]string, 0, len(series[name]))
+		for key := range series[name] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			family.Metric = append(family.Metric, series[name][key])
+		}
+		res = append(res, family)
+	}
+	return res, errors.Join(errs...)
+}
+
+// addPIDLabel adds the pid label of the process to the gauge, renaming its own pid label.
+func addPIDLabel(metric *dto.Metric, pid string) {
+	for _, pair := range metric.Label {
+		if pair.GetName() == pidLabel {
+			pair.Name = proto.String(exportedPIDLabel)
+		}
+	}
+	metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(pidLabel), Value: proto.String(pid)})
+	sort.Slice(metric.Label, func(i, j int) bool {
+		return metric.Label[i].GetName() < metric.Label[j].GetName()
+	})
+}
+
+// mergeProcessMetric adds metric to the series of its labels.
+func mergeProcessMetric(series map[string]*dto.Metric, metric *dto.Metric) {
+	pairs := make([]string, 0, len(metric.GetLabel()))
+	for _, pair := range metric.GetLabel() {
+		pairs = append(pairs, pair.GetName()+"="+pair.GetValue())
+	}
+	key := strings.Join(pairs, "\xff")
+
+	aggregate, ok := series[key]
+	if !ok {
+		metric.TimestampMs = nil
+		series[key] = metric
+		return
+	}
+	// The quantiles of the processes can't be aggregated.
+	if aggregate.Summary != nil {
+		aggregate.Summary.Quantile = nil
+	}
+	merge(aggregate, metric)
+}
+
+// readMetricsFile reads the metric families of a file written by a MultiProcessGatherer.
+func readMetricsFile(path string) ([]*dto.MetricFamily, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var families []*dto.MetricFamily
+	// The decoder wraps its reader in a bufio.Reader on every call, which must be this one not to
+	// lose the bytes buffered by the previous calls.
+	decoder := expfmt.NewDecoder(bufio.NewReader(f), expfmt.NewFormat(expfmt.TypeProtoDelim))
+	for {
+		family := &dto.MetricFamily{}
+		if err := decoder.Decode(family); errors.Is(err, io.EOF) {
+			return families, nil
+		} else if err != nil {
+			return nil, err
+		}
+		families = append(families, family)
+	}
+}
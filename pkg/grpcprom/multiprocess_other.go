@@ -0,0 +1,8 @@
+//go:build !unix
+
+package grpcprom
+
+// processAlive can't tell the exited processes outside of unix, so they are all running.
+func processAlive(string) bool {
+	return true
+}
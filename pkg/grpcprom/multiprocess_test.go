@@ -0,0 +1,53 @@
+package grpcprom
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newProcessRegistry returns the registry of a process with a counter and a gauge with its own
+// pid label.
+func newProcessRegistry(t *testing.T, requests, depth float64) *prom.Registry {
+	t.Helper()
+
+	counter := prom.NewCounter(prom.CounterOpts{Name: "demo_requests_total", Help: "Requests."})
+	counter.Add(requests)
+	gauge := prom.NewGauge(prom.GaugeOpts{Name: "demo_queue_depth", Help: "Queue depth.", ConstLabels: prom.Labels{"pid": "worker"}})
+	gauge.Set(depth)
+
+	reg := prom.NewRegistry()
+	reg.MustRegister(counter, gauge)
+	return reg
+}
+
+func TestMultiProcessGatherer(t *testing.T) {
+	dir := t.TempDir()
+
+	// A process which crashed, so it didn't drop its gauges from its file.
+	dead := NewMultiProcessGatherer(newProcessRegistry(t, 2, 7), dir)
+	dead.pid = strconv.Itoa(1<<22 + 1)
+	if err := dead.write(true); err != nil {
+		t.Fatal(err)
+	}
+	if processAlive(dead.pid) {
+		t.Skipf("process %s is running", dead.pid)
+	}
+
+	g := NewMultiProcessGatherer(newProcessRegistry(t, 3, 1), dir)
+	want := `
+# HELP demo_queue_depth Queue depth.
+# TYPE demo_queue_depth gauge
+demo_queue_depth{exported_pid="worker",pid="` + strconv.Itoa(os.Getpid()) + `"} 1
+# HELP demo_requests_total Requests.
+# TYPE demo_requests_total counter
+demo_requests_total 5
+`
+	if err := testutil.GatherAndCompare(g, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package grpcprom
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+)
+
+// processAlive reports whether the process of the pid is running, including the ones of other
+// users the signal can't be sent to.
+func processAlive(pid string) bool {
+	n, err := strconv.Atoi(pid)
+	if err != nil || n <= 0 {
+		return false
+	}
+	err = syscall.Kill(n, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,118 @@
+package grpcprom
+
+import (
+	"context"
+	"math"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/orca"
+)
+
+// ORCAMetrics exports the per-call backend metrics reported by the handlers through the gRPC
+// ORCA call metrics API, aggregated per method, next to the RPC metrics.
+type ORCAMetrics struct {
+	requestCost   *prom.CounterVec
+	namedMetrics  *prom.CounterVec
+	utilization   *prom.GaugeVec
+	invalidValues *prom.CounterVec
+}
+
+// NewORCAMetrics returns the ORCAMetrics. Its interceptor must run after the one installed by
+// orca.CallMetricsServerOption, which must be the first option of the server.
+func NewORCAMetrics() *ORCAMetrics {
+	labels := []string{"grpc_service", "grpc_method", "name"}
+	return &ORCAMetrics{
+		requestCost: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_orca_request_cost_total",
+				Help: "Sum of the request costs reported by the handlers through ORCA.",
+			}, labels,
+		),
+		namedMetrics: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_orca_named_metrics_total",
+				Help: "Sum of the named metrics reported by the handlers through ORCA.",
+			}, labels,
+		),
+		utilization: prom.NewGaugeVec(
+			prom.GaugeOpts{
+				Name: "grpc_server_orca_utilization",
+				Help: "Last utilization reported by the handlers through ORCA.",
+			}, labels,
+		),
+		invalidValues: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_orca_invalid_values_total",
+				Help: "Number of negative or NaN request costs and named metrics reported by the handlers through ORCA, which are not added to the sums.",
+			}, []string{"grpc_service", "grpc_method", "kind", "name"},
+		),
+	}
+}
+
+// Describe describes the ORCA metrics.
+func (m *ORCAMetrics) Describe(ch chan<- *prom.Desc) {
+	m.requestCost.Describe(ch)
+	m.namedMetrics.Describe(ch)
+	m.utilization.Describe(ch)
+	m.invalidValues.Describe(ch)
+}
+
+// Collect collects the ORCA metrics.
+func (m *ORCAMetrics) Collect(ch chan<- prom.Metric) {
+	m.requestCost.Collect(ch)
+	m.namedMetrics.Collect(ch)
+	m.utilization.Collect(ch)
+	m.invalidValues.Collect(ch)
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor recording the backend metrics
+// reported by the unary handlers. The ORCA trailer is sent for every RPC once it is installed,
+// even if the handler didn't report anything.
+func (m *ORCAMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+
+		if p, ok := orca.CallMetricsRecorderFromContext(ctx).(orca.ServerMetricsProvider); ok {
+			service, method := splitMethodName(info.FullMethod)
+			m.record(service, method, p.ServerMetrics())
+		}
+		return resp, err
+	}
+}
+
+// record adds the backend metrics reported by one RPC of the method. Unset utilizations are -1.
+// The counters can't go down, so the negative or NaN costs and named metrics are only counted as
+// invalid.
+func (m *ORCAMetrics) record(service, method string, sm *orca.ServerMetrics) {
+	for name, v := range sm.RequestCost {
+		m.add(m.requestCost, "request_cost", service, method, name, v)
+	}
+	for name, v := range sm.NamedMetrics {
+		m.add(m.namedMetrics, "named_metric", service, method, name, v)
+	}
+
+	utilization := map[string]float64{
+		"cpu":         sm.CPUUtilization,
+		"memory":      sm.MemUtilization,
+		"application": sm.AppUtilization,
+	}
+	for name, v := range sm.Utilization {
+		utilization[name] = v
+	}
+	for name, v := range utilization {
+		if v >= 0 {
+			m.utilization.WithLabelValues(service, method, name).Set(v)
+		}
+	}
+}
+
+// add adds the value to the counter of the name, or counts it as invalid when it's negative or
+// NaN, which would make the counter panic or break its rate.
+func (m *ORCAMetrics) add(counter *prom.CounterVec, kind, service, method, name string, v float64) {
+	if v < 0 || math.IsNaN(v) {
+		m.invalidValues.WithLabelValues(service, method, kind, name).Inc()
+		return
+	}
+	counter.WithLabelValues(service, method, name).Add(v)
+}
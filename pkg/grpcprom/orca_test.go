@@ -0,0 +1,37 @@
+package grpcprom
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/orca"
+)
+
+func TestORCAMetricsInvalidValues(t *testing.T) {
+	m := NewORCAMetrics()
+	m.record("demo.v1.Greeter", "SayHello", &orca.ServerMetrics{
+		CPUUtilization: -1,
+		MemUtilization: -1,
+		AppUtilization: -1,
+		RequestCost:    map[string]float64{"name_bytes": 3, "refund": -2},
+		NamedMetrics:   map[string]float64{"queries": 1, "broken": math.NaN()},
+	})
+
+	want := `
+# HELP grpc_server_orca_invalid_values_total Number of negative or NaN request costs and named metrics reported by the handlers through ORCA, which are not added to the sums.
+# TYPE grpc_server_orca_invalid_values_total counter
+grpc_server_orca_invalid_values_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",kind="named_metric",name="broken"} 1
+grpc_server_orca_invalid_values_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",kind="request_cost",name="refund"} 1
+# HELP grpc_server_orca_named_metrics_total Sum of the named metrics reported by the handlers through ORCA.
+# TYPE grpc_server_orca_named_metrics_total counter
+grpc_server_orca_named_metrics_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",name="queries"} 1
+# HELP grpc_server_orca_request_cost_total Sum of the request costs reported by the handlers through ORCA.
+# TYPE grpc_server_orca_request_cost_total counter
+grpc_server_orca_request_cost_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",name="name_bytes"} 3
+`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,78 @@
+package grpcprom
+
+import (
+	"context"
+	"net"
+	"net/netip"
+
+	"google.golang.org/grpc/peer"
+)
+
+// peerSubnetLabel is the label of the PeerSubnetLabelExtractor.
+const peerSubnetLabel = "peer_subnet"
+
+// PeerSubnetLabelExtractor is a LabelExtractor labeling the RPCs with the subnet of the client
+// address, aggregating the IPs by a configurable prefix to get locality insight without a series
+// per client IP.
+type PeerSubnetLabelExtractor struct {
+	ipv4Bits int
+	ipv6Bits int
+}
+
+// NewPeerSubnetLabelExtractor returns a PeerSubnetLabelExtractor masking the IPv4 addresses to
+// ipv4Bits bits and the IPv6 ones to ipv6Bits bits, e.g. 24 and 64. The IPv4-mapped IPv6
+// addresses are handled as IPv4 ones.
+func NewPeerSubnetLabelExtractor(ipv4Bits, ipv6Bits int) *PeerSubnetLabelExtractor {
+	return &PeerSubnetLabelExtractor{ipv4Bits: ipv4Bits, ipv6Bits: ipv6Bits}
+}
+
+// LabelNames returns the peer_subnet label
+func (e *PeerSubnetLabelExtractor) LabelNames() []string {
+	return []string{peerSubnetLabel}
+}
+
+// Labels returns the subnet of the peer IP, e.g. 10.1.2.0/24. Peers without IP, like the ones
+// connected through a unix socket, get the default value.
+func (e *PeerSubnetLabelExtractor) Labels(ctx context.Context) map[string]string {
+	labels := map[string]string{}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return labels
+	}
+
+	if subnet, ok := e.subnet(p.Addr); ok {
+		labels[peerSubnetLabel] = subnet
+	}
+	return labels
+}
+
+// subnet returns the masked prefix of the IP of the address.
+func (e *PeerSubnetLabelExtractor) subnet(addr net.Addr) (string, bool) {
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	case *net.UDPAddr:
+		ip, _ = netip.AddrFromSlice(a.IP)
+	default:
+		addrPort, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return "", false
+		}
+		ip = addrPort.Addr()
+	}
+	if !ip.IsValid() {
+		return "", false
+	}
+
+	ip = ip.Unmap()
+	bits := e.ipv6Bits
+	if ip.Is4() {
+		bits = e.ipv4Bits
+	}
+	prefix, err := ip.WithZone("").Prefix(bits)
+	if err != nil {
+		return "", false
+	}
+	return prefix.String(), true
+}
@@ -0,0 +1,137 @@
+package grpcprom
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// StateStore persists the counter values of a PersistentGatherer across restarts, keyed by
+// metric name and labels.
+type StateStore interface {
+	Load() (map[string]float64, error)
+	Save(map[string]float64) error
+}
+
+// FileStateStore is a StateStore keeping the values in a JSON file.
+type FileStateStore struct {
+	path string
+}
+
+// NewFileStateStore returns a FileStateStore using the file at path. The file doesn't need to
+// exist until the first Save.
+func NewFileStateStore(path string) *FileStateStore {
+	return &FileStateStore{path: path}
+}
+
+// Load reads the values of the file, none if it doesn't exist.
+func (s *FileStateStore) Load() (map[string]float64, error) {
+	values := map[string]float64{}
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", s.path, err)
+	}
+	return values, nil
+}
+
+// Save writes the values to a temporary file renamed over the file, so a crash while saving
+// doesn't lose the previous state.
+func (s *FileStateStore) Save(values map[string]float64) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// PersistentGatherer is a prom.Gatherer adding the counter values saved by the previous run of
+// the process to the ones of the wrapped gatherer, so the counters stay monotonic across
+// restarts. Serve it with promhttp.HandlerFor instead of the registry, and call Save on
+// shutdown.
+type PersistentGatherer struct {
+	gatherer prom.Gatherer
+	store    StateStore
+	base     map[string]float64
+}
+
+// NewPersistentGatherer returns a PersistentGatherer wrapping gatherer, with the counter values
+// loaded from store as base.
+func NewPersistentGatherer(gatherer prom.Gatherer, store StateStore) (*PersistentGatherer, error) {
+	base, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading the counters: %w", err)
+	}
+	return &PersistentGatherer{
+		gatherer: gatherer,
+		store:    store,
+		base:     base,
+	}, nil
+}
+
+// counterKey returns the key of a counter series, its name followed by its sorted labels.
+func counterKey(name string, metric *dto.Metric) string {
+	pairs := make([]string, 0, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		pairs = append(pairs, label.GetName()+"="+label.GetValue())
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Gather gathers the metrics of the wrapped gatherer and adds the base values to the counters.
+// The series of the previous run which don't exist yet are exported once they are created.
+func (g *PersistentGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if base, ok := g.base[counterKey(family.GetName(), metric)]; ok {
+				metric.GetCounter().Value = proto.Float64(metric.GetCounter().GetValue() + base)
+			}
+		}
+	}
+	return families, err
+}
+
+// Save stores the current counter values, base included.
+func (g *PersistentGatherer) Save() error {
+	families, err := g.Gather()
+	if err != nil {
+		return err
+	}
+
+	values := map[string]float64{}
+	for k, v := range g.base {
+		values[k] = v
+	}
+	for _, family := range families {
+		if family.GetType() != dto.MetricType_COUNTER {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			values[counterKey(family.GetName(), metric)] = metric.GetCounter().GetValue()
+		}
+	}
+	return g.store.Save(values)
+}
@@ -0,0 +1,83 @@
+package grpcprom_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// newDemoCounters returns a registry with the demo_calls_total counter, incremented by calls, and
+// the demo_in_flight gauge.
+func newDemoCounters(t *testing.T, calls float64) *prom.Registry {
+	t.Helper()
+
+	counter := prom.NewCounterVec(prom.CounterOpts{Name: "demo_calls_total", Help: "Calls."}, []string{"method"})
+	counter.WithLabelValues("SayHello").Add(calls)
+	gauge := prom.NewGauge(prom.GaugeOpts{Name: "demo_in_flight", Help: "In flight."})
+	gauge.Set(3)
+	return newRegistry(t, counter, gauge)
+}
+
+func TestPersistentGatherer(t *testing.T) {
+	store := grpcprom.NewFileStateStore(filepath.Join(t.TempDir(), "state.json"))
+
+	// The first run starts from an empty state and saves its counters.
+	first, err := grpcprom.NewPersistentGatherer(newDemoCounters(t, 5), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run adds them to its own, and leaves the gauges alone.
+	second, err := grpcprom.NewPersistentGatherer(newDemoCounters(t, 2), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMetrics(t, second, `
+# HELP demo_calls_total Calls.
+# TYPE demo_calls_total counter
+demo_calls_total{method="SayHello"} 7
+# HELP demo_in_flight In flight.
+# TYPE demo_in_flight gauge
+demo_in_flight 3
+`, "demo_calls_total", "demo_in_flight")
+
+	if err := second.Save(); err != nil {
+		t.Fatal(err)
+	}
+	values, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := values[`demo_calls_total{method=SayHello}`]; got != 7 {
+		t.Errorf("saved %v calls, want 7", got)
+	}
+	if len(values) != 1 {
+		t.Errorf("saved %v, want only the counter", values)
+	}
+}
+
+func TestFileStateStoreLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	values, err := grpcprom.NewFileStateStore(filepath.Join(dir, "missing.json")).Load()
+	if err != nil || len(values) != 0 {
+		t.Errorf("missing file: got (%v, %v), want no values", values, err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	if err := os.WriteFile(corrupt, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := grpcprom.NewFileStateStore(corrupt).Load(); err == nil {
+		t.Error("no error loading a corrupt file")
+	}
+	if _, err := grpcprom.NewPersistentGatherer(newDemoCounters(t, 1), grpcprom.NewFileStateStore(corrupt)); err == nil {
+		t.Error("no error creating a gatherer from a corrupt file")
+	}
+}
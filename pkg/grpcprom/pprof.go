@@ -0,0 +1,39 @@
+package grpcprom
+
+import (
+	"context"
+	"runtime/pprof"
+
+	"google.golang.org/grpc"
+)
+
+// PprofUnaryServerInterceptor is a gRPC server-side interceptor running the handlers with the
+// grpc_service and grpc_method pprof labels, plus the given custom labels returned by the
+// labelExtractor, so the CPU and goroutine profiles can be sliced by the same dimensions as the
+// metrics. The goroutines started by the handlers inherit the labels.
+func PprofUnaryServerInterceptor(labelExtractor LabelExtractor, labelNames ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		service, method := splitMethodName(info.FullMethod)
+		labels := []string{"grpc_service", service, "grpc_method", method}
+
+		if len(labelNames) > 0 {
+			custom := labelExtractor.Labels(contextWithRequest(ctx, req))
+			for _, name := range labelNames {
+				value, ok := custom[name]
+				if !ok {
+					value = "default"
+				}
+				labels = append(labels, name, value)
+			}
+		}
+
+		var (
+			resp interface{}
+			err  error
+		)
+		pprof.Do(ctx, pprof.Labels(labels...), func(ctx context.Context) {
+			resp, err = handler(ctx, req)
+		})
+		return resp, err
+	}
+}
@@ -0,0 +1,257 @@
+package grpcprom
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// PushEncoder encodes the gathered metrics into the body of a push request, returning the body
+// and its content type.
+type PushEncoder func(families []*dto.MetricFamily) ([]byte, string, error)
+
+// TextPushEncoder encodes the metrics in the text exposition format, accepted by the
+// Pushgateway.
+func TextPushEncoder(families []*dto.MetricFamily) ([]byte, string, error) {
+	var buf bytes.Buffer
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(&buf, family); err != nil {
+			return nil, "", err
+		}
+	}
+	return buf.Bytes(), string(expfmt.NewFormat(expfmt.TypeTextPlain)), nil
+}
+
+// pushPayload is an encoded push waiting to be sent.
+type pushPayload struct {
+	body        []byte
+	contentType string
+}
+
+// Pusher periodically pushes the metrics of a gatherer to an HTTP endpoint, for the edge
+// deployments which can't be scraped. The pushes which fail are kept in a bounded buffer and
+// retried with exponential backoff, oldest first. With the TextPushEncoder it pushes to a
+// Pushgateway; other backends, like remote write or OTLP HTTP, plug in their PushEncoder.
+type Pusher struct {
+	url        string
+	gatherer   prom.Gatherer
+	encoder    PushEncoder
+	method     string
+	headers    http.Header
+	client     *http.Client
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	maxBuffer  int
+
+	buffer      []pushPayload
+	backoff     time.Duration
+	nextAttempt time.Time
+
+	pushes   *prom.CounterVec
+	dropped  prom.Counter
+	buffered prom.Gauge
+}
+
+// PusherOption configures the Pusher returned by NewPusher.
+type PusherOption func(*Pusher)
+
+// WithPushEncoder sets the encoder of the pushes, TextPushEncoder by default.
+func WithPushEncoder(encoder PushEncoder) PusherOption {
+	return func(p *Pusher) {
+		p.encoder = encoder
+	}
+}
+
+// WithPushMethod sets the HTTP method of the pushes, POST by default. The Pushgateway replaces
+// the whole group with PUT.
+func WithPushMethod(method string) PusherOption {
+	return func(p *Pusher) {
+		p.method = method
+	}
+}
+
+// WithPushHeader adds a header to the pushes, e.g. Authorization.
+func WithPushHeader(key, value string) PusherOption {
+	return func(p *Pusher) {
+		p.headers.Add(key, value)
+	}
+}
+
+// WithPushTLS sets the TLS configuration of the pushes.
+func WithPushTLS(config *tls.Config) PusherOption {
+	return func(p *Pusher) {
+		p.client = &http.Client{
+			Timeout:   p.client.Timeout,
+			Transport: &http.Transport{TLSClientConfig: config},
+		}
+	}
+}
+
+// WithPushBackoff sets the bounds of the exponential backoff between the retries, 1s and 1m by
+// default.
+func WithPushBackoff(min, max time.Duration) PusherOption {
+	return func(p *Pusher) {
+		p.minBackoff, p.maxBackoff = min, max
+	}
+}
+
+// WithPushBuffer sets the number of failed pushes kept for retrying, 10 by default. The oldest
+// ones are dropped first.
+func WithPushBuffer(size int) PusherOption {
+	return func(p *Pusher) {
+		p.maxBuffer = size
+	}
+}
+
+// NewPusher returns a Pusher pushing the metrics of gatherer to url.
+func NewPusher(url string, gatherer prom.Gatherer, opts ...PusherOption) *Pusher {
+	p := &Pusher{
+		url:        url,
+		gatherer:   gatherer,
+		encoder:    TextPushEncoder,
+		method:     http.MethodPost,
+		headers:    http.Header{},
+		client:     &http.Client{Timeout: 10 * time.Second},
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+		maxBuffer:  10,
+		pushes: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "metrics_pushes_total",
+				Help: "Total number of attempts to push the metrics, by result.",
+			}, []string{"result"},
+		),
+		dropped: prom.NewCounter(
+			prom.CounterOpts{
+				Name: "metrics_push_dropped_total",
+				Help: "Total number of pushes dropped because the retry buffer was full.",
+			},
+		),
+		buffered: prom.NewGauge(
+			prom.GaugeOpts{
+				Name: "metrics_push_buffered",
+				Help: "Number of pushes waiting to be retried.",
+			},
+		),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Describe describes the push metrics.
+func (p *Pusher) Describe(ch chan<- *prom.Desc) {
+	p.pushes.Describe(ch)
+	p.dropped.Describe(ch)
+	p.buffered.Describe(ch)
+}
+
+// Collect collects the push metrics.
+func (p *Pusher) Collect(ch chan<- prom.Metric) {
+	p.pushes.Collect(ch)
+	p.dropped.Collect(ch)
+	p.buffered.Collect(ch)
+}
+
+// Run gathers the metrics every interval and pushes them, until ctx is done.
+func (p *Pusher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var retry <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.enqueue()
+		case <-retry:
+			retry = nil
+		}
+
+		if retry == nil && !p.flush(ctx) {
+			retry = time.After(time.Until(p.nextAttempt))
+		}
+	}
+}
+
+// enqueue gathers and encodes the metrics, dropping the oldest push if the buffer is full.
+func (p *Pusher) enqueue() {
+	families, err := p.gatherer.Gather()
+	if err != nil && len(families) == 0 {
+		p.pushes.WithLabelValues("gather_error").Inc()
+		return
+	}
+
+	body, contentType, err := p.encoder(families)
+	if err != nil {
+		p.pushes.WithLabelValues("encode_error").Inc()
+		return
+	}
+
+	p.buffer = append(p.buffer, pushPayload{body: body, contentType: contentType})
+	if len(p.buffer) > p.maxBuffer {
+		p.buffer = p.buffer[1:]
+		p.dropped.Inc()
+	}
+	p.buffered.Set(float64(len(p.buffer)))
+}
+
+// flush sends the buffered pushes, oldest first. It returns false if one failed, after setting
+// the time of the next attempt.
+func (p *Pusher) flush(ctx context.Context) bool {
+	if time.Now().Before(p.nextAttempt) {
+		return false
+	}
+
+	for len(p.buffer) > 0 {
+		if err := p.send(ctx, p.buffer[0]); err != nil {
+			p.pushes.WithLabelValues("failure").Inc()
+			if p.backoff == 0 {
+				p.backoff = p.minBackoff
+			} else if p.backoff *= 2; p.backoff > p.maxBackoff {
+				p.backoff = p.maxBackoff
+			}
+			p.nextAttempt = time.Now().Add(p.backoff)
+			return false
+		}
+
+		p.pushes.WithLabelValues("success").Inc()
+		p.buffer = p.buffer[1:]
+		p.buffered.Set(float64(len(p.buffer)))
+		p.backoff = 0
+	}
+	return true
+}
+
+func (p *Pusher) send(ctx context.Context, payload pushPayload) error {
+	req, err := http.NewRequestWithContext(ctx, p.method, p.url, bytes.NewReader(payload.body))
+	if err != nil {
+		return err
+	}
+	for key, values := range p.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", payload.contentType)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status pushing to %s: %s", p.url, resp.Status)
+	}
+	return nil
+}
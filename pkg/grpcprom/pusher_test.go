@@ -0,0 +1,91 @@
+package grpcprom
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// pushGateway records the pushed bodies, failing the pushes while failing is set.
+type pushGateway struct {
+	mu      sync.Mutex
+	failing bool
+	bodies  []string
+	headers []http.Header
+}
+
+func (g *pushGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	g.bodies = append(g.bodies, string(body))
+	g.headers = append(g.headers, r.Header)
+}
+
+func TestPusher(t *testing.T) {
+	gateway := &pushGateway{failing: true}
+	srv := httptest.NewServer(gateway)
+	defer srv.Close()
+
+	calls := prom.NewCounter(prom.CounterOpts{Name: "demo_calls_total", Help: "Calls."})
+	reg := prom.NewRegistry()
+	reg.MustRegister(calls)
+
+	p := NewPusher(srv.URL, reg, WithPushBuffer(2), WithPushBackoff(time.Millisecond, time.Millisecond), WithPushHeader("Authorization", "Bearer demo"))
+	ctx := context.Background()
+
+	// The failed pushes are buffered, dropping the oldest one past the buffer size.
+	for i := 1; i <= 3; i++ {
+		calls.Inc()
+		p.enqueue()
+		if p.flush(ctx) {
+			t.Fatalf("push %d succeeded while the gateway is failing", i)
+		}
+		p.nextAttempt = time.Time{}
+	}
+	if got := testutil.ToFloat64(p.dropped); got != 1 {
+		t.Errorf("dropped %v pushes, want 1", got)
+	}
+	if got := testutil.ToFloat64(p.buffered); got != 2 {
+		t.Errorf("buffered %v pushes, want 2", got)
+	}
+
+	// The buffered pushes are sent oldest first once the gateway is back.
+	gateway.mu.Lock()
+	gateway.failing = false
+	gateway.mu.Unlock()
+	if !p.flush(ctx) {
+		t.Fatal("push failed while the gateway is up")
+	}
+
+	if len(gateway.bodies) != 2 {
+		t.Fatalf("got %d pushes, want 2", len(gateway.bodies))
+	}
+	for i, want := range []string{"demo_calls_total 2", "demo_calls_total 3"} {
+		if !strings.Contains(gateway.bodies[i], want) {
+			t.Errorf("push %d: got body %q, want %q", i, gateway.bodies[i], want)
+		}
+		if got := gateway.headers[i].Get("Authorization"); got != "Bearer demo" {
+			t.Errorf("push %d: got Authorization %q", i, got)
+		}
+	}
+	if got := testutil.ToFloat64(p.pushes.WithLabelValues("failure")); got != 3 {
+		t.Errorf("counted %v failed pushes, want 3", got)
+	}
+	if got := testutil.ToFloat64(p.pushes.WithLabelValues("success")); got != 2 {
+		t.Errorf("counted %v successful pushes, want 2", got)
+	}
+}
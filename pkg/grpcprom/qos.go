@@ -0,0 +1,103 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// PriorityMetadataKey is the metadata key carrying the priority, or QoS class, of a call.
+	PriorityMetadataKey = "x-priority"
+
+	// qosLabel is the label of the QoSLabelExtractor.
+	qosLabel = "qos"
+)
+
+// DefaultQoSClasses are the QoS classes of the QoSLabelExtractor when none is given. The first
+// one is the class of the calls without priority.
+var DefaultQoSClasses = []string{"interactive", "batch"}
+
+// QoSLabelExtractor is a LabelExtractor labeling the calls with the qos class read from the
+// PriorityMetadataKey metadata, so the latency SLOs of the interactive and batch traffic of
+// shared methods can be tracked independently.
+type QoSLabelExtractor struct {
+	classes []string
+}
+
+// NewQoSLabelExtractor returns a QoSLabelExtractor accepting the given classes, or the
+// DefaultQoSClasses. The calls without priority, or with an unknown one, get the first class,
+// so the label stays bounded.
+func NewQoSLabelExtractor(classes ...string) *QoSLabelExtractor {
+	if len(classes) == 0 {
+		classes = DefaultQoSClasses
+	}
+	return &QoSLabelExtractor{classes: classes}
+}
+
+// LabelNames returns the qos label
+func (e *QoSLabelExtractor) LabelNames() []string {
+	return []string{qosLabel}
+}
+
+// Labels returns the class of the priority of the call
+func (e *QoSLabelExtractor) Labels(ctx context.Context) map[string]string {
+	class := e.classes[0]
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(PriorityMetadataKey); len(values) > 0 {
+			for _, c := range e.classes {
+				if strings.EqualFold(values[0], c) {
+					class = c
+				}
+			}
+		}
+	}
+	return map[string]string{qosLabel: class}
+}
+
+// WithQoSHistograms makes the ServerMetrics export grpc_server_qos_handling_seconds, the handling
+// time of the calls of each QoS class with the buckets of the class, e.g. milliseconds for the
+// interactive calls and minutes for the batch ones. The class is read from the qos label, so
+// NewServerMetrics panics if the LabelExtractor doesn't declare it, e.g. with a
+// QoSLabelExtractor. The calls of classes without buckets are not recorded.
+func WithQoSHistograms(buckets map[string][]float64) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.qosHistograms = make(map[string]*prom.HistogramVec, len(buckets))
+		for class, classBuckets := range buckets {
+			m.qosHistograms[class] = prom.NewHistogramVec(
+				prom.HistogramOpts{
+					Name:        "grpc_server_qos_handling_seconds",
+					Help:        "Histogram of response latency (seconds) of the gRPC calls of each QoS class, with the buckets of the class.",
+					Buckets:     classBuckets,
+					ConstLabels: prom.Labels{qosLabel: class},
+				}, []string{"grpc_service", "grpc_method", "grpc_status"},
+			)
+		}
+	}
+}
+
+// checkQoSLabel panics if the QoS histograms are enabled without the qos label.
+func (m *ServerMetrics) checkQoSLabel() {
+	if m.qosHistograms == nil {
+		return
+	}
+	for _, labelName := range m.labels {
+		if labelName == qosLabel {
+			return
+		}
+	}
+	panic(fmt.Sprintf("QoS histograms need the %s label, not one of the labels %v", qosLabel, m.labels))
+}
+
+// observeQoS records the handling time of an RPC in the histogram of its QoS class.
+func (m *ServerMetrics) observeQoS(labels map[string]string, elapsed time.Duration) {
+	histogram, ok := m.qosHistograms[labels[qosLabel]]
+	if !ok {
+		return
+	}
+	histogram.WithLabelValues(labels["grpc_service"], labels["grpc_method"], labels["grpc_status"]).Observe(elapsed.Seconds())
+}
@@ -0,0 +1,100 @@
+package grpcprom
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// SendTimeKey is the metadata key carrying the time, in Unix nanoseconds, the client sent the
+// RPC. It is set by SendTimeUnaryClientInterceptor.
+const SendTimeKey = "x-client-send-time"
+
+// QueueDelayMetrics records in grpc_server_queue_delay_seconds the time between the client
+// sending an RPC and its handler starting, which is the network and server queueing time apart
+// from the handling time. The clocks of the client and the server are not synchronized, so the
+// delays which are negative or above maxSkew are not observed but counted in
+// grpc_server_queue_delay_skewed_total.
+type QueueDelayMetrics struct {
+	maxSkew time.Duration
+	delay   *prom.HistogramVec
+	skewed  *prom.CounterVec
+}
+
+// NewQueueDelayMetrics returns the QueueDelayMetrics discarding the delays above maxSkew.
+func NewQueueDelayMetrics(maxSkew time.Duration) *QueueDelayMetrics {
+	labels := []string{"grpc_service", "grpc_method"}
+	return &QueueDelayMetrics{
+		maxSkew: maxSkew,
+		delay: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_server_queue_delay_seconds",
+				Help:    "Histogram of the time (seconds) between the client sending the RPCs and the server handling them.",
+				Buckets: LatencyFastBuckets,
+			}, labels,
+		),
+		skewed: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_queue_delay_skewed_total",
+				Help: "Total number of RPCs whose queue delay was discarded because of the clock skew.",
+			}, labels,
+		),
+	}
+}
+
+// Describe describes the queue delay metrics.
+func (m *QueueDelayMetrics) Describe(ch chan<- *prom.Desc) {
+	m.delay.Describe(ch)
+	m.skewed.Describe(ch)
+}
+
+// Collect collects the queue delay metrics.
+func (m *QueueDelayMetrics) Collect(ch chan<- prom.Metric) {
+	m.delay.Collect(ch)
+	m.skewed.Collect(ch)
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor recording the queue delay of the RPCs
+// carrying the SendTimeKey metadata.
+func (m *QueueDelayMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if sent, ok := sendTime(ctx); ok {
+			service, method := splitMethodName(info.FullMethod)
+			delay := time.Since(sent)
+			if delay < 0 || delay > m.maxSkew {
+				m.skewed.WithLabelValues(service, method).Inc()
+			} else {
+				m.delay.WithLabelValues(service, method).Observe(delay.Seconds())
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// sendTime returns the send time of the RPC from the incoming metadata.
+func sendTime(ctx context.Context) (time.Time, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(SendTimeKey)
+	if len(values) == 0 {
+		return time.Time{}, false
+	}
+
+	nanos, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// SendTimeUnaryClientInterceptor is a gRPC client-side interceptor sending the time of every
+// RPC in the SendTimeKey metadata, for the QueueDelayMetrics of the server.
+func SendTimeUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, SendTimeKey, strconv.FormatInt(time.Now().UnixNano(), 10))
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
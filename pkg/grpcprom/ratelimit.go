@@ -0,0 +1,198 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+)
+
+// RateLimiter is a unary server interceptor enforcing a token bucket per value of a custom
+// label, e.g. one quota per tenant or userName. The key is the label value of the RPC metrics of
+// the ServerMetrics, sanitized, conformed to its LabelSchema and redacted, so quota enforcement and
+// quota observability share the same bounded labels. Throttled RPCs are rejected with
+// ResourceExhausted, with a RetryInfo detail carrying the time until the bucket of their key has a
+// token again, and counted in grpc_server_backpressure_signaled_total by method.
+//
+// The buckets idle for long enough to be full again are evicted, since they are the same as new
+// ones. At most maxRateLimiterKeys buckets are kept: the new keys seen past that share one bucket
+// until idle buckets are evicted.
+type RateLimiter struct {
+	metrics   *ServerMetrics
+	label     string
+	limit     rate.Limit
+	burst     int
+	keyLimits map[string]*rate.Limiter
+
+	mu        sync.Mutex
+	limiters  map[string]*keyBucket
+	overflow  *rate.Limiter
+	lastSweep time.Time
+
+	allowed      *prom.CounterVec
+	throttled    *prom.CounterVec
+	backpressure *prom.CounterVec
+}
+
+// maxRateLimiterKeys bounds the token buckets kept by a RateLimiter.
+const maxRateLimiterKeys = 10000
+
+// minSweepInterval bounds how often the idle buckets of a RateLimiter are evicted while it has
+// fewer than maxRateLimiterKeys buckets.
+const minSweepInterval = time.Second
+
+// keyBucket is the token bucket of a key, with the last time it was used.
+type keyBucket struct {
+	limiter  *rate.Limiter
+	lastUsed time.Time
+}
+
+// RateLimiterOption configures the RateLimiter returned by NewRateLimiter.
+type RateLimiterOption func(*RateLimiter)
+
+// WithKeyLimit overrides the quota of one key of the RateLimiter.
+func WithKeyLimit(key string, qps float64, burst int) RateLimiterOption {
+	return func(l *RateLimiter) {
+		l.keyLimits[key] = rate.NewLimiter(rate.Limit(qps), burst)
+	}
+}
+
+// NewRateLimiter returns a RateLimiter allowing qps requests per second, with bursts of burst
+// requests, for each value of the label of the metrics. RPCs without the label share the bucket of
+// its default value. It panics if the metrics don't have the label.
+func NewRateLimiter(metrics *ServerMetrics, label string, qps float64, burst int, opts ...RateLimiterOption) *RateLimiter {
+	if !containsLabel(metrics.labels, label) {
+		panic(fmt.Sprintf("grpcprom: the server metrics have no %q label to rate limit", label))
+	}
+
+	labels := []string{"grpc_service", "grpc_method", label}
+	l := &RateLimiter{
+		metrics:   metrics,
+		label:     label,
+		limit:     rate.Limit(qps),
+		burst:     burst,
+		keyLimits: map[string]*rate.Limiter{},
+		limiters:  map[string]*keyBucket{},
+		overflow:  rate.NewLimiter(rate.Limit(qps), burst),
+		allowed: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_rate_limit_allowed_total",
+				Help: "Total number of RPCs allowed by the rate limiter.",
+			}, labels,
+		),
+		throttled: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_rate_limit_throttled_total",
+				Help: "Total number of RPCs throttled by the rate limiter.",
+			}, labels,
+		),
+		backpressure: newBackpressureCounter("rate"),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Describe describes the rate limiter metrics.
+func (l *RateLimiter) Describe(ch chan<- *prom.Desc) {
+	l.allowed.Describe(ch)
+	l.throttled.Describe(ch)
+	l.backpressure.Describe(ch)
+}
+
+// Collect collects the rate limiter metrics.
+func (l *RateLimiter) Collect(ch chan<- prom.Metric) {
+	l.allowed.Collect(ch)
+	l.throttled.Collect(ch)
+	l.backpressure.Collect(ch)
+}
+
+// limiter returns the token bucket of the key, creating it on first use, or the overflow bucket
+// when the RateLimiter has maxRateLimiterKeys busy buckets.
+func (l *RateLimiter) limiter(key string) *rate.Limiter {
+	if limiter, ok := l.keyLimits[key]; ok {
+		return limiter
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bucket, ok := l.limiters[key]; ok {
+		bucket.lastUsed = now
+		return bucket.limiter
+	}
+
+	if len(l.limiters) >= maxRateLimiterKeys || now.Sub(l.lastSweep) >= max(l.refillTime(), minSweepInterval) {
+		l.evictIdle(now)
+	}
+	if len(l.limiters) >= maxRateLimiterKeys {
+		return l.overflow
+	}
+	limiter := rate.NewLimiter(l.limit, l.burst)
+	l.limiters[key] = &keyBucket{limiter: limiter, lastUsed: now}
+	return limiter
+}
+
+// refillTime returns the time an unused bucket takes to be full again, or a negative duration if
+// it never refills.
+func (l *RateLimiter) refillTime() time.Duration {
+	switch {
+	case l.limit == rate.Inf:
+		return 0
+	case l.limit <= 0:
+		return -1
+	}
+	return time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+}
+
+// evictIdle deletes the buckets unused for their refill time, which are full and so the same as
+// new ones. The buckets which never refill are never evicted.
+func (l *RateLimiter) evictIdle(now time.Time) {
+	l.lastSweep = now
+	refill := l.refillTime()
+	if refill < 0 {
+		return
+	}
+	for key, bucket := range l.limiters {
+		if now.Sub(bucket.lastUsed) >= refill {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+// retryDelay returns the time until the token bucket has a token again.
+func retryDelay(limiter *rate.Limiter) time.Duration {
+	if limiter.Limit() <= 0 {
+		return defaultRetryDelay
+	}
+	missing := 1 - limiter.Tokens()
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / float64(limiter.Limit()) * float64(time.Second))
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor enforcing the quotas. Put it after the
+// ServerMetrics interceptor so the throttled RPCs are also counted as handled.
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// The interceptors of the ServerMetrics already recorded the labels in the label audit.
+		labels := l.metrics.rpcLabels(contextWithRequest(ctx, req), info.FullMethod, false)
+		service, method, key := labels["grpc_service"], labels["grpc_method"], labels[l.label]
+
+		limiter := l.limiter(key)
+		if !limiter.Allow() {
+			l.throttled.WithLabelValues(service, method, key).Inc()
+			l.backpressure.WithLabelValues(service, method).Inc()
+			return nil, backpressureError(retryDelay(limiter), "rate limit exceeded for %s %q", l.label, key)
+		}
+		l.allowed.WithLabelValues(service, method, key).Inc()
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,121 @@
+package grpcprom_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type userNameKey struct{}
+
+// userNameExtractor labels the RPCs with the userName of their context.
+type userNameExtractor struct{}
+
+func (userNameExtractor) LabelNames() []string {
+	return []string{"userName"}
+}
+
+func (userNameExtractor) Labels(ctx context.Context) map[string]string {
+	if userName, ok := ctx.Value(userNameKey{}).(string); ok {
+		return map[string]string{"userName": userName}
+	}
+	return map[string]string{}
+}
+
+func TestNewRateLimiterUnknownLabel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic with a label the server metrics don't have")
+		}
+	}()
+	grpcprom.NewRateLimiter(grpcprom.NewServerMetrics(userNameExtractor{}), "tenant", 1, 1)
+}
+
+func TestRateLimiterRedactedKeys(t *testing.T) {
+	m := grpcprom.NewServerMetrics(userNameExtractor{}, grpcprom.WithRedaction(grpcprom.RedactEmails))
+	l := grpcprom.NewRateLimiter(m, "userName", 0, 1)
+	reg := newRegistry(t, l)
+
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/demo.v1.Greeter/SayHello"}
+	// Both emails are redacted, so they share the bucket of the redacted key.
+	for i, userName := range []string{"bob@example.com", "alice@example.com", "bob@example.com"} {
+		ctx := context.WithValue(context.Background(), userNameKey{}, userName)
+		_, err := l.UnaryServerInterceptor()(ctx, nil, info, handler)
+		if want := codes.ResourceExhausted; i > 0 && status.Code(err) != want {
+			t.Errorf("call %d: got code %v, want %v", i, status.Code(err), want)
+		}
+	}
+
+	assertMetrics(t, reg, `
+# HELP grpc_server_backpressure_signaled_total Total number of RPCs rejected with a retry delay, by limiter and method.
+# TYPE grpc_server_backpressure_signaled_total counter
+grpc_server_backpressure_signaled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",limiter="rate"} 2
+# HELP grpc_server_rate_limit_allowed_total Total number of RPCs allowed by the rate limiter.
+# TYPE grpc_server_rate_limit_allowed_total counter
+grpc_server_rate_limit_allowed_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",userName="redacted"} 1
+# HELP grpc_server_rate_limit_throttled_total Total number of RPCs throttled by the rate limiter.
+# TYPE grpc_server_rate_limit_throttled_total counter
+grpc_server_rate_limit_throttled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",userName="redacted"} 2
+`, "grpc_server_backpressure_signaled_total", "grpc_server_rate_limit_allowed_total", "grpc_server_rate_limit_throttled_total")
+}
+
+// rateLimit calls the interceptor of the rate limiter for the userName and returns whether the
+// RPC was allowed.
+func rateLimit(l *grpcprom.RateLimiter, userName string) bool {
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	ctx := context.WithValue(context.Background(), userNameKey{}, userName)
+	_, err := l.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/demo.v1.Greeter/SayHello"}, handler)
+	return err == nil
+}
+
+func TestRateLimiterBoundedBuckets(t *testing.T) {
+	const maxKeys = 10000
+
+	tests := []struct {
+		name string
+		qps  float64
+		wait time.Duration
+		// shared tells whether the keys past maxKeys share a bucket.
+		shared bool
+	}{
+		{
+			name:   "busy buckets",
+			qps:    0,
+			shared: true,
+		},
+		{
+			name: "idle buckets",
+			qps:  1000,
+			wait: 10 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(userNameExtractor{})
+			l := grpcprom.NewRateLimiter(m, "userName", tt.qps, 1)
+			for i := 0; i < maxKeys; i++ {
+				rateLimit(l, fmt.Sprintf("user%d", i))
+			}
+			time.Sleep(tt.wait)
+
+			if !rateLimit(l, "alice") {
+				t.Error("first RPC of alice throttled")
+			}
+			if got := rateLimit(l, "bob"); got == tt.shared {
+				t.Errorf("first RPC of bob allowed: %v, want %v", got, !tt.shared)
+			}
+		})
+	}
+}
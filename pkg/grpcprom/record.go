@@ -0,0 +1,37 @@
+package grpcprom
+
+import (
+	"context"
+	"time"
+)
+
+// Record records an operation handled outside of the gRPC, connect or Twirp servers, like a
+// message consumed from a queue or a call of an internal dispatcher, in the same metric families
+// as the RPCs. fullMethod (/package.Service/Method) goes through the WithMethodAllowlist and
+// WithMethodRewrites rules, code is the grpc_status label, e.g. codes.OK.String(), and labels are
+// the custom labels, which take the default value when missing.
+func (m *ServerMetrics) Record(fullMethod, code string, labels map[string]string, duration time.Duration) {
+	metricLabels := make(map[string]string, len(m.labels))
+	for name, value := range labels {
+		metricLabels[name] = value
+	}
+	if m.labelSchema != nil {
+		m.labelSchema.conform(metricLabels)
+	}
+	for _, labelName := range m.labels {
+		if _, ok := metricLabels[labelName]; !ok {
+			metricLabels[labelName] = m.labelSchema.defaultValue(labelName)
+		}
+	}
+	m.redact(metricLabels)
+
+	// The grpc labels can't be overridden by the custom ones.
+	service, method := m.methodLabels(fullMethod)
+	metricLabels["grpc_service"] = service
+	metricLabels["grpc_method"] = method
+	metricLabels["grpc_status"] = code
+
+	r := newServerReporter(context.Background(), m, fullMethod, metricLabels)
+	r.startTime = time.Now().Add(-duration)
+	r.handled(duration)
+}
@@ -0,0 +1,72 @@
+package grpcprom
+
+import (
+	"regexp"
+)
+
+// redactedValue replaces the label values redacted by the rules without replacement.
+const redactedValue = "redacted"
+
+// maxRedactionPasses bounds the passes of a rule over a value. A replacement can complete a new
+// match, like the first pass over "a@b.c@d.e" which gives "redacted@d.e", but a replacement
+// matching the pattern itself must not loop forever.
+const maxRedactionPasses = 8
+
+// RedactionRule redacts the values of the Label label, or of every label when it is empty. The
+// parts of the value matching Pattern are replaced with Replacement, or the whole value when
+// Pattern is nil. An empty Replacement stands for "redacted".
+type RedactionRule struct {
+	Label       string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+var (
+	// RedactEmails replaces the email addresses in every label.
+	RedactEmails = RedactionRule{Pattern: regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`)}
+
+	// RedactBearerTokens replaces the bearer tokens in every label.
+	RedactBearerTokens = RedactionRule{Pattern: regexp.MustCompile(`(?i)bearer\s+\S+`)}
+)
+
+// WithRedaction makes the ServerMetrics apply the rules, in order, to the extracted labels, so
+// emails, tokens or other PII which end up in the metadata never become Prometheus series.
+func WithRedaction(rules ...RedactionRule) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.redactions = append(m.redactions, rules...)
+	}
+}
+
+// redact applies the redaction rules to the labels in place.
+func (m *ServerMetrics) redact(labels map[string]string) {
+	for _, rule := range m.redactions {
+		replacement := rule.Replacement
+		if replacement == "" {
+			replacement = redactedValue
+		}
+
+		for name, value := range labels {
+			if rule.Label != "" && rule.Label != name {
+				continue
+			}
+			if rule.Pattern == nil {
+				labels[name] = replacement
+			} else {
+				labels[name] = redactValue(rule.Pattern, value, replacement)
+			}
+		}
+	}
+}
+
+// redactValue replaces the parts of the value matching the pattern until none is left, or for
+// maxRedactionPasses passes.
+func redactValue(pattern *regexp.Regexp, value, replacement string) string {
+	for i := 0; i < maxRedactionPasses && pattern.MatchString(value); i++ {
+		redacted := pattern.ReplaceAllLiteralString(value, replacement)
+		if redacted == value {
+			break
+		}
+		value = redacted
+	}
+	return value
+}
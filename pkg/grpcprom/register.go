@@ -0,0 +1,111 @@
+package grpcprom
+
+import (
+	"errors"
+	"fmt"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Register registers the ServerMetrics with every registerer, e.g. the default registry and the
+// one of a plugin. When a registerer already has a ServerMetrics with the same metrics, like the
+// one of a server created before, the ServerMetrics adopts its metrics instead of failing, so
+// both record into the same series. Adoption only happens on the first registerer the
+// ServerMetrics is registered with and fails once it served an RPC, since the interceptors read
+// the adopted metrics without locking; Register must not run concurrently with the RPCs.
+// Registering it twice with the same registerer is not an error.
+func (m *ServerMetrics) Register(regs ...prom.Registerer) error {
+	m.registerMu.Lock()
+	defer m.registerMu.Unlock()
+
+	m.unregistered = false
+	for _, reg := range regs {
+		err := reg.Register(m)
+
+		var are prom.AlreadyRegisteredError
+		switch {
+		case err == nil:
+			m.registerers = append(m.registerers, reg)
+		case errors.As(err, &are):
+			existing, ok := are.ExistingCollector.(*ServerMetrics)
+			switch {
+			case !ok:
+				return err
+			case existing == m, existing == m.adopted:
+			case len(m.registerers) > 0 || m.adopted != nil:
+				return err
+			case m.served.Load():
+				return fmt.Errorf("can't adopt the registered metrics after serving RPCs: %w", err)
+			default:
+				m.adopt(existing)
+			}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// adopt makes the ServerMetrics record in the metrics of the existing one, which stay registered
+// until both are unregistered.
+func (m *ServerMetrics) adopt(existing *ServerMetrics) {
+	existing.registerMu.Lock()
+	existing.adopters++
+	existing.registerMu.Unlock()
+	m.adopted = existing
+
+	m.sink = existing.sink
+	m.serverHandledCounter = existing.serverHandledCounter
+	m.serverHandledHistogram = existing.serverHandledHistogram
+	m.slo = existing.slo
+	m.window = existing.window
+	m.deadlineHistogram = existing.deadlineHistogram
+	m.statusDetails = existing.statusDetails
+	m.activeHandlers = existing.activeHandlers
+	m.rpcCounters = existing.rpcCounters
+	m.resultHistograms = existing.resultHistograms
+	m.qosHistograms = existing.qosHistograms
+	m.deprecatedCalls = existing.deprecatedCalls
+	m.gcAffected = existing.gcAffected
+	if m.idempotency != nil && existing.idempotency != nil {
+		m.idempotency.hits = existing.idempotency.hits
+		m.idempotency.misses = existing.idempotency.misses
+	}
+}
+
+// Unregister unregisters the ServerMetrics from all the registerers it was registered with by
+// Register, so dynamically created servers, like the ones of tests or plugins, don't leak their
+// collectors. The metrics adopted by other ServerMetrics stay registered until the last of them
+// is unregistered too. It reports whether it was unregistered from all of them.
+func (m *ServerMetrics) Unregister() bool {
+	m.registerMu.Lock()
+	defer m.registerMu.Unlock()
+
+	m.unregistered = true
+	if m.adopters > 0 {
+		return true
+	}
+	return m.release()
+}
+
+// release unregisters the ServerMetrics and releases the metrics it adopted, with registerMu
+// held.
+func (m *ServerMetrics) release() bool {
+	unregistered := true
+	for _, reg := range m.registerers {
+		unregistered = reg.Unregister(m) && unregistered
+	}
+	m.registerers = nil
+
+	if adopted := m.adopted; adopted != nil {
+		m.adopted = nil
+
+		adopted.registerMu.Lock()
+		defer adopted.registerMu.Unlock()
+		adopted.adopters--
+		if adopted.adopters == 0 && adopted.unregistered {
+			unregistered = adopted.release() && unregistered
+		}
+	}
+	return unregistered
+}
@@ -0,0 +1,54 @@
+package grpcprom_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterAdoptedMetricsStayRegistered(t *testing.T) {
+	const fullMethod = "/demo.v1.Greeter/SayHello"
+
+	reg := prom.NewRegistry()
+	first := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+	second := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+	if err := first.Register(reg); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Register(reg); err != nil {
+		t.Fatal(err)
+	}
+
+	callUnary(first, context.Background(), nil, fullMethod, nil)
+	callUnary(second, context.Background(), nil, fullMethod, nil)
+
+	// The second ServerMetrics still records in the metrics of the first one.
+	if !first.Unregister() {
+		t.Error("first ServerMetrics not unregistered")
+	}
+	callUnary(second, context.Background(), nil, fullMethod, nil)
+	assertMetrics(t, reg, handledHeader+`
+grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK"} 3
+`, "grpc_server_handled_total")
+
+	if !second.Unregister() {
+		t.Error("second ServerMetrics not unregistered")
+	}
+	assertMetrics(t, reg, "", "grpc_server_handled_total")
+}
+
+func TestRegisterNoAdoptionAfterRPCs(t *testing.T) {
+	reg := prom.NewRegistry()
+	first := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+	second := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+	if err := first.Register(reg); err != nil {
+		t.Fatal(err)
+	}
+
+	callUnary(second, context.Background(), nil, "/demo.v1.Greeter/SayHello", nil)
+	if err := second.Register(reg); err == nil {
+		t.Error("metrics adopted after serving an RPC")
+	}
+}
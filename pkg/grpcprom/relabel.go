@@ -0,0 +1,15 @@
+package grpcprom
+
+// Relabeler rewrites the labels of an RPC right before they are recorded. It gets the
+// grpc_service, grpc_method and grpc_status labels along the custom ones.
+type Relabeler func(labels map[string]string) map[string]string
+
+// WithRelabeler makes the ServerMetrics pass the labels of every RPC through relabel before
+// recording them, to rename, drop or derive labels without forking the interceptors. Only the
+// labels declared by the LabelExtractor are recorded: the extra ones are ignored and the missing
+// ones get the empty value.
+func WithRelabeler(relabel Relabeler) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.relabel = relabel
+	}
+}
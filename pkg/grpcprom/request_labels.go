@@ -0,0 +1,53 @@
+package grpcprom
+
+import (
+	"context"
+)
+
+// requestKey is the context key of the request message handled by the interceptors.
+type requestKey struct{}
+
+// contextWithRequest returns a copy of ctx carrying the request message, so the label extractors
+// can label the metrics with its fields.
+func contextWithRequest(ctx context.Context, req interface{}) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// RequestFromContext returns the request message of the RPC being handled, or nil when the
+// context does not come from a unary interceptor.
+func RequestFromContext(ctx context.Context) interface{} {
+	return ctx.Value(requestKey{})
+}
+
+// MessageLabeler is implemented by the request messages with fields annotated with the
+// (metrics.label) option. The RequestLabels methods are generated by protoc-gen-grpcprom; they
+// are not named like ErrorLabeler.MetricLabels so a message can't be mistaken for an error
+// labeler, or the other way around.
+type MessageLabeler interface {
+	RequestLabels() map[string]string
+}
+
+// RequestLabelExtractor is a LabelExtractor returning the labels of the request message when it
+// is a MessageLabeler. Every label missing from the message gets the default value.
+type RequestLabelExtractor struct {
+	labelNames []string
+}
+
+// NewRequestLabelExtractor returns a RequestLabelExtractor exposing the given labels. The code
+// generated by protoc-gen-grpcprom creates one per service with the labels of its messages.
+func NewRequestLabelExtractor(labelNames ...string) *RequestLabelExtractor {
+	return &RequestLabelExtractor{labelNames: labelNames}
+}
+
+// LabelNames returns the names of the labels annotated on the request messages
+func (e *RequestLabelExtractor) LabelNames() []string {
+	return e.labelNames
+}
+
+// Labels returns the labels of the request message in the context
+func (e *RequestLabelExtractor) Labels(ctx context.Context) map[string]string {
+	if l, ok := RequestFromContext(ctx).(MessageLabeler); ok {
+		return l.RequestLabels()
+	}
+	return map[string]string{}
+}
@@ -0,0 +1,62 @@
+package grpcprom
+
+import (
+	"fmt"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// startsKey is the StateStore key of the number of times the process started.
+const startsKey = "starts"
+
+// RestartCollector is a prometheus collector exporting the start time of the process and the
+// number of times it restarted, making crash loops visible from the metrics endpoint alone.
+type RestartCollector struct {
+	startTime time.Time
+	restarts  float64
+
+	startTimeDesc *prom.Desc
+	restartsDesc  *prom.Desc
+}
+
+// NewRestartCollector returns a RestartCollector counting the starts of the process in store. The
+// count is saved right away, so crashing processes are counted too. The store must not be shared
+// with a PersistentGatherer, which would save the restarts as its own counter.
+func NewRestartCollector(store StateStore) (*RestartCollector, error) {
+	values, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading the starts: %w", err)
+	}
+	values[startsKey]++
+	if err := store.Save(values); err != nil {
+		return nil, fmt.Errorf("saving the starts: %w", err)
+	}
+
+	return &RestartCollector{
+		startTime: time.Now(),
+		restarts:  values[startsKey] - 1,
+		startTimeDesc: prom.NewDesc(
+			"grpc_server_start_time_seconds",
+			"Start time of the process since unix epoch in seconds.",
+			nil, nil,
+		),
+		restartsDesc: prom.NewDesc(
+			"grpc_server_restarts_total",
+			"Total number of times the process restarted, persisted in the state store.",
+			nil, nil,
+		),
+	}, nil
+}
+
+// Describe describes the start time and restart metrics.
+func (c *RestartCollector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.startTimeDesc
+	ch <- c.restartsDesc
+}
+
+// Collect collects the start time and restart metrics.
+func (c *RestartCollector) Collect(ch chan<- prom.Metric) {
+	ch <- prom.MustNewConstMetric(c.startTimeDesc, prom.GaugeValue, float64(c.startTime.UnixNano())/1e9)
+	ch <- prom.MustNewConstMetric(c.restartsDesc, prom.CounterValue, c.restarts)
+}
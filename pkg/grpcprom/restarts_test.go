@@ -0,0 +1,27 @@
+package grpcprom_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestRestartCollector(t *testing.T) {
+	store := grpcprom.NewFileStateStore(filepath.Join(t.TempDir(), "starts.json"))
+
+	var c *grpcprom.RestartCollector
+	for i := 0; i < 3; i++ {
+		var err error
+		if c, err = grpcprom.NewRestartCollector(store); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first start is not a restart.
+	assertMetrics(t, newRegistry(t, c), `
+# HELP grpc_server_restarts_total Total number of times the process restarted, persisted in the state store.
+# TYPE grpc_server_restarts_total counter
+grpc_server_restarts_total 2
+`, "grpc_server_restarts_total")
+}
@@ -0,0 +1,89 @@
+package grpcprom
+
+import (
+	"context"
+	"sync"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// rpcCounterOpts is a per-RPC counter declared with WithRPCCounter.
+type rpcCounterOpts struct {
+	name string
+	help string
+}
+
+// WithRPCCounter declares a per-RPC business-value counter, e.g. grpc_server_rows_returned_total
+// or grpc_server_bytes_billed_total, with the same labels as the RPC metrics. The handlers add
+// to it with AddRPCValue and the value is counted once the RPC is handled, with its final
+// labels, so it never drifts from the RPC labels like an ad-hoc CounterVec does.
+func WithRPCCounter(name, help string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.rpcCounterOpts = append(m.rpcCounterOpts, rpcCounterOpts{name: name, help: help})
+	}
+}
+
+// newRPCCounters creates the counters declared with WithRPCCounter.
+func (m *ServerMetrics) newRPCCounters() {
+	if len(m.rpcCounterOpts) == 0 {
+		return
+	}
+
+	m.rpcCounters = make(map[string]*prom.CounterVec, len(m.rpcCounterOpts))
+	for _, opts := range m.rpcCounterOpts {
+		m.rpcCounters[opts.name] = prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: opts.name,
+				Help: opts.help,
+			}, m.labels,
+		)
+	}
+}
+
+type rpcValuesKey struct{}
+
+// rpcValues are the values added to the per-RPC counters by the handler of an RPC.
+type rpcValues struct {
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// contextWithRPCValues returns the context to give to the handler, which the handler adds the
+// per-RPC counter values to, when the ServerMetrics declares any.
+func (m *ServerMetrics) contextWithRPCValues(ctx context.Context, r *serverReporter) context.Context {
+	if m.rpcCounters == nil {
+		return ctx
+	}
+	r.values = &rpcValues{values: map[string]float64{}}
+	return context.WithValue(ctx, rpcValuesKey{}, r.values)
+}
+
+// AddRPCValue adds v to the per-RPC counter declared with WithRPCCounter, for the RPC handled
+// with the context. It does nothing for undeclared counters or contexts of other RPCs.
+func AddRPCValue(ctx context.Context, counterName string, v float64) {
+	values, ok := ctx.Value(rpcValuesKey{}).(*rpcValues)
+	if !ok {
+		return
+	}
+
+	values.mu.Lock()
+	defer values.mu.Unlock()
+
+	values.values[counterName] += v
+}
+
+// countRPCValues adds the values of a handled RPC to the per-RPC counters.
+func (m *ServerMetrics) countRPCValues(labels map[string]string, values *rpcValues) {
+	if values == nil {
+		return
+	}
+
+	values.mu.Lock()
+	defer values.mu.Unlock()
+
+	for name, v := range values.values {
+		if counter, ok := m.rpcCounters[name]; ok && v > 0 {
+			counter.With(labels).Add(v)
+		}
+	}
+}
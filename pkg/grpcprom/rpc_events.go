@@ -0,0 +1,93 @@
+package grpcprom
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// RPCEvents is a bounded stream of the RPCs recorded by the ServerMetrics, for the consumers
+// needing the raw events, like billing or sampling-based analytics, without another
+// interceptor. The events are dropped, and counted in grpc_server_rpc_events_dropped_total,
+// when the consumer doesn't keep up, so it never slows the RPCs down.
+type RPCEvents struct {
+	events  chan RPCRecord
+	dropped prom.Counter
+}
+
+// NewRPCEvents returns an RPCEvents buffering up to size events.
+func NewRPCEvents(size int) *RPCEvents {
+	return &RPCEvents{
+		events: make(chan RPCRecord, size),
+		dropped: prom.NewCounter(
+			prom.CounterOpts{
+				Name: "grpc_server_rpc_events_dropped_total",
+				Help: "Total number of RPC events dropped because the consumer didn't keep up.",
+			},
+		),
+	}
+}
+
+// WithRPCEvents makes the ServerMetrics send every recorded RPC to events.
+func WithRPCEvents(events *RPCEvents) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.events = events
+	}
+}
+
+// Events returns the channel of the events. It is never closed.
+func (e *RPCEvents) Events() <-chan RPCRecord {
+	return e.events
+}
+
+// WriteJSONLines writes the events to w as JSON lines, the same ones as WithRPCRecording, until
+// the context is done or writing fails.
+func (e *RPCEvents) WriteJSONLines(ctx context.Context, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case event := <-e.events:
+			if err := enc.Encode(event); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// send sends the event, or drops it when the buffer is full.
+func (e *RPCEvents) send(event RPCRecord) {
+	select {
+	case e.events <- event:
+	default:
+		e.dropped.Inc()
+	}
+}
+
+// Describe describes the dropped events counter.
+func (e *RPCEvents) Describe(ch chan<- *prom.Desc) {
+	e.dropped.Describe(ch)
+}
+
+// Collect collects the dropped events counter.
+func (e *RPCEvents) Collect(ch chan<- prom.Metric) {
+	e.dropped.Collect(ch)
+}
+
+// sendRPCEvent sends the event of an RPC when the event stream is enabled.
+func (m *ServerMetrics) sendRPCEvent(fullMethod string, labels map[string]string, status string, elapsed time.Duration, now time.Time) {
+	if m.events == nil {
+		return
+	}
+	m.events.send(RPCRecord{
+		Time:       now,
+		FullMethod: fullMethod,
+		Labels:     labels,
+		Duration:   elapsed,
+		Code:       status,
+	})
+}
@@ -0,0 +1,124 @@
+package grpcprom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// RPCRecord is one RPC recorded by the ServerMetrics, as written by WithRPCRecording and sent to
+// the RPCEvents.
+type RPCRecord struct {
+	// Time is when the RPC finished.
+	Time time.Time `json:"time"`
+	// FullMethod is the full method of the RPC (/package.Service/Method), before the rewrites,
+	// allowlist and relabeling of its labels.
+	FullMethod string `json:"full_method,omitempty"`
+	// Labels are the labels the RPC was recorded with.
+	Labels map[string]string `json:"labels"`
+	// Duration is the handling time of the RPC.
+	Duration time.Duration `json:"duration"`
+	// Code is the status code of the RPC, before WithCollapsedCodes is applied.
+	Code string `json:"code"`
+}
+
+// rpcRecorder writes the RPC records as JSON lines.
+type rpcRecorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// WithRPCRecording makes the ServerMetrics write every recorded RPC to w as a JSON line, to
+// capture the shape of the production traffic and replay it offline with ReplayRPCs. Write
+// errors are ignored, so w should be reliable; a bufio.Writer must be flushed once the server
+// is stopped.
+func WithRPCRecording(w io.Writer) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.recorder = &rpcRecorder{enc: json.NewEncoder(w)}
+	}
+}
+
+// recordRPC writes the record of an RPC when the recording is enabled.
+func (m *ServerMetrics) recordRPC(fullMethod string, labels map[string]string, status string, elapsed time.Duration, now time.Time) {
+	if m.recorder == nil {
+		return
+	}
+
+	m.recorder.mu.Lock()
+	defer m.recorder.mu.Unlock()
+
+	_ = m.recorder.enc.Encode(RPCRecord{
+		Time:       now,
+		FullMethod: fullMethod,
+		Labels:     labels,
+		Duration:   elapsed,
+		Code:       status,
+	})
+}
+
+// ReplayRPCs reads the RPC records written by WithRPCRecording from r and records them again in
+// the ServerMetrics, e.g. one registered in a test Prometheus, to develop dashboards and alerts
+// with captured production shapes. The records are replayed at speed times the pace they were
+// recorded at, or as fast as possible when speed is 0. Labels missing from the records take the
+// default value.
+func ReplayRPCs(ctx context.Context, r io.Reader, m *ServerMetrics, speed float64) error {
+	dec := json.NewDecoder(r)
+
+	var last time.Time
+	for {
+		var record RPCRecord
+		if err := dec.Decode(&record); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("decoding the RPC records: %w", err)
+		}
+
+		if speed > 0 && !last.IsZero() && record.Time.After(last) {
+			timer := time.NewTimer(time.Duration(float64(record.Time.Sub(last)) / speed))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+		last = record.Time
+
+		m.replay(record)
+	}
+}
+
+// replay records the RPC in the sink, the SLOs, the stats window and the result histograms.
+func (m *ServerMetrics) replay(record RPCRecord) {
+	labels := make(map[string]string, len(m.labels))
+	for _, labelName := range m.labels {
+		value, ok := record.Labels[labelName]
+		if !ok {
+			value = m.labelSchema.defaultValue(labelName)
+		}
+		labels[labelName] = value
+	}
+
+	// The records written before the full method was recorded only have the labels.
+	fullMethod := record.FullMethod
+	if fullMethod == "" {
+		fullMethod = "/" + labels["grpc_service"] + "/" + labels["grpc_method"]
+	}
+
+	m.sink.Inc(labels)
+	m.sink.Observe(labels, record.Duration.Seconds())
+	if m.slo != nil {
+		m.slo.record(fullMethod, record.Code, record.Duration)
+	}
+	if m.window != nil {
+		service, method := m.methodLabels(fullMethod)
+		m.window.record(service, method, record.Code, record.Duration, time.Now())
+	}
+	if m.resultHistograms != nil {
+		m.resultHistograms.observe(labels["grpc_service"], labels["grpc_method"], record.Code, record.Duration)
+	}
+}
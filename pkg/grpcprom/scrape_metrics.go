@@ -0,0 +1,67 @@
+package grpcprom
+
+import (
+	"net/http"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ScrapeMetrics exposes the scrapes of the metrics endpoint itself: their number, duration and
+// the time of the last one, so a stale instance can be told apart from Prometheus not scraping
+// it anymore.
+type ScrapeMetrics struct {
+	scrapes    *prom.CounterVec
+	duration   *prom.HistogramVec
+	lastScrape prom.Gauge
+}
+
+// NewScrapeMetrics returns a ScrapeMetrics which exposes the scrape metrics for prometheus.
+func NewScrapeMetrics() *ScrapeMetrics {
+	return &ScrapeMetrics{
+		scrapes: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "metrics_scrapes_total",
+				Help: "Total number of scrapes of the metrics endpoint, by HTTP status code.",
+			}, []string{"code"},
+		),
+		duration: prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "metrics_scrape_duration_seconds",
+				Help:    "Histogram of the time (seconds) taken to serve the scrapes of the metrics endpoint.",
+				Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+			}, []string{"code"},
+		),
+		lastScrape: prom.NewGauge(
+			prom.GaugeOpts{
+				Name: "metrics_last_scrape_timestamp_seconds",
+				Help: "Time of the last scrape of the metrics endpoint since unix epoch in seconds.",
+			},
+		),
+	}
+}
+
+// Describe describes the scrape metrics.
+func (m *ScrapeMetrics) Describe(ch chan<- *prom.Desc) {
+	m.scrapes.Describe(ch)
+	m.duration.Describe(ch)
+	m.lastScrape.Describe(ch)
+}
+
+// Collect collects the scrape metrics.
+func (m *ScrapeMetrics) Collect(ch chan<- prom.Metric) {
+	m.scrapes.Collect(ch)
+	m.duration.Collect(ch)
+	m.lastScrape.Collect(ch)
+}
+
+// InstrumentHandler wraps the handler of the metrics endpoint, e.g. the one of
+// promhttp.HandlerFor. Each scrape exposes the metrics of the previous ones.
+func (m *ScrapeMetrics) InstrumentHandler(next http.Handler) http.Handler {
+	instrumented := promhttp.InstrumentHandlerCounter(m.scrapes, promhttp.InstrumentHandlerDuration(m.duration, next))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.lastScrape.Set(float64(time.Now().UnixNano()) / 1e9)
+		instrumented.ServeHTTP(w, r)
+	})
+}
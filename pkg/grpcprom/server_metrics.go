@@ -0,0 +1,643 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcstatus"
+)
+
+// ServerMetrics represents a collection of metrics to be registered on a Prometheus metrics
+// registry for a gRPC server.
+type ServerMetrics struct {
+	labels []string
+	sink   MetricsSink
+	slo    *sloMetrics
+	slow   *slowRPCs
+	tracer trace.Tracer
+
+	exemplarSampling *exemplarSampling
+
+	extractorMu    sync.RWMutex
+	labelExtractor LabelExtractor
+	labelSchema    *LabelSchema
+
+	registerMu  sync.Mutex
+	registerers []prom.Registerer
+	// adopted is the ServerMetrics whose metrics were adopted by Register, and adopters the
+	// number of ServerMetrics which adopted these ones and keep them registered.
+	adopted      *ServerMetrics
+	adopters     int
+	unregistered bool
+	// served is set by the first RPC, after which the metrics can't be adopted.
+	served atomic.Bool
+
+	chainMu          sync.Mutex
+	interceptorChain []InterceptorInfo
+
+	prototypes labelPrototypes
+
+	contextLabels []string
+
+	spanAttributes   bool
+	attributeMapping map[string]string
+
+	methodRewrites []MethodRewrite
+	allowlist      map[string]bool
+	relabel        Relabeler
+	redactions     []RedactionRule
+	audit          *LabelAudit
+	strictLabels   bool
+	window         *statsWindows
+	errorType      bool
+	serverName     bool
+	recorder       *rpcRecorder
+	events         *RPCEvents
+	collapsedCodes map[string]string
+
+	deadlineHistogram *prom.HistogramVec
+	statusDetails     *prom.CounterVec
+
+	activeHandlers      *prom.GaugeVec
+	activeHandlersLabel string
+
+	rpcCounterOpts []rpcCounterOpts
+	rpcCounters    map[string]*prom.CounterVec
+
+	resultHistograms *resultHistograms
+	labelEcho        map[string]bool
+	qosHistograms    map[string]*prom.HistogramVec
+	histogramSplit   *histogramSplit
+	warmup           *warmup
+	idempotency      *idempotencyCache
+	deprecated       map[string]bool
+	deprecatedCalls  *prom.CounterVec
+	deprecatedAgents *boundedValues
+
+	gcAffectedEnabled bool
+	gcAffected        *prom.CounterVec
+
+	// Vectors of the default prometheus sink, only used when no other sink is given.
+	serverHandledCounter   *prom.CounterVec
+	serverHandledHistogram prom.ObserverVec
+}
+
+// ServerMetricsOption configures the ServerMetrics returned by NewServerMetrics.
+type ServerMetricsOption func(*ServerMetrics)
+
+// WithHandledCounter makes the ServerMetrics count the handled RPCs with counter instead of its
+// own grpc_server_handled_total, so existing metric families can be reused. The counter must
+// have the grpc_service, grpc_method and grpc_status labels plus the ones of the LabelExtractor.
+// It is collected by the ServerMetrics, so it must not be registered on its own.
+func WithHandledCounter(counter *prom.CounterVec) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.serverHandledCounter = counter
+	}
+}
+
+// WithHandlingTimeObserver makes the ServerMetrics observe the RPC latencies with observer
+// instead of its own grpc_server_handling_seconds histogram. Any prom.ObserverVec works, like a
+// SummaryVec or a custom histogram implementation. The observer must have the same labels as
+// the WithHandledCounter counter and must not be registered on its own either.
+func WithHandlingTimeObserver(observer prom.ObserverVec) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.serverHandledHistogram = observer
+	}
+}
+
+// WithErrorTypeLabel adds the error_type label to the metrics, with the error type given by the
+// mappers registered in the grpcstatus package, to break the failures down by domain error. It is
+// set by the gRPC interceptor; the other transports record the default value.
+func WithErrorTypeLabel() ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.errorType = true
+		m.labels = append(m.labels, "error_type")
+	}
+}
+
+// WithSink makes the ServerMetrics record the handled RPCs in sink instead of the prometheus
+// vectors, e.g. a kitsink.Sink. WithHandledCounter and WithHandlingTimeObserver are ignored then.
+func WithSink(sink MetricsSink) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.sink = sink
+	}
+}
+
+// NewServerMetrics returns a ServerMetric which exposes the grpc service metrics for prometheus.
+// SeverMetricLabels should contain the name for the custom labels that we want to attach to all the
+// metrics.
+// It panics if a counter or observer given through the options doesn't have the expected labels,
+// or if WithStrictLabels is given and a label is denied.
+func NewServerMetrics(labelExtractor LabelExtractor, opts ...ServerMetricsOption) *ServerMetrics {
+	labels := serverMetricLabels(labelExtractor)
+	m := &ServerMetrics{
+		labels:         labels,
+		labelExtractor: labelExtractor,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	labels = m.labels
+	m.checkStrictLabels()
+	m.checkLabelSchema()
+	m.checkActiveHandlersLabel()
+	m.checkQoSLabel()
+	m.newRPCCounters()
+	m.newIdempotencyCounters()
+	m.newGCAffectedCounter()
+
+	if m.sink != nil {
+		if ls, ok := m.sink.(labelsSink); ok {
+			ls.setLabels(labels)
+		}
+		return m
+	}
+
+	if m.serverHandledCounter == nil {
+		m.serverHandledCounter = prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_handled_total",
+				Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+			}, labels,
+		)
+	} else if _, err := m.serverHandledCounter.CurryWith(emptyLabels(labels)); err != nil {
+		panic(fmt.Sprintf("handled counter labels don't match %v: %v", labels, err))
+	}
+
+	customObserver := m.serverHandledHistogram != nil
+	if m.serverHandledHistogram == nil {
+		m.serverHandledHistogram = prom.NewHistogramVec(
+			prom.HistogramOpts{
+				Name:    "grpc_server_handling_seconds",
+				Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+				Buckets: prom.DefBuckets,
+			}, labels,
+		)
+	} else if _, err := m.serverHandledHistogram.CurryWith(emptyLabels(labels)); err != nil {
+		panic(fmt.Sprintf("handling time observer labels don't match %v: %v", labels, err))
+	}
+
+	sink := newPrometheusSink(labels, m.serverHandledCounter, m.serverHandledHistogram)
+	m.sink = sink
+	if m.histogramSplit != nil && !customObserver {
+		m.sink = newSplitSink(sink, m.histogramSplit)
+	}
+	return m
+}
+
+// serverMetricLabels returns the label names of the server metrics: the grpc ones followed by the
+// custom labels of the labelExtractor.
+func serverMetricLabels(labelExtractor LabelExtractor) []string {
+	return append([]string{"grpc_service", "grpc_method", "grpc_status"}, labelExtractor.LabelNames()...)
+}
+
+// SetLabelExtractor replaces the LabelExtractor of the ServerMetrics, e.g. to reload its
+// configuration, without restarting the server. It returns an error if the new extractor doesn't
+// declare the same label names as the current one, as the metrics can't change their labels.
+func (m *ServerMetrics) SetLabelExtractor(labelExtractor LabelExtractor) error {
+	m.extractorMu.Lock()
+	defer m.extractorMu.Unlock()
+
+	if err := checkLabelNames(m.labelExtractor, labelExtractor); err != nil {
+		return err
+	}
+	m.labelExtractor = labelExtractor
+	return nil
+}
+
+// extractor returns the current LabelExtractor of the ServerMetrics.
+func (m *ServerMetrics) extractor() LabelExtractor {
+	m.extractorMu.RLock()
+	defer m.extractorMu.RUnlock()
+
+	return m.labelExtractor
+}
+
+// checkLabelNames returns an error if the extractors don't declare the same label names, in the
+// same order.
+func checkLabelNames(current, next LabelExtractor) error {
+	want, got := current.LabelNames(), next.LabelNames()
+	if len(want) != len(got) {
+		return fmt.Errorf("label extractor declares the labels %v, want %v", got, want)
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			return fmt.Errorf("label extractor declares the labels %v, want %v", got, want)
+		}
+	}
+	return nil
+}
+
+// emptyLabels returns prom.Labels with every label name set to the empty value. Currying a
+// vector with them checks it has all those labels without creating any series.
+func emptyLabels(labelNames []string) prom.Labels {
+	labels := prom.Labels{}
+	for _, name := range labelNames {
+		labels[name] = ""
+	}
+	return labels
+}
+
+// Describe describes the metrics of the sink if it is a prometheus collector, and the metrics of
+// the enabled options.
+func (m *ServerMetrics) Describe(ch chan<- *prom.Desc) {
+	if c, ok := m.sink.(prom.Collector); ok {
+		c.Describe(ch)
+	}
+	if m.slo != nil {
+		m.slo.Describe(ch)
+	}
+	if m.deadlineHistogram != nil {
+		m.deadlineHistogram.Describe(ch)
+	}
+	if m.window != nil {
+		m.window.Describe(ch)
+	}
+	if m.statusDetails != nil {
+		m.statusDetails.Describe(ch)
+	}
+	if m.activeHandlers != nil {
+		m.activeHandlers.Describe(ch)
+	}
+	for _, counter := range m.rpcCounters {
+		counter.Describe(ch)
+	}
+	if m.resultHistograms != nil {
+		m.resultHistograms.Describe(ch)
+	}
+	for _, histogram := range m.qosHistograms {
+		histogram.Describe(ch)
+	}
+	if m.idempotency != nil {
+		m.idempotency.hits.Describe(ch)
+		m.idempotency.misses.Describe(ch)
+	}
+	if m.deprecatedCalls != nil {
+		m.deprecatedCalls.Describe(ch)
+	}
+	if m.gcAffected != nil {
+		m.gcAffected.Describe(ch)
+	}
+}
+
+// Collect collects the metrics of the sink if it is a prometheus collector, and the metrics of
+// the enabled options.
+func (m *ServerMetrics) Collect(ch chan<- prom.Metric) {
+	if c, ok := m.sink.(prom.Collector); ok {
+		c.Collect(ch)
+	}
+	if m.slo != nil {
+		m.slo.Collect(ch)
+	}
+	if m.deadlineHistogram != nil {
+		m.deadlineHistogram.Collect(ch)
+	}
+	if m.window != nil {
+		m.window.Collect(ch)
+	}
+	if m.statusDetails != nil {
+		m.statusDetails.Collect(ch)
+	}
+	if m.activeHandlers != nil {
+		m.activeHandlers.Collect(ch)
+	}
+	for _, counter := range m.rpcCounters {
+		counter.Collect(ch)
+	}
+	if m.resultHistograms != nil {
+		m.resultHistograms.Collect(ch)
+	}
+	for _, histogram := range m.qosHistograms {
+		histogram.Collect(ch)
+	}
+	if m.idempotency != nil {
+		m.idempotency.hits.Collect(ch)
+		m.idempotency.misses.Collect(ch)
+	}
+	if m.deprecatedCalls != nil {
+		m.deprecatedCalls.Collect(ch)
+	}
+	if m.gcAffected != nil {
+		m.gcAffected.Collect(ch)
+	}
+}
+
+// unknownName is the grpc_service or grpc_method label of the full method names missing it.
+const unknownName = "unknown"
+
+// maxNameLength is the maximum length, in bytes, of the grpc_service and grpc_method labels and
+// of the label values read from the metadata.
+const maxNameLength = 128
+
+// Method used for spliting the service/method names of a grpc service. Malformed names don't
+// fail: a missing part is labeled unknown, and both parts are sanitized so the labels are valid
+// UTF-8, without control characters and at most maxNameLength bytes long.
+func splitMethodName(fullMethodName string) (string, string) {
+	fullMethodName = strings.TrimPrefix(fullMethodName, "/") // remove leading slash
+	service, method, ok := strings.Cut(fullMethodName, "/")
+	if !ok {
+		// A name without slash is more likely a method than a service.
+		service, method = "", fullMethodName
+	}
+	return sanitizeName(service), sanitizeName(method)
+}
+
+// sanitizeName returns the name as a bounded label value, see sanitizeLabelValue. Empty names are
+// unknown.
+func sanitizeName(name string) string {
+	if name = sanitizeLabelValue(name); name == "" {
+		return unknownName
+	}
+	return name
+}
+
+// sanitizeLabelValue returns the value as a bounded label value: invalid UTF-8 sequences and
+// control characters are replaced and the value is truncated to maxNameLength bytes on a rune
+// boundary.
+func sanitizeLabelValue(value string) string {
+	value = strings.ToValidUTF8(value, "\uFFFD")
+	value = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, value)
+
+	if len(value) > maxNameLength {
+		cut := maxNameLength
+		for cut > 0 && !utf8.RuneStart(value[cut]) {
+			cut--
+		}
+		value = value[:cut]
+	}
+	return value
+}
+
+func (m *ServerMetrics) metricLabels(ctx context.Context, fullMethod string) map[string]string {
+	return m.rpcLabels(ctx, fullMethod, m.audit != nil)
+}
+
+// rpcLabels returns the metric labels of an RPC, recording them in the label audit when audit
+// is set. The components labeling an RPC already recorded by the interceptors don't audit it
+// again.
+func (m *ServerMetrics) rpcLabels(ctx context.Context, fullMethod string, audit bool) map[string]string {
+	labelExtractor := m.extractor()
+	// The built-in extractors find the full method of the RPC of any transport in the context.
+	ctx = context.WithValue(ctx, fullMethodKey{}, fullMethod)
+
+	var extracted, sources map[string]string
+	if audit {
+		// The audit finds the extractor of every label in the chain.
+		extracted, sources = extractWithSources(labelExtractor, ctx)
+	} else {
+		extracted = labelExtractor.Labels(ctx)
+	}
+
+	// Only the custom labels are written over the cached base labels of the method.
+	labels := m.baseLabels(fullMethod)
+	for k, v := range extracted {
+		labels[k] = sanitizeLabelValue(v)
+	}
+	var conformed []string
+	if m.labelSchema != nil {
+		conformed = m.labelSchema.conform(labels)
+	}
+
+	var unredacted map[string]string
+	if audit {
+		unredacted = make(map[string]string, len(labels))
+		for k, v := range labels {
+			unredacted[k] = v
+		}
+	}
+	m.redact(labels)
+	if audit {
+		m.auditLabels(fullMethod, labels, unredacted, extracted, sources, conformed)
+	}
+
+	if stashed, ok := ctx.Value(contextLabelsKey{}).(*contextLabels); ok {
+		m.mergeContextLabels(labels, stashed)
+	}
+	return labels
+}
+
+// populateCustomLabels adds the labels returned by the labelExtractor to labels and sets the
+// default value to every label in labelNames which is still missing.
+func populateCustomLabels(labels map[string]string, labelNames []string, labelExtractor LabelExtractor, ctx context.Context) {
+	// Populate custom labels
+	for k, v := range labelExtractor.Labels(ctx) {
+		labels[k] = v
+	}
+
+	// Populate non-initialized custom labels with default value
+	for _, labelName := range labelNames {
+		if _, ok := labels[labelName]; !ok {
+			labels[labelName] = "default"
+		}
+	}
+}
+
+// UnaryServerInterceptor is a gRPC server-side interceptor that provides Prometheus monitoring for Unary RPCs.
+func (m *ServerMetrics) UnaryServerInterceptor() func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return m.unaryServerInterceptor(defaultServerName)
+}
+
+func (m *ServerMetrics) unaryServerInterceptor(serverName string) func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := m.startSpan(ctx, info.FullMethod)
+		metricLabels := m.metricLabels(contextWithRequest(ctx, req), info.FullMethod)
+		if m.serverName {
+			metricLabels[serverNameLabel] = serverName
+		}
+		monitor := newServerReporter(ctx, m, info.FullMethod, metricLabels)
+		m.countDeprecated(ctx, info.FullMethod, metricLabels)
+		monitor.echo = m.echoLabels(ctx, info.FullMethod)
+		if entry := m.duplicate(ctx, info.FullMethod, monitor); entry != nil {
+			resp, err := entry.wait(ctx)
+			m.countDuplicate(monitor, err)
+			st, _ := grpcstatus.FromError(err)
+			endSpan(span, st.Code(), st.Message())
+			return resp, err
+		}
+		defer m.abortIdempotent(monitor)
+		finished := m.startHandler(metricLabels)
+		resp, err := handler(m.contextWithLabels(m.contextWithRPCValues(ctx, monitor), monitor), req)
+		finished()
+		m.completeIdempotent(monitor, resp, err)
+		st, _ := grpcstatus.FromError(err)
+		monitor.labels["grpc_status"] = st.Code().String()
+		if m.errorType {
+			monitor.labels["error_type"] = grpcstatus.ErrorType(err)
+		}
+		m.mergeErrorLabels(monitor.labels, err)
+		monitor.Handled()
+		if monitor.echoed != nil {
+			setEchoedLabels(ctx, monitor.echoed)
+		}
+		m.countStatusDetails(monitor.labels, st)
+		endSpan(span, st.Code(), st.Message())
+		return resp, err
+	}
+}
+
+type serverReporter struct {
+	metrics *ServerMetrics
+	// fullMethod is the full method of the RPC, before the rewrites, allowlist and relabeling of
+	// its labels, which the per-method options are keyed on.
+	fullMethod string
+	labels     map[string]string
+	startTime  time.Time
+	deadline   time.Time
+	peer       net.Addr
+	traceID    string
+	span       trace.Span
+	values     *rpcValues
+
+	// idempotent is the idempotency cache entry of the RPC, for WithIdempotencyCache.
+	idempotent *idempotentRPC
+	// gcPauses is the number of GC pauses when the RPC started, for WithGCAffectedCounter.
+	gcPauses uint64
+	// stashed are the labels stashed in the context of the RPC, for WithContextLabels.
+	stashed *contextLabels
+
+	// echo tells to keep a copy of the recorded labels in echoed, for WithLabelEcho.
+	echo   bool
+	echoed map[string]string
+}
+
+func newServerReporter(ctx context.Context, m *ServerMetrics, fullMethod string, labels map[string]string) *serverReporter {
+	r := &serverReporter{
+		metrics:    m,
+		fullMethod: fullMethod,
+		labels:     labels,
+		startTime:  time.Now(),
+	}
+	if !m.served.Load() {
+		m.served.Store(true)
+	}
+	r.deadline, _ = ctx.Deadline()
+	if p, ok := peer.FromContext(ctx); ok {
+		r.peer = p.Addr
+	}
+	r.traceID, _ = traceID(ctx)
+	r.span = trace.SpanFromContext(ctx)
+	if m.gcAffected != nil {
+		r.gcPauses = gcPauses()
+	}
+	return r
+}
+
+func (r *serverReporter) Handled() {
+	r.handled(time.Since(r.startTime))
+}
+
+// observe records the handling time of the RPC, with the given status before collapsing. values
+// are the label values of the valuesSink, nil for the other sinks.
+func (r *serverReporter) observe(labels map[string]string, values []string, status string, elapsed time.Duration) {
+	vs, ordered := r.metrics.sink.(valuesSink)
+	es, exemplars := r.metrics.sink.(exemplarSink)
+	var exemplar prom.Labels
+	if ordered || exemplars {
+		exemplar = r.exemplar(labels, status, elapsed)
+	}
+	switch {
+	case ordered && values != nil:
+		vs.observeValues(labels, values, elapsed.Seconds(), exemplar)
+	case exemplars && exemplar != nil:
+		es.ObserveWithExemplar(labels, elapsed.Seconds(), exemplar)
+	default:
+		r.metrics.sink.Observe(labels, elapsed.Seconds())
+	}
+
+	if r.metrics.slo != nil {
+		r.metrics.slo.record(r.fullMethod, status, elapsed)
+	}
+	if r.metrics.window != nil {
+		// The window is keyed like WindowStats looks it up, without the relabeling.
+		service, method := r.metrics.methodLabels(r.fullMethod)
+		r.metrics.window.record(service, method, status, elapsed, time.Now())
+	}
+	if r.metrics.resultHistograms != nil {
+		r.metrics.resultHistograms.observe(labels["grpc_service"], labels["grpc_method"], status, elapsed)
+	}
+	r.metrics.observeDeadline(labels, r.startTime, r.deadline, elapsed)
+	r.metrics.observeQoS(labels, elapsed)
+}
+
+// exemplar returns the exemplar of the handling time observation of the RPC, its trace ID, or nil
+// if it has none or it's not sampled.
+func (r *serverReporter) exemplar(labels map[string]string, status string, elapsed time.Duration) prom.Labels {
+	if r.traceID == "" || !r.metrics.sampleExemplar(labels, status, elapsed) {
+		return nil
+	}
+	return prom.Labels{"trace_id": r.traceID}
+}
+
+// declaredLabels returns the relabeled values of the declared labels, the only ones handed to
+// the sink, with the grpc_status collapsed, and the original grpc_status.
+func (r *serverReporter) declaredLabels() (map[string]string, string) {
+	recorded := r.labels
+	if r.metrics.relabel != nil {
+		recorded = r.metrics.relabel(recorded)
+	}
+
+	labels := make(map[string]string, len(r.metrics.labels))
+	for _, labelName := range r.metrics.labels {
+		labels[labelName] = recorded[labelName]
+	}
+	status := labels["grpc_status"]
+	labels["grpc_status"] = r.metrics.collapseStatus(status)
+	return labels, status
+}
+
+// handled records the RPC, which took elapsed.
+func (r *serverReporter) handled(elapsed time.Duration) {
+	r.metrics.mergeContextLabels(r.labels, r.stashed)
+	labels, status := r.declaredLabels()
+	excluded := r.metrics.checkWarmup(labels)
+
+	// The label values are ordered once for all the metrics of the default sinks.
+	var values []string
+	if vs, ok := r.metrics.sink.(valuesSink); ok {
+		values = r.metrics.labelValues(labels)
+		vs.incValues(values)
+	} else {
+		r.metrics.sink.Inc(labels)
+	}
+	if !excluded {
+		r.observe(labels, values, status, elapsed)
+	}
+	r.metrics.countRPCValues(labels, r.values)
+	r.metrics.countIdempotencyMiss(labels, r.idempotent)
+	r.metrics.countGCAffected(labels, r.gcPauses)
+
+	r.metrics.setSpanAttributes(r.span, labels)
+
+	if r.metrics.slow != nil {
+		r.metrics.slow.check(r.fullMethod, labels, elapsed, r.peer)
+	}
+
+	if r.echo {
+		r.echoed = make(map[string]string, len(labels))
+		for name, value := range labels {
+			r.echoed[name] = value
+		}
+	}
+
+	// The labels are handed over to the event consumers last, as they may modify them.
+	now := time.Now()
+	r.metrics.recordRPC(r.fullMethod, labels, status, elapsed, now)
+	r.metrics.sendRPCEvent(r.fullMethod, labels, status, elapsed, now)
+}
@@ -0,0 +1,253 @@
+package grpcprom_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom/grpcstatus"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const handledHeader = `
+# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.
+# TYPE grpc_server_handled_total counter
+`
+
+// newRegistry returns a registry with the collectors registered.
+func newRegistry(t *testing.T, collectors ...prom.Collector) *prom.Registry {
+	t.Helper()
+
+	reg := prom.NewRegistry()
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+// assertMetrics fails the test if the named families of the gatherer differ from the exposition.
+func assertMetrics(t *testing.T, reg prom.Gatherer, exposition string, metricNames ...string) {
+	t.Helper()
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(exposition), metricNames...); err != nil {
+		t.Error(err)
+	}
+}
+
+// callUnary calls the unary interceptor of the metrics with a handler returning err.
+func callUnary(m *grpcprom.ServerMetrics, ctx context.Context, req interface{}, fullMethod string, err error) {
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, err
+	}
+	_, _ = m.UnaryServerInterceptor()(ctx, req, &grpc.UnaryServerInfo{FullMethod: fullMethod}, handler)
+}
+
+func TestUnaryServerInterceptorStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		fullMethod string
+		err        error
+		want       string
+	}{
+		{
+			name:       "ok",
+			fullMethod: "/demo.v1.Greeter/SayHello",
+			want:       `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK"} 1`,
+		},
+		{
+			name:       "status error",
+			fullMethod: "/demo.v1.Greeter/SayHello",
+			err:        status.Error(codes.NotFound, "no such user"),
+			want:       `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="NotFound"} 1`,
+		},
+		{
+			name:       "wrapped status error",
+			fullMethod: "/demo.v1.Greeter/SayHello",
+			err:        fmt.Errorf("loading user: %w", status.Error(codes.PermissionDenied, "denied")),
+			want:       `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="PermissionDenied"} 1`,
+		},
+		{
+			name:       "context error",
+			fullMethod: "/demo.v1.Greeter/SayHello",
+			err:        fmt.Errorf("calling the backend: %w", context.DeadlineExceeded),
+			want:       `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="DeadlineExceeded"} 1`,
+		},
+		{
+			name:       "plain error",
+			fullMethod: "/demo.v1.Greeter/SayHello",
+			err:        errors.New("boom"),
+			want:       `grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="Unknown"} 1`,
+		},
+		{
+			name:       "malformed method",
+			fullMethod: "SayHello",
+			want:       `grpc_server_handled_total{grpc_method="SayHello",grpc_service="unknown",grpc_status="OK"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+			reg := newRegistry(t, m)
+
+			callUnary(m, context.Background(), nil, tt.fullMethod, tt.err)
+
+			assertMetrics(t, reg, handledHeader+tt.want+"\n", "grpc_server_handled_total")
+			if got := testutil.CollectAndCount(m, "grpc_server_handling_seconds"); got != 1 {
+				t.Errorf("%d handling time series, want 1", got)
+			}
+		})
+	}
+}
+
+var errOutOfStock = errors.New("out of stock")
+
+func init() {
+	grpcstatus.RegisterError(errOutOfStock, codes.FailedPrecondition, "out_of_stock")
+}
+
+func TestErrorTypeLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "ok",
+			want: `grpc_server_handled_total{error_type="none",grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="OK"} 1`,
+		},
+		{
+			name: "mapped error",
+			err:  fmt.Errorf("buying: %w", errOutOfStock),
+			want: `grpc_server_handled_total{error_type="out_of_stock",grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="FailedPrecondition"} 1`,
+		},
+		{
+			name: "status error",
+			err:  status.Error(codes.Unavailable, "try later"),
+			want: `grpc_server_handled_total{error_type="other",grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="Unavailable"} 1`,
+		},
+		{
+			name: "other error",
+			err:  errors.New("boom"),
+			want: `grpc_server_handled_total{error_type="other",grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="Unknown"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, grpcprom.WithErrorTypeLabel())
+			reg := newRegistry(t, m)
+
+			callUnary(m, context.Background(), nil, "/shop.v1.Shop/Buy", tt.err)
+
+			assertMetrics(t, reg, handledHeader+tt.want+"\n", "grpc_server_handled_total")
+		})
+	}
+}
+
+// labeledRequest is a request message carrying metric labels, like the ones generated by
+// protoc-gen-grpcprom.
+type labeledRequest map[string]string
+
+func (r labeledRequest) RequestLabels() map[string]string {
+	return r
+}
+
+// labeledError is an error carrying metric labels.
+type labeledError map[string]string
+
+func (e labeledError) Error() string {
+	return "labeled error"
+}
+
+func (e labeledError) MetricLabels() map[string]string {
+	return e
+}
+
+func TestCustomLabels(t *testing.T) {
+	tests := []struct {
+		name      string
+		extractor grpcprom.LabelExtractor
+		md        metadata.MD
+		req       interface{}
+		err       error
+		want      string
+	}{
+		{
+			name:      "request labels",
+			extractor: grpcprom.NewRequestLabelExtractor("region", "plan"),
+			req:       labeledRequest{"region": "eu", "plan": "pro"},
+			want:      `grpc_server_handled_total{grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="OK",plan="pro",region="eu"} 1`,
+		},
+		{
+			name:      "missing labels",
+			extractor: grpcprom.NewRequestLabelExtractor("region", "plan"),
+			req:       labeledRequest{"region": "eu"},
+			want:      `grpc_server_handled_total{grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="OK",plan="default",region="eu"} 1`,
+		},
+		{
+			name:      "no labeler",
+			extractor: grpcprom.NewRequestLabelExtractor("region"),
+			req:       "plain request",
+			want:      `grpc_server_handled_total{grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="OK",region="default"} 1`,
+		},
+		{
+			name:      "error labels",
+			extractor: grpcprom.NewRequestLabelExtractor("region", "reason"),
+			req:       labeledRequest{"region": "eu"},
+			err:       labeledError{"reason": "card_declined", "grpc_status": "OK"},
+			want:      `grpc_server_handled_total{grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="Unknown",reason="card_declined",region="eu"} 1`,
+		},
+		{
+			name: "chained extractors",
+			extractor: grpcprom.ChainLabelExtractors(
+				grpcprom.NewRequestLabelExtractor("region"),
+				grpcprom.NewQoSLabelExtractor(),
+			),
+			md:   metadata.Pairs(grpcprom.PriorityMetadataKey, "batch"),
+			req:  labeledRequest{"region": "us"},
+			want: `grpc_server_handled_total{grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="OK",qos="batch",region="us"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(tt.extractor)
+			reg := newRegistry(t, m)
+
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			callUnary(m, ctx, tt.req, "/shop.v1.Shop/Buy", tt.err)
+
+			assertMetrics(t, reg, handledHeader+tt.want+"\n", "grpc_server_handled_total")
+		})
+	}
+}
+
+func TestErrorLabelsConformed(t *testing.T) {
+	schema := grpcprom.MustNewLabelSchema(
+		grpcprom.LabelDefinition{Name: "region", Default: "unknown"},
+		grpcprom.LabelDefinition{Name: "reason", Values: []string{"card_declined", "expired", "other"}, Default: "other"},
+	)
+	m := grpcprom.NewServerMetrics(
+		grpcprom.ChainLabelExtractors(
+			grpcprom.NewRequestLabelExtractor("region", "reason"),
+			grpcprom.NewQoSLabelExtractor(),
+		),
+		grpcprom.WithLabelSchema(schema),
+		grpcprom.WithRedaction(grpcprom.RedactEmails),
+	)
+	reg := newRegistry(t, m)
+
+	err := labeledError{"region": "\x00 bob@example.com", "reason": "fraud", "qos": "batch", "grpc_service": "made.Up"}
+	callUnary(m, context.Background(), labeledRequest{"region": "eu"}, "/shop.v1.Shop/Buy", err)
+
+	assertMetrics(t, reg, handledHeader+`grpc_server_handled_total{grpc_method="Buy",grpc_service="shop.v1.Shop",grpc_status="Unknown",qos="interactive",reason="other",region="_ redacted"} 1
+`, "grpc_server_handled_total")
+}
@@ -0,0 +1,36 @@
+package grpcprom
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// serverNameLabel is the label telling which server of the process handled the RPC.
+const serverNameLabel = "server_name"
+
+// defaultServerName is the server_name of the RPCs handled by the unnamed interceptors.
+const defaultServerName = "default"
+
+// WithServerNameLabel adds the server_name label to the metrics, so one ServerMetrics can record
+// the RPCs of several grpc.Server instances of the process, like the public and the admin
+// listeners, and still tell their traffic apart. Each server uses NamedUnaryServerInterceptor
+// with its own name; UnaryServerInterceptor records the RPCs with the default name.
+func WithServerNameLabel() ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.serverName = true
+		m.labels = append(m.labels, serverNameLabel)
+	}
+}
+
+// NamedUnaryServerInterceptor is like UnaryServerInterceptor, labeling the RPCs with serverName
+// when the ServerMetrics has the WithServerNameLabel option.
+func (m *ServerMetrics) NamedUnaryServerInterceptor(serverName string) func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return m.unaryServerInterceptor(serverName)
+}
+
+// InitializeNamedMetrics is like InitializeMetrics, creating the series of the server named
+// serverName.
+func (m *ServerMetrics) InitializeNamedMetrics(serverName string, server ServiceInfoProvider) {
+	m.initializeMetrics(serverName, server)
+}
@@ -0,0 +1,46 @@
+package grpcprom
+
+import (
+	"fmt"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"google.golang.org/grpc"
+)
+
+// ShutdownPusher pushes the final state of the metrics to a Pushgateway when the server stops,
+// so short-lived instances don't lose the data of their last scrape interval.
+type ShutdownPusher struct {
+	pusher    *push.Pusher
+	completed prom.Gauge
+}
+
+// NewShutdownPusher returns a ShutdownPusher pushing with pusher, which must be configured with
+// the registry to push, e.g. push.New(url, job).Gatherer(reg). The push includes
+// grpc_server_shutdown_completed_timestamp_seconds as completion marker.
+func NewShutdownPusher(pusher *push.Pusher) *ShutdownPusher {
+	completed := prom.NewGauge(prom.GaugeOpts{
+		Name: "grpc_server_shutdown_completed_timestamp_seconds",
+		Help: "Time the gRPC server finished its graceful shutdown, pushed with the final metrics.",
+	})
+	return &ShutdownPusher{
+		pusher:    pusher.Collector(completed),
+		completed: completed,
+	}
+}
+
+// GracefulStop stops the server gracefully and pushes the metrics once every pending RPC is
+// recorded.
+func (p *ShutdownPusher) GracefulStop(server *grpc.Server) error {
+	server.GracefulStop()
+	return p.Push()
+}
+
+// Push pushes the metrics, replacing the ones previously pushed for the same grouping key.
+func (p *ShutdownPusher) Push() error {
+	p.completed.SetToCurrentTime()
+	if err := p.pusher.Push(); err != nil {
+		return fmt.Errorf("pushing the final metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package grpcprom
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSink records the handled RPCs of the ServerMetrics. The labels always contain one value
+// for each label of the ServerMetrics: grpc_service, grpc_method, grpc_status and the labels of
+// the LabelExtractor.
+type MetricsSink interface {
+	// Inc counts one handled RPC.
+	Inc(labels map[string]string)
+	// Observe records the handling time, in seconds, of one RPC.
+	Observe(labels map[string]string, v float64)
+}
+
+// exemplarSink is implemented by the sinks which can attach an exemplar, like the trace ID of the
+// RPC, to the handling time observations.
+type exemplarSink interface {
+	ObserveWithExemplar(labels map[string]string, v float64, exemplar prom.Labels)
+}
+
+// labelsSink is implemented by the sinks taking their label names from the ServerMetrics they are
+// given to with WithSink, once all the options are applied.
+type labelsSink interface {
+	setLabels(labels []string)
+}
+
+// valuesSink is implemented by the sinks taking the label values in the order of the labels of
+// the ServerMetrics, computed once per RPC instead of once per recorded metric.
+type valuesSink interface {
+	incValues(values []string)
+	// observeValues records the handling time with the exemplar, if not nil.
+	observeValues(labels map[string]string, values []string, v float64, exemplar prom.Labels)
+}
+
+// prometheusSink is the default MetricsSink, backed by prometheus vectors. It is a
+// prom.Collector so the ServerMetrics can be registered directly.
+type prometheusSink struct {
+	labels   []string
+	counter  *prom.CounterVec
+	observer prom.ObserverVec
+}
+
+func newPrometheusSink(labels []string, counter *prom.CounterVec, observer prom.ObserverVec) *prometheusSink {
+	return &prometheusSink{
+		labels:   labels,
+		counter:  counter,
+		observer: observer,
+	}
+}
+
+func (s *prometheusSink) orderedLabels(labels map[string]string) []string {
+	orderedLabels := make([]string, 0, len(s.labels))
+	for _, labelName := range s.labels {
+		orderedLabels = append(orderedLabels, labels[labelName])
+	}
+	return orderedLabels
+}
+
+func (s *prometheusSink) Inc(labels map[string]string) {
+	s.counter.WithLabelValues(s.orderedLabels(labels)...).Inc()
+}
+
+func (s *prometheusSink) Observe(labels map[string]string, v float64) {
+	s.observer.WithLabelValues(s.orderedLabels(labels)...).Observe(v)
+}
+
+func (s *prometheusSink) ObserveWithExemplar(labels map[string]string, v float64, exemplar prom.Labels) {
+	observeWithExemplar(s.observer.WithLabelValues(s.orderedLabels(labels)...), v, exemplar)
+}
+
+func (s *prometheusSink) incValues(values []string) {
+	s.counter.WithLabelValues(values...).Inc()
+}
+
+func (s *prometheusSink) observeValues(_ map[string]string, values []string, v float64, exemplar prom.Labels) {
+	observeWithExemplar(s.observer.WithLabelValues(values...), v, exemplar)
+}
+
+// observeWithExemplar records v in the observer with the exemplar, if not nil and supported.
+func observeWithExemplar(observer prom.Observer, v float64, exemplar prom.Labels) {
+	if eo, ok := observer.(prom.ExemplarObserver); ok && exemplar != nil {
+		eo.ObserveWithExemplar(v, exemplar)
+		return
+	}
+	observer.Observe(v)
+}
+
+func (s *prometheusSink) Init(labels map[string]string) {
+	s.counter.WithLabelValues(s.orderedLabels(labels)...)
+	s.observer.WithLabelValues(s.orderedLabels(labels)...)
+}
+
+func (s *prometheusSink) Describe(ch chan<- *prom.Desc) {
+	s.counter.Describe(ch)
+	s.observer.Describe(ch)
+}
+
+func (s *prometheusSink) Collect(ch chan<- prom.Metric) {
+	s.counter.Collect(ch)
+	s.observer.Collect(ch)
+}
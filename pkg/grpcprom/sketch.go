@@ -0,0 +1,251 @@
+package grpcprom
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// minSketchValue is the smallest latency, in seconds, tracked by a sketch bin. Anything below it
+// is counted as zero.
+const minSketchValue = 1e-9
+
+// latencySketch is a DDSketch: a histogram with logarithmic bins guaranteeing a relative error
+// on every quantile, no matter how the latencies are distributed.
+type latencySketch struct {
+	mu        sync.Mutex
+	logGamma  float64
+	bins      map[int]uint64
+	zeroCount uint64
+	count     uint64
+	sum       float64
+}
+
+func newLatencySketch(relativeAccuracy float64) *latencySketch {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &latencySketch{
+		logGamma: math.Log(gamma),
+		bins:     map[int]uint64{},
+	}
+}
+
+// add records one value.
+func (s *latencySketch) add(v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.count++
+	s.sum += v
+	if v <= minSketchValue {
+		s.zeroCount++
+		return
+	}
+	s.bins[int(math.Ceil(math.Log(v)/s.logGamma))]++
+}
+
+// value returns the value represented by the bin with the given index, which is within the
+// relative accuracy of every value counted in it.
+func (s *latencySketch) value(index int) float64 {
+	gamma := math.Exp(s.logGamma)
+	return 2 * math.Pow(gamma, float64(index)) / (gamma + 1)
+}
+
+func (s *latencySketch) sortedIndexes() []int {
+	indexes := make([]int, 0, len(s.bins))
+	for i := range s.bins {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// histogram converts the sketch to cumulative counts for the given bucket upper bounds.
+func (s *latencySketch) histogram(buckets []float64) (uint64, float64, map[float64]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	indexes := s.sortedIndexes()
+	cumulative := make(map[float64]uint64, len(buckets))
+	count, next := s.zeroCount, 0
+	for _, bound := range buckets {
+		for next < len(indexes) && s.value(indexes[next]) <= bound {
+			count += s.bins[indexes[next]]
+			next++
+		}
+		cumulative[bound] = count
+	}
+	return s.count, s.sum, cumulative
+}
+
+// quantile returns the estimated q-quantile (0 <= q <= 1) of the recorded values.
+func (s *latencySketch) quantile(q float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.count == 0 {
+		return math.NaN()
+	}
+
+	rank := uint64(q * float64(s.count-1))
+	if rank < s.zeroCount {
+		return 0
+	}
+	seen := s.zeroCount
+	indexes := s.sortedIndexes()
+	for _, i := range indexes {
+		seen += s.bins[i]
+		if seen > rank {
+			return s.value(i)
+		}
+	}
+	return s.value(indexes[len(indexes)-1])
+}
+
+// SketchSink is a MetricsSink recording the handling time in DDSketches instead of prometheus
+// histograms. Observations cost the same regardless of the number of buckets and keep a bounded
+// relative error, which helps with the tails of sub-millisecond services. The sketches are
+// converted to the grpc_server_handling_seconds histogram buckets at Collect time.
+//
+// Its labels are the ones of the ServerMetrics it is given to with WithSink, including the
+// labels added by the options like server_name or warmup, so it records nothing until then.
+type SketchSink struct {
+	relativeAccuracy float64
+	buckets          []float64
+
+	// The labels and metrics are set by NewServerMetrics, before any RPC is recorded.
+	labels  []string
+	counter *prom.CounterVec
+	desc    *prom.Desc
+
+	mu       sync.Mutex
+	sketches map[string]*labeledSketch
+}
+
+type labeledSketch struct {
+	labelValues []string
+	sketch      *latencySketch
+}
+
+// NewSketchSink returns a SketchSink to give to a ServerMetrics with WithSink. The
+// relativeAccuracy (e.g. 0.01 for 1%) bounds the error of the exported buckets, which can be as
+// fine as needed since they don't slow down the observations. It returns an error if
+// relativeAccuracy is not between 0 and 1, excluded.
+func NewSketchSink(relativeAccuracy float64, buckets []float64) (*SketchSink, error) {
+	if !(relativeAccuracy > 0 && relativeAccuracy < 1) {
+		return nil, fmt.Errorf("relative accuracy %v is not between 0 and 1", relativeAccuracy)
+	}
+
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &SketchSink{
+		relativeAccuracy: relativeAccuracy,
+		buckets:          sorted,
+		sketches:         map[string]*labeledSketch{},
+	}, nil
+}
+
+// setLabels creates the metrics of the sink with the labels of the ServerMetrics.
+func (s *SketchSink) setLabels(labels []string) {
+	s.labels = labels
+	s.counter = prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+		}, labels,
+	)
+	s.desc = prom.NewDesc(
+		"grpc_server_handling_seconds",
+		"Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+		labels, nil,
+	)
+}
+
+func (s *SketchSink) orderedLabels(labels map[string]string) []string {
+	orderedLabels := make([]string, 0, len(s.labels))
+	for _, labelName := range s.labels {
+		orderedLabels = append(orderedLabels, labels[labelName])
+	}
+	return orderedLabels
+}
+
+func (s *SketchSink) sketch(labelValues []string) *latencySketch {
+	key := strings.Join(labelValues, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ls, ok := s.sketches[key]
+	if !ok {
+		ls = &labeledSketch{labelValues: labelValues, sketch: newLatencySketch(s.relativeAccuracy)}
+		s.sketches[key] = ls
+	}
+	return ls.sketch
+}
+
+func (s *SketchSink) Inc(labels map[string]string) {
+	if s.counter == nil {
+		return
+	}
+	s.counter.WithLabelValues(s.orderedLabels(labels)...).Inc()
+}
+
+func (s *SketchSink) Observe(labels map[string]string, v float64) {
+	if s.counter == nil {
+		return
+	}
+	s.sketch(s.orderedLabels(labels)).add(v)
+}
+
+func (s *SketchSink) Init(labels map[string]string) {
+	if s.counter == nil {
+		return
+	}
+	s.counter.WithLabelValues(s.orderedLabels(labels)...)
+	s.sketch(s.orderedLabels(labels))
+}
+
+// Quantile returns the estimated q-quantile of the handling time of the RPCs with the given
+// labels, or NaN if there was none.
+func (s *SketchSink) Quantile(labels map[string]string, q float64) float64 {
+	key := strings.Join(s.orderedLabels(labels), "\xff")
+
+	s.mu.Lock()
+	ls, ok := s.sketches[key]
+	s.mu.Unlock()
+
+	if !ok {
+		return math.NaN()
+	}
+	return ls.sketch.quantile(q)
+}
+
+func (s *SketchSink) Describe(ch chan<- *prom.Desc) {
+	if s.counter == nil {
+		return
+	}
+	s.counter.Describe(ch)
+	ch <- s.desc
+}
+
+func (s *SketchSink) Collect(ch chan<- prom.Metric) {
+	if s.counter == nil {
+		return
+	}
+	s.counter.Collect(ch)
+
+	s.mu.Lock()
+	sketches := make([]*labeledSketch, 0, len(s.sketches))
+	for _, ls := range s.sketches {
+		sketches = append(sketches, ls)
+	}
+	s.mu.Unlock()
+
+	for _, ls := range sketches {
+		count, sum, buckets := ls.sketch.histogram(s.buckets)
+		ch <- prom.MustNewConstHistogram(s.desc, count, sum, buckets, ls.labelValues...)
+	}
+}
@@ -0,0 +1,50 @@
+package grpcprom_test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestNewSketchSinkRelativeAccuracy(t *testing.T) {
+	for _, relativeAccuracy := range []float64{0, 1, -0.01, 1.5, math.NaN()} {
+		if _, err := grpcprom.NewSketchSink(relativeAccuracy, []float64{0.1, 1}); err == nil {
+			t.Errorf("no error with a relative accuracy of %v", relativeAccuracy)
+		}
+	}
+	if _, err := grpcprom.NewSketchSink(0.01, []float64{0.1, 1}); err != nil {
+		t.Errorf("relative accuracy of 0.01: %v", err)
+	}
+}
+
+func TestSketchSinkServerMetricsLabels(t *testing.T) {
+	sink, err := grpcprom.NewSketchSink(0.01, []float64{0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{},
+		grpcprom.WithSink(sink),
+		grpcprom.WithServerNameLabel(),
+		grpcprom.WithWarmup(0, 0, grpcprom.WarmupLabel),
+	)
+	reg := newRegistry(t, m)
+
+	callUnary(m, context.Background(), nil, "/demo.v1.Greeter/SayHello", nil)
+
+	assertMetrics(t, reg, handledHeader+`
+grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK",server_name="default",warmup="false"} 1
+`, "grpc_server_handled_total")
+
+	labels := map[string]string{
+		"grpc_service": "demo.v1.Greeter",
+		"grpc_method":  "SayHello",
+		"grpc_status":  "OK",
+		"server_name":  "default",
+		"warmup":       "false",
+	}
+	if q := sink.Quantile(labels, 0.5); math.IsNaN(q) {
+		t.Error("no handling time recorded with the labels of the server metrics")
+	}
+}
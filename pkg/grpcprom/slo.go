@@ -0,0 +1,111 @@
+package grpcprom
+
+import (
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// SLO is the service level objective of a method.
+type SLO struct {
+	// Latency is the handling time target of every RPC. RPCs taking longer are counted as
+	// latency violations. Zero disables the latency objective.
+	Latency time.Duration
+	// ErrorRate is the target fraction of failed RPCs, e.g. 0.001. It is exported as a target so
+	// alerts can compare it with the rate of error violations. Zero disables the error objective.
+	ErrorRate float64
+}
+
+// sloErrorCodes are the codes counted as error violations: the ones meaning the server failed,
+// not the ones caused by an invalid request.
+var sloErrorCodes = map[string]bool{
+	codes.Unknown.String():           true,
+	codes.DeadlineExceeded.String():  true,
+	codes.Unimplemented.String():     true,
+	codes.Internal.String():          true,
+	codes.Unavailable.String():       true,
+	codes.DataLoss.String():          true,
+	codes.ResourceExhausted.String(): true,
+}
+
+// sloMetrics counts the RPCs violating the SLO of their method.
+type sloMetrics struct {
+	slos       map[string]SLO
+	violations *prom.CounterVec
+	targets    *prom.GaugeVec
+}
+
+// WithSLOs sets the SLOs of the methods, keyed by full method name (/package.Service/Method). The
+// ServerMetrics export grpc_server_slo_violations_total, counting the RPCs which exceeded the
+// latency target or failed, and grpc_server_slo_target with the targets, so alerts like
+//
+//	rate(grpc_server_slo_violations_total{slo="error"}[5m])
+//	  / on(grpc_service, grpc_method) sum by(grpc_service, grpc_method) (rate(grpc_server_handled_total[5m]))
+//	  > on(grpc_service, grpc_method) grpc_server_slo_target{slo="error"}
+//
+// work without recording rules.
+func WithSLOs(slos map[string]SLO) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.slo = newSLOMetrics(slos)
+	}
+}
+
+func newSLOMetrics(slos map[string]SLO) *sloMetrics {
+	s := &sloMetrics{
+		slos: slos,
+		violations: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_slo_violations_total",
+				Help: "Total number of RPCs completed on the server which violated the SLO of their method.",
+			}, []string{"grpc_service", "grpc_method", "slo"},
+		),
+		targets: prom.NewGaugeVec(
+			prom.GaugeOpts{
+				Name: "grpc_server_slo_target",
+				Help: "SLO targets of the methods: the latency in seconds and the error rate.",
+			}, []string{"grpc_service", "grpc_method", "slo"},
+		),
+	}
+
+	for fullMethod, slo := range slos {
+		service, method := splitMethodName(fullMethod)
+		if slo.Latency > 0 {
+			s.violations.WithLabelValues(service, method, "latency")
+			s.targets.WithLabelValues(service, method, "latency").Set(slo.Latency.Seconds())
+		}
+		if slo.ErrorRate > 0 {
+			s.violations.WithLabelValues(service, method, "error")
+			s.targets.WithLabelValues(service, method, "error").Set(slo.ErrorRate)
+		}
+	}
+	return s
+}
+
+// record counts the violations of an RPC of the full method which finished with the given status
+// after elapsed. The SLOs are looked up by the full method of the RPC, not by its labels, which
+// rewrites, allowlists and relabelers change, and the violations are labeled like the targets.
+func (s *sloMetrics) record(fullMethod, status string, elapsed time.Duration) {
+	slo, ok := s.slos[fullMethod]
+	if !ok {
+		return
+	}
+	service, method := splitMethodName(fullMethod)
+
+	if slo.Latency > 0 && elapsed > slo.Latency {
+		s.violations.WithLabelValues(service, method, "latency").Inc()
+	}
+	if slo.ErrorRate > 0 && sloErrorCodes[status] {
+		s.violations.WithLabelValues(service, method, "error").Inc()
+	}
+}
+
+func (s *sloMetrics) Describe(ch chan<- *prom.Desc) {
+	s.violations.Describe(ch)
+	s.targets.Describe(ch)
+}
+
+func (s *sloMetrics) Collect(ch chan<- prom.Metric) {
+	s.violations.Collect(ch)
+	s.targets.Collect(ch)
+}
@@ -0,0 +1,51 @@
+package grpcprom_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSLOsKeyedOnFullMethod(t *testing.T) {
+	const fullMethod = "/demo.v1.Greeter/SayHello7"
+	slos := map[string]grpcprom.SLO{fullMethod: {ErrorRate: 0.01}}
+
+	tests := []struct {
+		name string
+		opt  grpcprom.ServerMetricsOption
+	}{
+		{
+			name: "method rewrite",
+			opt:  grpcprom.WithMethodRewrites(grpcprom.MethodRewrite{Pattern: regexp.MustCompile(`[0-9]+$`), Replacement: ""}),
+		},
+		{
+			name: "method allowlist",
+			opt:  grpcprom.WithMethodAllowlist("/demo.v1.Greeter/Chat"),
+		},
+		{
+			name: "relabeler",
+			opt: grpcprom.WithRelabeler(func(labels map[string]string) map[string]string {
+				labels["grpc_method"] = "Renamed"
+				return labels
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, grpcprom.WithSLOs(slos), tt.opt)
+			reg := newRegistry(t, m)
+
+			callUnary(m, context.Background(), nil, fullMethod, status.Error(codes.Internal, "boom"))
+
+			assertMetrics(t, reg, `
+# HELP grpc_server_slo_violations_total Total number of RPCs completed on the server which violated the SLO of their method.
+# TYPE grpc_server_slo_violations_total counter
+grpc_server_slo_violations_total{grpc_method="SayHello7",grpc_service="demo.v1.Greeter",slo="error"} 1
+`, "grpc_server_slo_violations_total")
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package grpcprom
+
+import (
+	"net"
+	"time"
+)
+
+// Logger is the minimal logger used by the library, satisfied by *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// SlowRPC describes an RPC which took longer than the threshold of its method.
+type SlowRPC struct {
+	FullMethod string
+	// Labels are the labels the RPC was recorded with, including grpc_status.
+	Labels    map[string]string
+	Duration  time.Duration
+	Threshold time.Duration
+	// Peer is the address of the caller, nil when unknown.
+	Peer net.Addr
+}
+
+// SlowRPCHook is called, after the RPC is recorded, for every RPC slower than its threshold.
+type SlowRPCHook func(SlowRPC)
+
+// slowRPCs calls the hook for the RPCs slower than the thresholds.
+type slowRPCs struct {
+	threshold        time.Duration
+	methodThresholds map[string]time.Duration
+	hook             SlowRPCHook
+}
+
+// WithSlowRPCHook makes the ServerMetrics call hook for every RPC taking longer than the
+// threshold of its method, so the offending calls behind a histogram spike can be found. The
+// methodThresholds are keyed by full method name (/package.Service/Method); the other methods
+// use threshold, zero disabling the hook for them.
+func WithSlowRPCHook(threshold time.Duration, methodThresholds map[string]time.Duration, hook SlowRPCHook) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.slow = &slowRPCs{
+			threshold:        threshold,
+			methodThresholds: methodThresholds,
+			hook:             hook,
+		}
+	}
+}
+
+// LogSlowRPCs returns a SlowRPCHook logging the slow RPCs with logger.
+func LogSlowRPCs(logger Logger) SlowRPCHook {
+	return func(rpc SlowRPC) {
+		logger.Printf("slow RPC %s took %s (threshold %s) peer=%v labels=%v",
+			rpc.FullMethod, rpc.Duration, rpc.Threshold, rpc.Peer, rpc.Labels)
+	}
+}
+
+// check calls the hook if the RPC of fullMethod was slower than its threshold.
+func (s *slowRPCs) check(fullMethod string, labels map[string]string, elapsed time.Duration, peer net.Addr) {
+	threshold, ok := s.methodThresholds[fullMethod]
+	if !ok {
+		threshold = s.threshold
+	}
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+
+	s.hook(SlowRPC{
+		FullMethod: fullMethod,
+		Labels:     labels,
+		Duration:   elapsed,
+		Threshold:  threshold,
+		Peer:       peer,
+	})
+}
@@ -0,0 +1,34 @@
+package grpcprom_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestSlowRPCHookKeyedOnFullMethod(t *testing.T) {
+	const fullMethod = "/demo.v1.Greeter/SayHello7"
+
+	var slow []grpcprom.SlowRPC
+	m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{},
+		grpcprom.WithMethodRewrites(grpcprom.MethodRewrite{Pattern: regexp.MustCompile(`[0-9]+$`), Replacement: ""}),
+		grpcprom.WithSlowRPCHook(0, map[string]time.Duration{fullMethod: time.Nanosecond}, func(rpc grpcprom.SlowRPC) {
+			slow = append(slow, rpc)
+		}),
+	)
+
+	callUnary(m, context.Background(), nil, fullMethod, nil)
+
+	if len(slow) != 1 {
+		t.Fatalf("%d slow RPCs, want 1", len(slow))
+	}
+	if slow[0].FullMethod != fullMethod {
+		t.Errorf("got full method %q, want %q", slow[0].FullMethod, fullMethod)
+	}
+	if got := slow[0].Labels["grpc_method"]; got != "SayHello" {
+		t.Errorf("got grpc_method label %q, want SayHello", got)
+	}
+}
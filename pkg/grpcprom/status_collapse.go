@@ -0,0 +1,29 @@
+package grpcprom
+
+import (
+	"google.golang.org/grpc/codes"
+)
+
+// WithCollapsedCodes makes the ServerMetrics record the RPCs finished with any of the codes with
+// the grpc_status label set to bucket, e.g. WithCollapsedCodes("other_error", codes.DataLoss,
+// codes.Unimplemented, codes.OutOfRange), to keep the status dimension small. It can be given
+// several times for different buckets. The SLOs and the stats window still classify the errors
+// by their real code.
+func WithCollapsedCodes(bucket string, collapsed ...codes.Code) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		if m.collapsedCodes == nil {
+			m.collapsedCodes = map[string]string{}
+		}
+		for _, code := range collapsed {
+			m.collapsedCodes[code.String()] = bucket
+		}
+	}
+}
+
+// collapseStatus returns the grpc_status label recorded for the status.
+func (m *ServerMetrics) collapseStatus(status string) string {
+	if bucket, ok := m.collapsedCodes[status]; ok {
+		return bucket
+	}
+	return status
+}
@@ -0,0 +1,38 @@
+package grpcprom
+
+import (
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+// WithStatusDetailsCounter makes the ServerMetrics export grpc_server_status_details_total,
+// counting the details attached to the status of the failed RPCs by their proto type, e.g.
+// google.rpc.ErrorInfo or google.rpc.RetryInfo, so the use of structured errors can be
+// monitored.
+func WithStatusDetailsCounter() ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.statusDetails = prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_status_details_total",
+				Help: "Total number of details attached to the status of the failed RPCs, by proto type.",
+			}, []string{"grpc_service", "grpc_method", "grpc_status", "detail_type"},
+		)
+	}
+}
+
+// countStatusDetails counts the details of the status of a failed RPC.
+func (m *ServerMetrics) countStatusDetails(labels map[string]string, st *status.Status) {
+	if m.statusDetails == nil {
+		return
+	}
+
+	for _, detail := range st.Proto().GetDetails() {
+		typeURL := detail.GetTypeUrl()
+		detailType := typeURL[strings.LastIndex(typeURL, "/")+1:]
+		m.statusDetails.WithLabelValues(
+			labels["grpc_service"], labels["grpc_method"], labels["grpc_status"], detailType,
+		).Inc()
+	}
+}
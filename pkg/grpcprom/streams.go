@@ -0,0 +1,123 @@
+package grpcprom
+
+import (
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// StreamMetrics tracks the streams open on the server. It exports the number of open streams
+// per method and, optionally, the age of the oldest one, so leaked or stuck streams which are
+// never closed show up before they exhaust the server resources.
+type StreamMetrics struct {
+	trackAge bool
+
+	mu   sync.Mutex
+	open map[string]map[*openStream]struct{}
+
+	openDesc *prom.Desc
+	ageDesc  *prom.Desc
+}
+
+type openStream struct {
+	startTime time.Time
+}
+
+// NewStreamMetrics returns the StreamMetrics. When trackAge is true they also export
+// grpc_server_oldest_stream_age_seconds.
+func NewStreamMetrics(trackAge bool) *StreamMetrics {
+	labels := []string{"grpc_service", "grpc_method"}
+	return &StreamMetrics{
+		trackAge: trackAge,
+		open:     map[string]map[*openStream]struct{}{},
+		openDesc: prom.NewDesc(
+			"grpc_server_open_streams",
+			"Number of streams currently open on the server.",
+			labels, nil,
+		),
+		ageDesc: prom.NewDesc(
+			"grpc_server_oldest_stream_age_seconds",
+			"Age (seconds) of the oldest stream currently open on the server.",
+			labels, nil,
+		),
+	}
+}
+
+// Describe describes the stream metrics.
+func (m *StreamMetrics) Describe(ch chan<- *prom.Desc) {
+	ch <- m.openDesc
+	if m.trackAge {
+		ch <- m.ageDesc
+	}
+}
+
+// streamsSnapshot is the number of streams open and the age of the oldest one of a method.
+type streamsSnapshot struct {
+	open   int
+	oldest time.Duration
+}
+
+// Collect collects the open streams of every method which had a stream, and the age of the
+// oldest one. The full methods whose labels are the same once sanitized are aggregated, and the
+// metrics are sent once the lock is released, so a slow registry doesn't block the streams.
+func (m *StreamMetrics) Collect(ch chan<- prom.Metric) {
+	now := time.Now()
+	snapshots := map[[2]string]*streamsSnapshot{}
+
+	m.mu.Lock()
+	for fullMethod, streams := range m.open {
+		service, method := splitMethodName(fullMethod)
+		snapshot, ok := snapshots[[2]string{service, method}]
+		if !ok {
+			snapshot = &streamsSnapshot{}
+			snapshots[[2]string{service, method}] = snapshot
+		}
+		snapshot.open += len(streams)
+		for s := range streams {
+			if age := now.Sub(s.startTime); age > snapshot.oldest {
+				snapshot.oldest = age
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for labels, snapshot := range snapshots {
+		ch <- prom.MustNewConstMetric(m.openDesc, prom.GaugeValue, float64(snapshot.open), labels[0], labels[1])
+		if m.trackAge {
+			ch <- prom.MustNewConstMetric(m.ageDesc, prom.GaugeValue, snapshot.oldest.Seconds(), labels[0], labels[1])
+		}
+	}
+}
+
+func (m *StreamMetrics) opened(fullMethod string) *openStream {
+	s := &openStream{startTime: time.Now()}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	streams, ok := m.open[fullMethod]
+	if !ok {
+		streams = map[*openStream]struct{}{}
+		m.open[fullMethod] = streams
+	}
+	streams[s] = struct{}{}
+	return s
+}
+
+func (m *StreamMetrics) closed(fullMethod string, s *openStream) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.open[fullMethod], s)
+}
+
+// StreamServerInterceptor is a gRPC server-side interceptor tracking the open streams.
+func (m *StreamMetrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		s := m.opened(info.FullMethod)
+		defer m.closed(info.FullMethod, s)
+		return handler(srv, ss)
+	}
+}
@@ -0,0 +1,99 @@
+package grpcprom_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+const openStreamsHeader = `
+# HELP grpc_server_open_streams Number of streams currently open on the server.
+# TYPE grpc_server_open_streams gauge
+`
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		fullMethods []string
+		open        string
+		closed      string
+	}{
+		{
+			name:        "one stream",
+			fullMethods: []string{"/chat.v1.Chat/Subscribe"},
+			open:        `grpc_server_open_streams{grpc_method="Subscribe",grpc_service="chat.v1.Chat"} 1`,
+			closed:      `grpc_server_open_streams{grpc_method="Subscribe",grpc_service="chat.v1.Chat"} 0`,
+		},
+		{
+			name:        "concurrent streams",
+			fullMethods: []string{"/chat.v1.Chat/Subscribe", "/chat.v1.Chat/Subscribe", "/chat.v1.Chat/Upload"},
+			open: `grpc_server_open_streams{grpc_method="Subscribe",grpc_service="chat.v1.Chat"} 2
+grpc_server_open_streams{grpc_method="Upload",grpc_service="chat.v1.Chat"} 1`,
+			closed: `grpc_server_open_streams{grpc_method="Subscribe",grpc_service="chat.v1.Chat"} 0
+grpc_server_open_streams{grpc_method="Upload",grpc_service="chat.v1.Chat"} 0`,
+		},
+		{
+			name:        "same sanitized labels",
+			fullMethods: []string{"/chat.v1.Chat/Sub\nscribe", "/chat.v1.Chat/Sub\tscribe"},
+			open:        `grpc_server_open_streams{grpc_method="Sub_scribe",grpc_service="chat.v1.Chat"} 2`,
+			closed:      `grpc_server_open_streams{grpc_method="Sub_scribe",grpc_service="chat.v1.Chat"} 0`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewStreamMetrics(false)
+			reg := newRegistry(t, m)
+			interceptor := m.StreamServerInterceptor()
+
+			// Every handler opens the next stream, so they are all open in the innermost one.
+			var open func(i int) error
+			open = func(i int) error {
+				if i == len(tt.fullMethods) {
+					assertMetrics(t, reg, openStreamsHeader+tt.open+"\n", "grpc_server_open_streams")
+					return nil
+				}
+				info := &grpc.StreamServerInfo{FullMethod: tt.fullMethods[i], IsServerStream: true}
+				return interceptor(nil, nil, info, func(interface{}, grpc.ServerStream) error {
+					return open(i + 1)
+				})
+			}
+			if err := open(0); err != nil {
+				t.Fatal(err)
+			}
+
+			assertMetrics(t, reg, openStreamsHeader+tt.closed+"\n", "grpc_server_open_streams")
+		})
+	}
+}
+
+func TestStreamMetricsCollectUnlocked(t *testing.T) {
+	m := grpcprom.NewStreamMetrics(true)
+	interceptor := m.StreamServerInterceptor()
+	info := &grpc.StreamServerInfo{FullMethod: "/chat.v1.Chat/Subscribe", IsServerStream: true}
+	handler := func(interface{}, grpc.ServerStream) error { return nil }
+	_ = interceptor(nil, nil, info, handler)
+
+	// The streams must open and close while the collected metrics are not read yet.
+	ch := make(chan prom.Metric)
+	go func() {
+		m.Collect(ch)
+		close(ch)
+	}()
+	// Give the collection the time to block on the first metric.
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		_ = interceptor(nil, nil, info, handler)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream blocked by the collection")
+	}
+	for range ch {
+	}
+}
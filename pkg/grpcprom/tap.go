@@ -0,0 +1,87 @@
+package grpcprom
+
+import (
+	"context"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/tap"
+)
+
+// TapMetrics counts the RPCs received by the server transport, before any interceptor runs, and
+// the ones rejected by a tap handle. Comparing grpc_server_tap_received_total with the handled
+// RPCs shows the RPCs which never reached the interceptors, the blind spot of the handled
+// counter.
+type TapMetrics struct {
+	received *prom.CounterVec
+	rejected *prom.CounterVec
+
+	// methods are the full methods registered on the server, set by InitializeMetrics.
+	methods registeredMethods
+}
+
+// NewTapMetrics returns the TapMetrics. Install them on the server with
+// grpc.InTapHandle(m.ServerInHandle(next)), and call InitializeMetrics once the services are
+// registered: the method names come from the clients before any routing, so the RPCs of the
+// methods which aren't registered, or all of them until InitializeMetrics is called, are labeled
+// unknown.
+func NewTapMetrics() *TapMetrics {
+	return &TapMetrics{
+		received: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_tap_received_total",
+				Help: "Total number of RPCs received by the server transport, before the interceptors.",
+			}, []string{"grpc_service", "grpc_method"},
+		),
+		rejected: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_server_tap_rejected_total",
+				Help: "Total number of RPCs rejected by the tap handle of the server, before the interceptors.",
+			}, []string{"grpc_service", "grpc_method", "grpc_status"},
+		),
+	}
+}
+
+// Describe describes the tap metrics.
+func (m *TapMetrics) Describe(ch chan<- *prom.Desc) {
+	m.received.Describe(ch)
+	m.rejected.Describe(ch)
+}
+
+// Collect collects the tap metrics.
+func (m *TapMetrics) Collect(ch chan<- prom.Metric) {
+	m.received.Collect(ch)
+	m.rejected.Collect(ch)
+}
+
+// InitializeMetrics sets the methods registered on the server, the only ones labeled with their
+// name, and creates their received series with a zero value.
+func (m *TapMetrics) InitializeMetrics(server ServiceInfoProvider) {
+	for _, method := range m.methods.set(server) {
+		m.received.WithLabelValues(method.Service, method.Name)
+	}
+}
+
+// ServerInHandle returns a tap.ServerInHandle counting the received RPCs and calling next, if
+// any, counting the RPCs it rejects with the status code sent to the client.
+func (m *TapMetrics) ServerInHandle(next tap.ServerInHandle) tap.ServerInHandle {
+	return func(ctx context.Context, info *tap.Info) (context.Context, error) {
+		service, method := m.methods.labels(info.FullMethodName)
+		m.received.WithLabelValues(service, method).Inc()
+		if next == nil {
+			return ctx, nil
+		}
+
+		ctx, err := next(ctx, info)
+		if err != nil {
+			// The transport rejects the RPC with PermissionDenied when the error has no status.
+			code := codes.PermissionDenied
+			if st, ok := status.FromError(err); ok {
+				code = st.Code()
+			}
+			m.rejected.WithLabelValues(service, method, code.String()).Inc()
+		}
+		return ctx, err
+	}
+}
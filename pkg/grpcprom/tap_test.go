@@ -0,0 +1,75 @@
+package grpcprom_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/tap"
+)
+
+// fakeServer is a ServiceInfoProvider with a unary and a streaming method.
+type fakeServer struct{}
+
+func (fakeServer) GetServiceInfo() map[string]grpc.ServiceInfo {
+	return map[string]grpc.ServiceInfo{
+		"demo.v1.Greeter": {Methods: []grpc.MethodInfo{
+			{Name: "SayHello"},
+			{Name: "Chat", IsClientStream: true, IsServerStream: true},
+		}},
+	}
+}
+
+func TestTapMetricsUnknownMethods(t *testing.T) {
+	const header = `
+# HELP grpc_server_tap_received_total Total number of RPCs received by the server transport, before the interceptors.
+# TYPE grpc_server_tap_received_total counter
+`
+	tests := []struct {
+		name        string
+		initialize  bool
+		fullMethods []string
+		want        string
+	}{
+		{
+			name:        "registered methods",
+			initialize:  true,
+			fullMethods: []string{"/demo.v1.Greeter/SayHello", "/demo.v1.Greeter/SayHello"},
+			want: `grpc_server_tap_received_total{grpc_method="Chat",grpc_service="demo.v1.Greeter"} 0
+grpc_server_tap_received_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter"} 2`,
+		},
+		{
+			name:        "unknown methods",
+			initialize:  true,
+			fullMethods: []string{"/demo.v1.Greeter/SayHello", "/demo.v1.Greeter/Random1", "/evil.Service/Random2"},
+			want: `grpc_server_tap_received_total{grpc_method="Chat",grpc_service="demo.v1.Greeter"} 0
+grpc_server_tap_received_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter"} 1
+grpc_server_tap_received_total{grpc_method="unknown",grpc_service="unknown"} 2`,
+		},
+		{
+			name:        "not initialized",
+			fullMethods: []string{"/demo.v1.Greeter/SayHello"},
+			want:        `grpc_server_tap_received_total{grpc_method="unknown",grpc_service="unknown"} 1`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewTapMetrics()
+			reg := newRegistry(t, m)
+			if tt.initialize {
+				m.InitializeMetrics(fakeServer{})
+			}
+
+			handle := m.ServerInHandle(nil)
+			for _, fullMethod := range tt.fullMethods {
+				if _, err := handle(context.Background(), &tap.Info{FullMethodName: fullMethod}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			assertMetrics(t, reg, header+strings.TrimSpace(tt.want)+"\n", "grpc_server_tap_received_total")
+		})
+	}
+}
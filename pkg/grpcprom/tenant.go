@@ -0,0 +1,80 @@
+package grpcprom
+
+import (
+	"net/http"
+	"path"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// TenantHandler serves the metrics of a gatherer filtered to the series of one tenant, so the
+// tenant-scoped monitoring stacks can scrape only their own data. The tenant is the {id} wildcard
+// of the route it is registered with, e.g. "/metrics/tenant/{id}", or else the last element of
+// the path. The series without the tenant label, like the process metrics, are never served.
+//
+// Every request is authorized for its tenant, so a tenant can't read the series of the others
+// by changing the path; the unauthorized ones get a 403 Forbidden.
+type TenantHandler struct {
+	gatherer  prom.Gatherer
+	label     string
+	authorize func(r *http.Request, tenant string) bool
+	opts      promhttp.HandlerOpts
+}
+
+// NewTenantHandler returns a TenantHandler serving the series of gatherer whose label is the
+// requested tenant to the requests authorize accepts for it, e.g.
+// NewTenantHandler(reg, "userName", authorize, promhttp.HandlerOpts{}). It panics if authorize
+// is nil.
+func NewTenantHandler(gatherer prom.Gatherer, label string, authorize func(r *http.Request, tenant string) bool, opts promhttp.HandlerOpts) *TenantHandler {
+	if authorize == nil {
+		panic("tenant handler without authorize function")
+	}
+	return &TenantHandler{gatherer: gatherer, label: label, authorize: authorize, opts: opts}
+}
+
+// ServeHTTP serves the series of the requested tenant.
+func (h *TenantHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant := r.PathValue("id")
+	if tenant == "" {
+		tenant = path.Base(r.URL.Path)
+	}
+	if tenant == "" || tenant == "/" || tenant == "." {
+		http.NotFound(w, r)
+		return
+	}
+	if !h.authorize(r, tenant) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	gatherer := prom.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := h.gatherer.Gather()
+		return filterTenant(families, h.label, tenant), err
+	})
+	promhttp.HandlerFor(gatherer, h.opts).ServeHTTP(w, r)
+}
+
+// filterTenant keeps the metrics whose label has the tenant value, and the families left with
+// any metric.
+func filterTenant(families []*dto.MetricFamily, label, tenant string) []*dto.MetricFamily {
+	filtered := families[:0]
+	for _, family := range families {
+		var metrics []*dto.Metric
+		for _, metric := range family.GetMetric() {
+			for _, pair := range metric.GetLabel() {
+				if pair.GetName() == label && pair.GetValue() == tenant {
+					metrics = append(metrics, metric)
+					break
+				}
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+		family.Metric = metrics
+		filtered = append(filtered, family)
+	}
+	return filtered
+}
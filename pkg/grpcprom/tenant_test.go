@@ -0,0 +1,83 @@
+package grpcprom_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestTenantHandler(t *testing.T) {
+	calls := prom.NewCounterVec(prom.CounterOpts{Name: "demo_calls_total", Help: "Calls."}, []string{"userName"})
+	calls.WithLabelValues("alice").Add(1)
+	calls.WithLabelValues("bob").Add(2)
+	inFlight := prom.NewGauge(prom.GaugeOpts{Name: "demo_in_flight", Help: "In flight."})
+	inFlight.Set(3)
+
+	mux := http.NewServeMux()
+	// The requests are authorized for the tenant of their X-Scope-OrgID header.
+	authorize := func(r *http.Request, tenant string) bool {
+		return r.Header.Get("X-Scope-OrgID") == tenant
+	}
+	mux.Handle("/metrics/tenant/{id}", grpcprom.NewTenantHandler(newRegistry(t, calls, inFlight), "userName", authorize, promhttp.HandlerOpts{}))
+
+	tests := []struct {
+		name       string
+		path       string
+		orgID      string
+		wantStatus int
+		want       string
+	}{
+		{
+			name:       "tenant",
+			path:       "/metrics/tenant/bob",
+			orgID:      "bob",
+			wantStatus: http.StatusOK,
+			want: `# HELP demo_calls_total Calls.
+# TYPE demo_calls_total counter
+demo_calls_total{userName="bob"} 2
+`,
+		},
+		{
+			name:       "unknown tenant",
+			path:       "/metrics/tenant/carol",
+			orgID:      "carol",
+			wantStatus: http.StatusOK,
+			want:       "",
+		},
+		{
+			name:       "other tenant",
+			path:       "/metrics/tenant/bob",
+			orgID:      "alice",
+			wantStatus: http.StatusForbidden,
+			want:       "forbidden\n",
+		},
+		{
+			name:       "no tenant",
+			path:       "/metrics/tenant/bob",
+			wantStatus: http.StatusForbidden,
+			want:       "forbidden\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", "text/plain")
+			if tt.orgID != "" {
+				req.Header.Set("X-Scope-OrgID", tt.orgID)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("got body %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
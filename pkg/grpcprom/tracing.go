@@ -0,0 +1,159 @@
+package grpcprom
+
+import (
+	"context"
+	"sort"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// WithTracer makes the unary interceptor start an OpenTelemetry server span with tracer for every
+// RPC, child of the W3C traceparent of the caller. The trace ID of the span is attached to the
+// handling time observations as exemplar, so metrics and traces are correlated by the same
+// middleware.
+func WithTracer(tracer trace.Tracer) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.tracer = tracer
+	}
+}
+
+// WithSpanAttributes makes the ServerMetrics copy the labels of every RPC, including grpc_status,
+// to the attributes of its span when one is recording, so metrics and traces have the same
+// dimensions. The mapping renames label names to attribute keys, e.g. userName to enduser.id;
+// the labels missing from the mapping keep their name.
+func WithSpanAttributes(mapping map[string]string) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.spanAttributes = true
+		m.attributeMapping = mapping
+	}
+}
+
+// setSpanAttributes copies the labels to the attributes of the span.
+func (m *ServerMetrics) setSpanAttributes(span trace.Span, labels map[string]string) {
+	if !m.spanAttributes || span == nil || !span.IsRecording() {
+		return
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(labels))
+	for name, value := range labels {
+		key, ok := m.attributeMapping[name]
+		if !ok {
+			key = name
+		}
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	span.SetAttributes(attrs...)
+}
+
+// SpanLabelExtractor is a LabelExtractor reading the labels from the attributes of the span of
+// the RPC, the other way around of WithSpanAttributes. The span must expose its attributes, like
+// the spans of the OpenTelemetry SDK do; otherwise every label gets the default value.
+type SpanLabelExtractor struct {
+	// mapping maps the attribute keys to label names.
+	mapping map[string]string
+}
+
+// NewSpanLabelExtractor returns a SpanLabelExtractor exposing the attributes of the mapping,
+// keyed by attribute key, as the labels they are mapped to.
+func NewSpanLabelExtractor(mapping map[string]string) *SpanLabelExtractor {
+	return &SpanLabelExtractor{mapping: mapping}
+}
+
+// LabelNames returns the label names of the mapping, sorted
+func (e *SpanLabelExtractor) LabelNames() []string {
+	names := make([]string, 0, len(e.mapping))
+	for _, name := range e.mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Labels returns the mapped attributes of the span in the context
+func (e *SpanLabelExtractor) Labels(ctx context.Context) map[string]string {
+	labels := map[string]string{}
+	span, ok := trace.SpanFromContext(ctx).(interface{ Attributes() []attribute.KeyValue })
+	if !ok {
+		return labels
+	}
+
+	for _, kv := range span.Attributes() {
+		if name, ok := e.mapping[string(kv.Key)]; ok {
+			labels[name] = kv.Value.Emit()
+		}
+	}
+	return labels
+}
+
+// metadataCarrier adapts the incoming metadata to a propagation.TextMapCarrier.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startSpan parses the W3C traceparent of the incoming metadata, unless the context already
+// has a span, e.g. from a tracing stats handler, and starts the server span when there is a
+// tracer. The returned span is nil when no span was started.
+func (m *ServerMetrics) startSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			ctx = propagation.TraceContext{}.Extract(ctx, metadataCarrier(md))
+		}
+	}
+	if m.tracer == nil {
+		return ctx, nil
+	}
+
+	service, method := splitMethodName(fullMethod)
+	return m.tracer.Start(ctx, fullMethod,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "grpc"),
+			attribute.String("rpc.service", service),
+			attribute.String("rpc.method", method),
+		),
+	)
+}
+
+// endSpan records the status of the RPC on the span started by startSpan and ends it.
+func endSpan(span trace.Span, code codes.Code, msg string) {
+	if span == nil {
+		return
+	}
+
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(code)))
+	if code != codes.OK {
+		span.SetStatus(otelcodes.Error, msg)
+	}
+	span.End()
+}
+
+// traceID returns the trace ID of the span in the context, local or remote, if any.
+func traceID(ctx context.Context) (string, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return "", false
+	}
+	return sc.TraceID().String(), true
+}
@@ -0,0 +1,213 @@
+package grpcprom
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// http2FrameHeaderLen is the length of the header of the HTTP/2 frames.
+	http2FrameHeaderLen = 9
+	// goAwayPayloadLen is the length of the last stream ID and the error code of a GOAWAY frame.
+	goAwayPayloadLen = 8
+)
+
+// frameScanner follows the HTTP/2 frames sent in one direction of a connection, read or written
+// in chunks of any size, and calls onGoAway with the error code of the GOAWAY frames.
+type frameScanner struct {
+	// skip is the number of bytes of the client connection preface still to skip.
+	skip int
+
+	header    [http2FrameHeaderLen]byte
+	headerLen int
+	// remaining is the number of bytes of the payload of the current frame still to read.
+	remaining int
+	goAway    bool
+	payload   []byte
+
+	onGoAway func(code http2.ErrCode)
+}
+
+// scan follows the frames of the bytes, which continue the previous ones.
+func (s *frameScanner) scan(p []byte) {
+	for len(p) > 0 {
+		switch {
+		case s.skip > 0:
+			n := min(s.skip, len(p))
+			s.skip -= n
+			p = p[n:]
+		case s.remaining > 0:
+			n := min(s.remaining, len(p))
+			if s.goAway && len(s.payload) < goAwayPayloadLen {
+				s.payload = append(s.payload, p[:min(n, goAwayPayloadLen-len(s.payload))]...)
+			}
+			s.remaining -= n
+			p = p[n:]
+			if s.remaining == 0 {
+				s.endFrame()
+			}
+		default:
+			n := copy(s.header[s.headerLen:], p)
+			s.headerLen += n
+			p = p[n:]
+			if s.headerLen < http2FrameHeaderLen {
+				continue
+			}
+			s.headerLen = 0
+			s.remaining = int(s.header[0])<<16 | int(s.header[1])<<8 | int(s.header[2])
+			s.goAway = http2.FrameType(s.header[3]) == http2.FrameGoAway
+			s.payload = s.payload[:0]
+			if s.remaining == 0 {
+				s.endFrame()
+			}
+		}
+	}
+}
+
+// endFrame handles the frame which was just read.
+func (s *frameScanner) endFrame() {
+	if s.goAway && len(s.payload) == goAwayPayloadLen {
+		s.onGoAway(http2.ErrCode(binary.BigEndian.Uint32(s.payload[4:])))
+	}
+	s.goAway = false
+}
+
+// transportConn is the state of a connection shared with the stats handlers, telling why its
+// RPCs were terminated.
+type transportConn struct {
+	goAwaySent     atomic.Bool
+	goAwayReceived atomic.Bool
+	closed         atomic.Bool
+}
+
+// scannedConn is a connection whose HTTP/2 frames are followed, wrapped by the transport
+// credentials of the TransportMetrics.
+type scannedConn struct {
+	net.Conn
+	metrics *TransportMetrics
+	side    string
+	key     string
+	state   transportConn
+
+	// The frames are read by the reader goroutine and written by the writer goroutine of the
+	// transport, so each scanner is only used by one goroutine.
+	read, written frameScanner
+	closeOnce     sync.Once
+}
+
+func newScannedConn(m *TransportMetrics, side string, conn net.Conn) *scannedConn {
+	c := &scannedConn{
+		Conn:    conn,
+		metrics: m,
+		side:    side,
+		key:     connKey(side, conn.LocalAddr(), conn.RemoteAddr()),
+	}
+	c.read.onGoAway = func(code http2.ErrCode) {
+		c.state.goAwayReceived.Store(true)
+		m.goAways.WithLabelValues(side, "received", goAwayCode(code)).Inc()
+	}
+	c.written.onGoAway = func(code http2.ErrCode) {
+		c.state.goAwaySent.Store(true)
+		m.goAways.WithLabelValues(side, "sent", goAwayCode(code)).Inc()
+	}
+	if side == "server" {
+		c.read.skip = len(http2.ClientPreface)
+	} else {
+		c.written.skip = len(http2.ClientPreface)
+	}
+	if c.key != "" {
+		m.conns.Store(c.key, &c.state)
+	}
+	return c
+}
+
+// goAwayCode returns the code label of a GOAWAY frame. The codes which are not defined by HTTP/2
+// come from the peer, so they are all labeled unknown.
+func goAwayCode(code http2.ErrCode) string {
+	if code > http2.ErrCodeHTTP11Required {
+		return unknownName
+	}
+	return code.String()
+}
+
+// connKey returns the key of the connection of the side with the addresses, which the stats
+// handlers find the connection with, or "" when the addresses don't identify the connection,
+// like the clients of a unix socket.
+func connKey(side string, local, remote net.Addr) string {
+	if local == nil || remote == nil {
+		return ""
+	}
+	l, r := local.String(), remote.String()
+	if l == "" || r == "" || l == "@" || r == "@" {
+		return ""
+	}
+	return side + "|" + l + "|" + r
+}
+
+func (c *scannedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read.scan(p[:n])
+	if err != nil {
+		c.state.closed.Store(true)
+	}
+	return n, err
+}
+
+func (c *scannedConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.scan(p[:n])
+	return n, err
+}
+
+func (c *scannedConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.state.closed.Store(true)
+		if c.key != "" {
+			c.metrics.conns.CompareAndDelete(c.key, &c.state)
+		}
+	})
+	return c.Conn.Close()
+}
+
+// transportCredentials wraps the connections of the transport credentials in scannedConns.
+type transportCredentials struct {
+	credentials.TransportCredentials
+	metrics *TransportMetrics
+}
+
+// Credentials wraps the transport credentials of a server or a client, e.g.
+// insecure.NewCredentials(), to count the GOAWAY frames sent and received in
+// grpc_transport_goaways_total and to tell the RPCs terminated by a GOAWAY from the ones
+// terminated by a connection reset. Install them with grpc.Creds or grpc.WithTransportCredentials,
+// along with the stats handler. The frames are followed after the TLS handshake, so they are
+// counted with TLS too. The connections of the unix sockets can't be told apart by their
+// addresses, so their RPCs are classified as without the Credentials.
+func (m *TransportMetrics) Credentials(creds credentials.TransportCredentials) credentials.TransportCredentials {
+	return &transportCredentials{TransportCredentials: creds, metrics: m}
+}
+
+func (c *transportCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, rawConn)
+	if err != nil {
+		return conn, info, err
+	}
+	return newScannedConn(c.metrics, "client", conn), info, nil
+}
+
+func (c *transportCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	conn, info, err := c.TransportCredentials.ServerHandshake(rawConn)
+	if err != nil {
+		return conn, info, err
+	}
+	return newScannedConn(c.metrics, "server", conn), info, nil
+}
+
+func (c *transportCredentials) Clone() credentials.TransportCredentials {
+	return &transportCredentials{TransportCredentials: c.TransportCredentials.Clone(), metrics: c.metrics}
+}
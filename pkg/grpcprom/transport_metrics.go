@@ -0,0 +1,193 @@
+package grpcprom
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/stats"
+)
+
+// TransportMetrics counts the connections, the GOAWAY frames and the RPCs killed by the
+// transport: streams reset with RST_STREAM, streams closed by a GOAWAY and connections reset,
+// which otherwise only show up as Canceled or Unavailable codes. They are recorded with stats
+// handlers, see ServerHandler and ClientHandler, and with the connections of the transport
+// credentials, see Credentials.
+type TransportMetrics struct {
+	connections *prom.CounterVec
+	errors      *prom.CounterVec
+	goAways     *prom.CounterVec
+
+	// conns holds the *transportConn of the open connections wrapped by Credentials, by connKey.
+	conns sync.Map
+	// methods are the full methods registered on the server, set by InitializeMetrics.
+	methods registeredMethods
+}
+
+// NewTransportMetrics returns the TransportMetrics.
+func NewTransportMetrics() *TransportMetrics {
+	return &TransportMetrics{
+		connections: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_transport_connections_total",
+				Help: "Total number of connections opened and closed.",
+			}, []string{"side", "event"},
+		),
+		errors: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_transport_errors_total",
+				Help: "Total number of RPCs terminated by a transport event: rst_stream, goaway or connection_reset.",
+			}, []string{"side", "grpc_service", "grpc_method", "reason"},
+		),
+		goAways: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "grpc_transport_goaways_total",
+				Help: "Total number of GOAWAY frames sent and received, by HTTP/2 error code.",
+			}, []string{"side", "direction", "code"},
+		),
+	}
+}
+
+// Describe describes the transport metrics.
+func (m *TransportMetrics) Describe(ch chan<- *prom.Desc) {
+	m.connections.Describe(ch)
+	m.errors.Describe(ch)
+	m.goAways.Describe(ch)
+}
+
+// Collect collects the transport metrics.
+func (m *TransportMetrics) Collect(ch chan<- prom.Metric) {
+	m.connections.Collect(ch)
+	m.errors.Collect(ch)
+	m.goAways.Collect(ch)
+}
+
+// InitializeMetrics sets the methods registered on the server, the only ones the errors of the
+// server are labeled with. The method names of the server RPCs come from the clients before any
+// routing, so the RPCs of the methods which aren't registered, or all of them until
+// InitializeMetrics is called, are labeled unknown.
+func (m *TransportMetrics) InitializeMetrics(server ServiceInfoProvider) {
+	m.methods.set(server)
+}
+
+// ServerHandler returns the stats.Handler of a server, to install with grpc.StatsHandler. The
+// RPCs which end without sending their trailers were reset by the client, or lost their
+// connection; the connection reset and the GOAWAY sent by the server are only told apart from
+// the RST_STREAM with the Credentials installed.
+func (m *TransportMetrics) ServerHandler() stats.Handler {
+	return &transportHandler{metrics: m, side: "server"}
+}
+
+// ClientHandler returns the stats.Handler of a client, to install with grpc.WithStatsHandler. The
+// RPCs which end without receiving their trailers, and weren't canceled by the client, were
+// reset by the server or lost their connection, which is only told with the Credentials
+// installed.
+func (m *TransportMetrics) ClientHandler() stats.Handler {
+	return &transportHandler{metrics: m, side: "client"}
+}
+
+type transportHandler struct {
+	metrics *TransportMetrics
+	side    string
+}
+
+// transportRPC is the state of an RPC, following its stats events.
+type transportRPC struct {
+	fullMethod string
+	// conn is the state of the connection of the RPC, nil when it isn't wrapped by Credentials.
+	conn    atomic.Pointer[transportConn]
+	trailer atomic.Bool
+}
+
+type transportRPCKey struct{}
+
+func (h *transportHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, transportRPCKey{}, &transportRPC{fullMethod: info.FullMethodName})
+}
+
+func (h *transportHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	rpc, ok := ctx.Value(transportRPCKey{}).(*transportRPC)
+	if !ok {
+		return
+	}
+
+	switch s := s.(type) {
+	case *stats.InHeader:
+		if !s.Client {
+			h.trackConn(rpc, s.LocalAddr, s.RemoteAddr)
+		}
+	case *stats.OutHeader:
+		if s.Client {
+			h.trackConn(rpc, s.LocalAddr, s.RemoteAddr)
+		}
+	case *stats.InTrailer, *stats.OutTrailer:
+		rpc.trailer.Store(true)
+	case *stats.End:
+		if s.Error == nil || rpc.trailer.Load() {
+			return
+		}
+		reason, ok := h.errorReason(ctx, rpc)
+		if !ok {
+			return
+		}
+		service, method := splitMethodName(rpc.fullMethod)
+		if h.side == "server" {
+			service, method = h.metrics.methods.labels(rpc.fullMethod)
+		}
+		h.metrics.errors.WithLabelValues(h.side, service, method, reason).Inc()
+	}
+}
+
+// trackConn attaches the state of the connection with the addresses to the RPC.
+func (h *transportHandler) trackConn(rpc *transportRPC, local, remote net.Addr) {
+	key := connKey(h.side, local, remote)
+	if key == "" {
+		return
+	}
+	if conn, ok := h.metrics.conns.Load(key); ok {
+		rpc.conn.Store(conn.(*transportConn))
+	}
+}
+
+// errorReason classifies an RPC which ended with an error without its trailers, so it was
+// terminated by the transport, from the state of its connection.
+func (h *transportHandler) errorReason(ctx context.Context, rpc *transportRPC) (string, bool) {
+	conn := rpc.conn.Load()
+	if h.side == "client" {
+		// The RPCs canceled by the client, or whose deadline expired, reset their own stream.
+		if ctx.Err() != nil {
+			return "", false
+		}
+		// The RPCs which failed before getting a stream, e.g. without a ready connection, were
+		// never sent to the transport.
+		if conn == nil {
+			return "", false
+		}
+	}
+
+	switch {
+	case conn == nil:
+		return "rst_stream", true
+	case conn.closed.Load() && (conn.goAwaySent.Load() || conn.goAwayReceived.Load()):
+		return "goaway", true
+	case conn.closed.Load():
+		return "connection_reset", true
+	default:
+		return "rst_stream", true
+	}
+}
+
+func (h *transportHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *transportHandler) HandleConn(_ context.Context, s stats.ConnStats) {
+	switch s.(type) {
+	case *stats.ConnBegin:
+		h.metrics.connections.WithLabelValues(h.side, "opened").Inc()
+	case *stats.ConnEnd:
+		h.metrics.connections.WithLabelValues(h.side, "closed").Inc()
+	}
+}
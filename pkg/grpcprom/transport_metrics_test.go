@@ -0,0 +1,186 @@
+package grpcprom
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestFrameScanner(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString(http2.ClientPreface)
+	framer := http2.NewFramer(&buf, nil)
+	if err := framer.WriteSettings(http2.Setting{ID: http2.SettingMaxFrameSize, Val: 1 << 14}); err != nil {
+		t.Fatal(err)
+	}
+	if err := framer.WriteData(1, false, bytes.Repeat([]byte{byte(http2.FrameGoAway)}, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := framer.WriteGoAway(7, http2.ErrCodeNo, []byte("draining")); err != nil {
+		t.Fatal(err)
+	}
+	if err := framer.WriteRSTStream(3, http2.ErrCodeCancel); err != nil {
+		t.Fatal(err)
+	}
+	if err := framer.WriteGoAway(7, http2.ErrCodeEnhanceYourCalm, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []http2.ErrCode{http2.ErrCodeNo, http2.ErrCodeEnhanceYourCalm}
+
+	// The frames must be followed whatever the size of the chunks read or written.
+	for _, chunk := range []int{1, 5, 9, 64, buf.Len()} {
+		var got []http2.ErrCode
+		s := &frameScanner{
+			skip:     len(http2.ClientPreface),
+			onGoAway: func(code http2.ErrCode) { got = append(got, code) },
+		}
+		for p := buf.Bytes(); len(p) > 0; p = p[min(chunk, len(p)):] {
+			s.scan(p[:min(chunk, len(p))])
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("chunks of %d bytes: GOAWAY codes %v, want %v", chunk, got, want)
+		}
+	}
+}
+
+// startTransportServer serves the health service, whose Watch streams stay open until they are
+// canceled, like the RPCs of the unknown methods, with the transport metrics of both sides
+// installed.
+func startTransportServer(t *testing.T, m *TransportMetrics) (*grpc.Server, *grpc.ClientConn) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(
+		grpc.Creds(m.Credentials(insecure.NewCredentials())),
+		grpc.StatsHandler(m.ServerHandler()),
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			<-stream.Context().Done()
+			return stream.Context().Err()
+		}),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	m.InitializeMetrics(srv)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(m.Credentials(insecure.NewCredentials())),
+		grpc.WithStatsHandler(m.ClientHandler()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return srv, conn
+}
+
+// watch opens a Watch stream and waits for its first response, so it's running on the server.
+func watch(t *testing.T, ctx context.Context, client healthpb.HealthClient) healthpb.Health_WatchClient {
+	t.Helper()
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	return stream
+}
+
+// waitForCount waits for the count of the errors of the side and reason, recorded once the RPCs
+// end on both sides.
+func waitForCount(t *testing.T, m *TransportMetrics, side, reason string, want float64) {
+	t.Helper()
+	waitForMethodCount(t, m, side, "grpc.health.v1.Health", "Watch", reason, want)
+}
+
+// waitForMethodCount is like waitForCount for the errors of the service and method.
+func waitForMethodCount(t *testing.T, m *TransportMetrics, side, service, method, reason string, want float64) {
+	t.Helper()
+	counter := m.errors.WithLabelValues(side, service, method, reason)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if testutil.ToFloat64(counter) == want {
+			return
+		}
+	}
+	t.Fatalf("%s %s errors: %v, want %v", side, reason, testutil.ToFloat64(counter), want)
+}
+
+func TestTransportErrors(t *testing.T) {
+	t.Run("canceled by the client", func(t *testing.T) {
+		m := NewTransportMetrics()
+		_, conn := startTransportServer(t, m)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		watch(t, ctx, healthpb.NewHealthClient(conn))
+		cancel()
+
+		waitForCount(t, m, "server", "rst_stream", 1)
+		if n := testutil.CollectAndCount(m, "grpc_transport_errors_total"); n != 1 {
+			t.Errorf("%d errors series, the client must not count its own cancellation", n)
+		}
+	})
+
+	t.Run("goaway", func(t *testing.T) {
+		m := NewTransportMetrics()
+		srv, conn := startTransportServer(t, m)
+
+		stream := watch(t, context.Background(), healthpb.NewHealthClient(conn))
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		for testutil.ToFloat64(m.goAways.WithLabelValues("client", "received", "NO_ERROR")) == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		srv.Stop()
+		<-stopped
+		if _, err := stream.Recv(); err == nil {
+			t.Fatal("Watch stream still open after the server stopped")
+		}
+
+		waitForCount(t, m, "server", "goaway", 1)
+		waitForCount(t, m, "client", "goaway", 1)
+		if n := testutil.ToFloat64(m.goAways.WithLabelValues("server", "sent", "NO_ERROR")); n == 0 {
+			t.Error("GOAWAY sent by the server not counted")
+		}
+	})
+}
+
+func TestTransportErrorsUnknownMethods(t *testing.T) {
+	m := NewTransportMetrics()
+	_, conn := startTransportServer(t, m)
+
+	// The client resets the streams of made up methods, which must not create their own series.
+	for _, fullMethod := range []string{"/made.Up/Method1", "/made.Up/Method2"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ClientStreams: true, ServerStreams: true}, fullMethod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := stream.SendMsg(&healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatal(err)
+		}
+		// Wait for the server to handle the stream before resetting it.
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}
+
+	waitForMethodCount(t, m, "server", unknownName, unknownName, "rst_stream", 2)
+	if n := testutil.CollectAndCount(m, "grpc_transport_errors_total"); n != 1 {
+		t.Errorf("%d errors series, want only the unknown one", n)
+	}
+}
@@ -0,0 +1,90 @@
+package grpcprom
+
+import (
+	"context"
+
+	"github.com/twitchtv/twirp"
+	"google.golang.org/grpc/codes"
+)
+
+// twirpCodes maps the Twirp error codes to the gRPC code used as grpc_status label.
+var twirpCodes = map[twirp.ErrorCode]codes.Code{
+	twirp.Canceled:           codes.Canceled,
+	twirp.Unknown:            codes.Unknown,
+	twirp.InvalidArgument:    codes.InvalidArgument,
+	twirp.Malformed:          codes.InvalidArgument,
+	twirp.DeadlineExceeded:   codes.DeadlineExceeded,
+	twirp.NotFound:           codes.NotFound,
+	twirp.BadRoute:           codes.Unimplemented,
+	twirp.AlreadyExists:      codes.AlreadyExists,
+	twirp.PermissionDenied:   codes.PermissionDenied,
+	twirp.Unauthenticated:    codes.Unauthenticated,
+	twirp.ResourceExhausted:  codes.ResourceExhausted,
+	twirp.FailedPrecondition: codes.FailedPrecondition,
+	twirp.Aborted:            codes.Aborted,
+	twirp.OutOfRange:         codes.OutOfRange,
+	twirp.Unimplemented:      codes.Unimplemented,
+	twirp.Internal:           codes.Internal,
+	twirp.Unavailable:        codes.Unavailable,
+	twirp.DataLoss:           codes.DataLoss,
+}
+
+type twirpReporterKey struct{}
+
+// TwirpHooks returns the Twirp server hooks recording the ServerMetrics for a Twirp server, with
+// the service, method and status labels mapped from the Twirp semantics. Pass them to the
+// generated Twirp server with twirp.WithServerHooks.
+func (m *ServerMetrics) TwirpHooks() *twirp.ServerHooks {
+	return &twirp.ServerHooks{
+		RequestReceived: func(ctx context.Context) (context.Context, error) {
+			// The method is only known once the request is routed.
+			monitor := newServerReporter(ctx, m, "", map[string]string{})
+			ctx = m.contextWithLabels(m.contextWithRPCValues(ctx, monitor), monitor)
+			return context.WithValue(ctx, twirpReporterKey{}, monitor), nil
+		},
+		Error: func(ctx context.Context, err twirp.Error) context.Context {
+			if monitor, ok := ctx.Value(twirpReporterKey{}).(*serverReporter); ok {
+				code, ok := twirpCodes[err.Code()]
+				if !ok {
+					code = codes.Unknown
+				}
+				monitor.labels["grpc_status"] = code.String()
+			}
+			return ctx
+		},
+		ResponseSent: func(ctx context.Context) {
+			monitor, ok := ctx.Value(twirpReporterKey{}).(*serverReporter)
+			if !ok {
+				return
+			}
+
+			// The grpc_status label of the metric labels is the default one; the real status is the
+			// one set by the Error hook, or OK.
+			status, ok := monitor.labels["grpc_status"]
+			if !ok {
+				status = codes.OK.String()
+			}
+			monitor.fullMethod = twirpFullMethod(ctx)
+			for k, v := range m.metricLabels(ctx, monitor.fullMethod) {
+				monitor.labels[k] = v
+			}
+			monitor.labels["grpc_status"] = status
+			monitor.Handled()
+		},
+	}
+}
+
+// twirpFullMethod returns the gRPC style full method name (/package.Service/Method) of the
+// Twirp request. Requests which were not routed end up with unknown service and method.
+func twirpFullMethod(ctx context.Context) string {
+	service, ok := twirp.ServiceName(ctx)
+	if !ok {
+		return ""
+	}
+	if pkg, ok := twirp.PackageName(ctx); ok && pkg != "" {
+		service = pkg + "." + service
+	}
+
+	method, _ := twirp.MethodName(ctx)
+	return "/" + service + "/" + method
+}
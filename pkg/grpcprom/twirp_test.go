@@ -0,0 +1,57 @@
+package grpcprom_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twitchtv/twirp"
+	"github.com/twitchtv/twirp/ctxsetters"
+)
+
+func TestTwirpHooksStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  twirp.Error
+		want string
+	}{
+		{name: "ok", want: "OK"},
+		{name: "not found", err: twirp.NotFoundError("no such user"), want: "NotFound"},
+		{name: "malformed", err: twirp.NewError(twirp.Malformed, "bad json"), want: "InvalidArgument"},
+		{name: "internal", err: twirp.InternalError("boom"), want: "Internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{})
+			reg := prom.NewRegistry()
+			if err := m.Register(reg); err != nil {
+				t.Fatal(err)
+			}
+			hooks := m.TwirpHooks()
+
+			ctx := ctxsetters.WithPackageName(context.Background(), "demo.v1")
+			ctx = ctxsetters.WithServiceName(ctx, "Greeter")
+			ctx = ctxsetters.WithMethodName(ctx, "SayHello")
+			ctx, err := hooks.RequestReceived(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.err != nil {
+				ctx = hooks.Error(ctx, tt.err)
+			}
+			hooks.ResponseSent(ctx)
+
+			want := `
+# HELP grpc_server_handled_total Total number of RPCs completed on the server, regardless of success or failure.
+# TYPE grpc_server_handled_total counter
+grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="` + tt.want + `"} 1
+`
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "grpc_server_handled_total"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
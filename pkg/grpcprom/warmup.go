@@ -0,0 +1,83 @@
+package grpcprom
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// warmupLabel is the label of the RPCs handled during the warmup with WarmupLabel.
+const warmupLabel = "warmup"
+
+// WarmupMode tells what WithWarmup does with the RPCs handled during the warmup.
+type WarmupMode int
+
+const (
+	// WarmupExclude only counts the warmup RPCs in grpc_server_handled_total: their handling
+	// time is left out of the histograms, the SLOs and the stats window.
+	WarmupExclude WarmupMode = iota
+	// WarmupLabel records the warmup RPCs like the others, with the warmup label set to true.
+	WarmupLabel
+)
+
+// warmup tracks the warmup of every method.
+type warmup struct {
+	requests int
+	until    time.Time
+	mode     WarmupMode
+
+	mu      sync.Mutex
+	handled map[[2]string]int
+}
+
+// WithWarmup makes the ServerMetrics treat the first requests RPCs of every method, and all the
+// RPCs of the first period after the ServerMetrics is created, as warmup, so the outliers of the
+// JIT, cache or connection warmup don't pollute the steady-state latency and SLO measurements.
+// Zero disables either condition. WarmupLabel adds the warmup label to the metrics.
+func WithWarmup(requests int, period time.Duration, mode WarmupMode) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		m.warmup = &warmup{
+			requests: requests,
+			until:    time.Now().Add(period),
+			mode:     mode,
+			handled:  map[[2]string]int{},
+		}
+		if mode == WarmupLabel {
+			m.labels = append(m.labels, warmupLabel)
+		}
+	}
+}
+
+// warmingUp reports if the RPC of the method handled now is part of the warmup. The RPCs of the
+// period count toward the requests of the method, so after the period an RPC is only warmup if
+// the method has handled fewer than requests RPCs in total.
+func (w *warmup) warmingUp(service, method string, now time.Time) bool {
+	inPeriod := now.Before(w.until)
+	if w.requests <= 0 {
+		return inPeriod
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	key := [2]string{service, method}
+	if w.handled[key] >= w.requests {
+		return inPeriod
+	}
+	w.handled[key]++
+	return true
+}
+
+// checkWarmup sets the warmup label of the RPC and reports if its handling time must be left out.
+func (m *ServerMetrics) checkWarmup(labels map[string]string) bool {
+	if m.warmup == nil {
+		return false
+	}
+
+	warmingUp := m.warmup.warmingUp(labels["grpc_service"], labels["grpc_method"], time.Now())
+	if m.warmup.mode == WarmupLabel {
+		labels[warmupLabel] = strconv.FormatBool(warmingUp)
+		return false
+	}
+	return warmingUp
+}
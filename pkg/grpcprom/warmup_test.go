@@ -0,0 +1,59 @@
+package grpcprom_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+)
+
+func TestWarmupRequestsCountedDuringPeriod(t *testing.T) {
+	const (
+		fullMethod = "/demo.v1.Greeter/SayHello"
+		period     = 50 * time.Millisecond
+	)
+
+	// The 2 RPCs of the period are the 2 warmup requests, so the RPC after the period is not
+	// warmup.
+	call := func(m *grpcprom.ServerMetrics) {
+		callUnary(m, context.Background(), nil, fullMethod, nil)
+		callUnary(m, context.Background(), nil, fullMethod, nil)
+		time.Sleep(period + 10*time.Millisecond)
+		callUnary(m, context.Background(), nil, fullMethod, nil)
+	}
+
+	t.Run("label", func(t *testing.T) {
+		m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, grpcprom.WithWarmup(2, period, grpcprom.WarmupLabel))
+		reg := newRegistry(t, m)
+		call(m)
+
+		assertMetrics(t, reg, handledHeader+`
+grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK",warmup="false"} 1
+grpc_server_handled_total{grpc_method="SayHello",grpc_service="demo.v1.Greeter",grpc_status="OK",warmup="true"} 2
+`, "grpc_server_handled_total")
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		m := grpcprom.NewServerMetrics(&grpcprom.DefaultLabelExtractor{}, grpcprom.WithWarmup(2, period, grpcprom.WarmupExclude))
+		reg := newRegistry(t, m)
+		call(m)
+
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var observed uint64
+		for _, family := range families {
+			if family.GetName() != "grpc_server_handling_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				observed += metric.GetHistogram().GetSampleCount()
+			}
+		}
+		if observed != 1 {
+			t.Errorf("%d handling times observed, want 1", observed)
+		}
+	})
+}
@@ -0,0 +1,172 @@
+package grpcprom
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// WindowStats are the statistics of the RPCs of a method over the last window.
+type WindowStats struct {
+	Requests uint64
+	// Errors are the RPCs which failed because of the server, like for the SLOs.
+	Errors uint64
+	// ErrorRatio is Errors / Requests, NaN when there was no request.
+	ErrorRatio float64
+	// MeanLatency is the mean handling time, zero when there was no request.
+	MeanLatency time.Duration
+}
+
+// windowSlot holds the counts of one second of a window.
+type windowSlot struct {
+	second   int64
+	requests uint64
+	errors   uint64
+	latency  time.Duration
+}
+
+// maxWindowMethods bounds the methods of the stats window. The RPCs of the new methods seen past
+// that are not tracked until the idle methods are evicted.
+const maxWindowMethods = 1000
+
+// statsWindows keeps, per method, a ring of one-second slots covering the window. The methods are
+// keyed by their service and method labels before relabeling, see methodLabels, so the recorded
+// RPCs and WindowStats agree.
+type statsWindows struct {
+	slots int
+	desc  *prom.Desc
+
+	mu      sync.Mutex
+	methods map[[2]string][]windowSlot
+}
+
+// WithStatsWindow makes the ServerMetrics keep the request, error and latency statistics of
+// every method over a rolling window, with a one-second resolution. They are exported as the
+// grpc_server_error_ratio gauge and read in-process with WindowStats, e.g. by load shedders which
+// can't wait for Prometheus to compute a rate.
+func WithStatsWindow(window time.Duration) ServerMetricsOption {
+	return func(m *ServerMetrics) {
+		slots := int(window / time.Second)
+		if slots < 1 {
+			slots = 1
+		}
+		m.window = &statsWindows{
+			slots: slots,
+			desc: prom.NewDesc(
+				"grpc_server_error_ratio",
+				"Ratio of the RPCs of the method which failed because of the server over the stats window.",
+				[]string{"grpc_service", "grpc_method"}, nil,
+			),
+			methods: map[[2]string][]windowSlot{},
+		}
+	}
+}
+
+// record adds an RPC of the method, which finished with the given status after elapsed.
+func (w *statsWindows) record(service, method, status string, elapsed time.Duration, now time.Time) {
+	second := now.Unix()
+	key := [2]string{service, method}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	ring, ok := w.methods[key]
+	if !ok {
+		if len(w.methods) >= maxWindowMethods {
+			w.evictIdle(second)
+		}
+		if len(w.methods) >= maxWindowMethods {
+			return
+		}
+		ring = make([]windowSlot, w.slots)
+		w.methods[key] = ring
+	}
+
+	slot := &ring[second%int64(w.slots)]
+	if slot.second != second {
+		*slot = windowSlot{second: second}
+	}
+	slot.requests++
+	slot.latency += elapsed
+	if sloErrorCodes[status] {
+		slot.errors++
+	}
+}
+
+// evictIdle deletes the methods without RPCs in the window ending at second.
+func (w *statsWindows) evictIdle(second int64) {
+	oldest := second - int64(w.slots) + 1
+	for key, ring := range w.methods {
+		idle := true
+		for _, slot := range ring {
+			if slot.second >= oldest {
+				idle = false
+				break
+			}
+		}
+		if idle {
+			delete(w.methods, key)
+		}
+	}
+}
+
+// stats sums the slots of the method still in the window.
+func (w *statsWindows) stats(service, method string, now time.Time) WindowStats {
+	oldest := now.Unix() - int64(w.slots) + 1
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		stats   WindowStats
+		latency time.Duration
+	)
+	for _, slot := range w.methods[[2]string{service, method}] {
+		if slot.second >= oldest {
+			stats.Requests += slot.requests
+			stats.Errors += slot.errors
+			latency += slot.latency
+		}
+	}
+
+	stats.ErrorRatio = math.NaN()
+	if stats.Requests > 0 {
+		stats.ErrorRatio = float64(stats.Errors) / float64(stats.Requests)
+		stats.MeanLatency = latency / time.Duration(stats.Requests)
+	}
+	return stats
+}
+
+// WindowStats returns the statistics of the full method (/package.Service/Method) over the
+// WithStatsWindow window, with the method named like in the labels. Without WithStatsWindow
+// there are no requests.
+func (m *ServerMetrics) WindowStats(fullMethod string) WindowStats {
+	if m.window == nil {
+		return WindowStats{ErrorRatio: math.NaN()}
+	}
+	service, method := m.methodLabels(fullMethod)
+	return m.window.stats(service, method, time.Now())
+}
+
+func (w *statsWindows) Describe(ch chan<- *prom.Desc) {
+	ch <- w.desc
+}
+
+// Collect exports the error ratio of the methods with requests in the window.
+func (w *statsWindows) Collect(ch chan<- prom.Metric) {
+	w.mu.Lock()
+	keys := make([][2]string, 0, len(w.methods))
+	for key := range w.methods {
+		keys = append(keys, key)
+	}
+	w.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if stats := w.stats(key[0], key[1], now); stats.Requests > 0 {
+			ch <- prom.MustNewConstMetric(w.desc, prom.GaugeValue, stats.ErrorRatio, key[0], key[1])
+		}
+	}
+}
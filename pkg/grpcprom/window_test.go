@@ -0,0 +1,56 @@
+package grpcprom
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestWindowStatsRelabeled(t *testing.T) {
+	const fullMethod = "/demo.v1.Greeter/SayHello"
+
+	m := NewServerMetrics(&DefaultLabelExtractor{},
+		WithStatsWindow(time.Minute),
+		WithRelabeler(func(labels map[string]string) map[string]string {
+			labels["grpc_method"] = "Renamed"
+			return labels
+		}),
+	)
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	_, _ = m.UnaryServerInterceptor()(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: fullMethod}, handler)
+
+	if got := m.WindowStats(fullMethod).Requests; got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestStatsWindowBoundedMethods(t *testing.T) {
+	m := NewServerMetrics(&DefaultLabelExtractor{}, WithStatsWindow(10*time.Second))
+	w := m.window
+
+	start := time.Now()
+	for i := 0; i < maxWindowMethods; i++ {
+		w.record("demo.v1.Greeter", fmt.Sprintf("Method%d", i), "OK", time.Millisecond, start)
+	}
+
+	// The window is full of busy methods, so the new one is not tracked.
+	w.record("demo.v1.Greeter", "New", "OK", time.Millisecond, start)
+	if got := w.stats("demo.v1.Greeter", "New", start).Requests; got != 0 {
+		t.Errorf("got %d requests of a method past the bound, want 0", got)
+	}
+
+	// Once the busy methods left the window, they are evicted for the new one.
+	later := start.Add(time.Minute)
+	w.record("demo.v1.Greeter", "New", "OK", time.Millisecond, later)
+	if got := w.stats("demo.v1.Greeter", "New", later).Requests; got != 1 {
+		t.Errorf("got %d requests of the new method, want 1", got)
+	}
+	if got := len(w.methods); got != 1 {
+		t.Errorf("got %d methods, want 1", got)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// chaosConfig is the configuration of the chaos interceptor. The rates are the probabilities,
+// between 0 and 1, of injecting each fault into a call. All the faults are disabled by default.
+type chaosConfig struct {
+	// LatencyRate is the probability of delaying the call by Latency.
+	LatencyRate float64
+	Latency     time.Duration
+	// ErrorRate is the probability of failing the call with ErrorCode, without calling the handler.
+	ErrorRate float64
+	ErrorCode codes.Code
+	// LeakRate is the probability of leaking a goroutine which never returns.
+	LeakRate float64
+}
+
+// chaosConfigFromEnv reads the chaos configuration from the CHAOS_* environment variables, e.g.
+// CHAOS_LATENCY_RATE=0.1 CHAOS_LATENCY=200ms CHAOS_ERROR_RATE=0.05 CHAOS_ERROR_CODE=Unavailable
+// CHAOS_LEAK_RATE=0.01. Invalid values are logged and ignored.
+func chaosConfigFromEnv() chaosConfig {
+	config := chaosConfig{
+		Latency:   100 * time.Millisecond,
+		ErrorCode: codes.Unavailable,
+	}
+
+	parseRate := func(name string, rate *float64) {
+		if v := os.Getenv(name); v != "" {
+			if r, err := strconv.ParseFloat(v, 64); err == nil && r >= 0 && r <= 1 {
+				*rate = r
+			} else {
+				log.Printf("ignoring invalid %s %q", name, v)
+			}
+		}
+	}
+	parseRate("CHAOS_LATENCY_RATE", &config.LatencyRate)
+	parseRate("CHAOS_ERROR_RATE", &config.ErrorRate)
+	parseRate("CHAOS_LEAK_RATE", &config.LeakRate)
+
+	if v := os.Getenv("CHAOS_LATENCY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Latency = d
+		} else {
+			log.Printf("ignoring invalid CHAOS_LATENCY %q", v)
+		}
+	}
+	if v := os.Getenv("CHAOS_ERROR_CODE"); v != "" {
+		found := false
+		for c := codes.OK + 1; c <= codes.Unauthenticated; c++ {
+			if c.String() == v {
+				config.ErrorCode, found = c, true
+			}
+		}
+		if !found {
+			log.Printf("ignoring invalid CHAOS_ERROR_CODE %q", v)
+		}
+	}
+	return config
+}
+
+// chaosMetrics injects faults into the calls of the demo server and counts them, to practice
+// correlating the main metric families with known disturbances.
+type chaosMetrics struct {
+	config         chaosConfig
+	injectedFaults *prom.CounterVec
+	leaked         prom.Gauge
+}
+
+func newChaosMetrics(config chaosConfig) *chaosMetrics {
+	return &chaosMetrics{
+		config: config,
+		injectedFaults: prom.NewCounterVec(
+			prom.CounterOpts{
+				Name: "demo_server_chaos_injected_faults_total",
+				Help: "Total number of faults injected into the calls by the chaos interceptor, by fault.",
+			}, []string{"fault"},
+		),
+		leaked: prom.NewGauge(
+			prom.GaugeOpts{
+				Name: "demo_server_chaos_leaked_goroutines",
+				Help: "Number of goroutines leaked by the chaos interceptor.",
+			},
+		),
+	}
+}
+
+func (c *chaosMetrics) Describe(ch chan<- *prom.Desc) {
+	c.injectedFaults.Describe(ch)
+	c.leaked.Describe(ch)
+}
+
+func (c *chaosMetrics) Collect(ch chan<- prom.Metric) {
+	c.injectedFaults.Collect(ch)
+	c.leaked.Collect(ch)
+}
+
+// chaosService is the only service receiving faults, so the channelz calls scraped by the metrics
+// endpoint keep working.
+const chaosService = "/proto.DemoService/"
+
+// UnaryServerInterceptor injects the faults of the configuration into the calls of the demo
+// service.
+func (c *chaosMetrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !strings.HasPrefix(info.FullMethod, chaosService) {
+			return handler(ctx, req)
+		}
+
+		if rand.Float64() < c.config.LeakRate {
+			c.injectedFaults.WithLabelValues("goroutine_leak").Inc()
+			c.leaked.Inc()
+			go func() { select {} }()
+		}
+
+		if rand.Float64() < c.config.LatencyRate {
+			c.injectedFaults.WithLabelValues("latency").Inc()
+			select {
+			case <-time.After(c.config.Latency):
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+		}
+
+		if rand.Float64() < c.config.ErrorRate {
+			c.injectedFaults.WithLabelValues("error").Inc()
+			return nil, status.Errorf(c.config.ErrorCode, "chaos: injected %s error", c.config.ErrorCode)
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	pb "github.com/positiveblue/poc-grpc-prometheus/protobuf"
+)
+
+// sayHelloRoute is the REST route of the SayHello method.
+const sayHelloRoute = "/v1/hello/{name}"
+
+// patternSayHello matches GET /v1/hello/{name}, in the same way the patterns generated by
+// protoc-gen-grpc-gateway do.
+var patternSayHello = runtime.MustPattern(runtime.NewPattern(1, []int{2, 0, 2, 1, 1, 0, 4, 1, 5, 2}, []string{"v1", "hello", "name"}, ""))
+
+// newGatewayHandler returns a grpc-gateway mux serving the DemoService methods as REST endpoints,
+// instrumented with the httpMetrics. The calls are forwarded with client, a loopback connection
+// to the gRPC server, so they also go through its interceptors and are recorded in the gRPC
+// metrics.
+func newGatewayHandler(client pb.DemoServiceClient) http.Handler {
+	mux := runtime.NewServeMux()
+	mux.Handle("GET", patternSayHello, func(w http.ResponseWriter, req *http.Request, pathParams map[string]string) {
+		grpcprom.SetHTTPRoute(req.Context(), sayHelloRoute)
+
+		ctx, cancel := context.WithCancel(req.Context())
+		defer cancel()
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+
+		ctx, err := runtime.AnnotateContext(ctx, mux, req, pb.DemoService_SayHello_FullMethodName, runtime.WithHTTPPathPattern(sayHelloRoute))
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+
+		var md runtime.ServerMetadata
+		resp, err := client.SayHello(ctx, &pb.HelloRequest{Name: pathParams["name"]}, grpc.Header(&md.HeaderMD), grpc.Trailer(&md.TrailerMD))
+		ctx = runtime.NewServerMetadataContext(ctx, md)
+		if err != nil {
+			runtime.HTTPError(ctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+
+		runtime.ForwardResponseMessage(ctx, mux, outboundMarshaler, w, req, resp)
+	})
+
+	return httpMetrics.Middleware(mux)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// transportKey is the header, and therefore the metadata key, set on the calls received
+// through the grpc-web handler.
+const transportKey = "x-grpc-transport"
+
+const (
+	transportGRPC    = "grpc"
+	transportGRPCWeb = "grpc-web"
+)
+
+// TransportLabelExtractor labels every call with the transport it was received through,
+// grpc for native gRPC clients and grpc-web for the browser clients.
+type TransportLabelExtractor struct{}
+
+// LabelNames returns the grpc_transport label
+func (t *TransportLabelExtractor) LabelNames() []string {
+	return []string{"grpc_transport"}
+}
+
+// Labels returns grpc-web for the calls received through newGRPCWebHandler and grpc for the
+// rest. Any other value of the transport metadata is ignored to keep the label bounded.
+func (t *TransportLabelExtractor) Labels(ctx context.Context) map[string]string {
+	transport := transportGRPC
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(transportKey); len(values) > 0 && values[0] == transportGRPCWeb {
+			transport = transportGRPCWeb
+		}
+	}
+	return map[string]string{"grpc_transport": transport}
+}
+
+// newGRPCWebHandler returns a http.Handler serving the grpc-web requests with the grpcServer,
+// so they go through the same interceptors as the native calls, and the rest with next. Only the
+// cross-origin requests from the allowed origins, e.g. http://localhost:3000, are served.
+func newGRPCWebHandler(grpcServer *grpc.Server, allowedOrigins []string, next http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
+	wrappedServer := grpcweb.WrapServer(grpcServer, grpcweb.WithOriginFunc(func(origin string) bool {
+		return allowed[origin]
+	}))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrappedServer.IsGrpcWebRequest(r) || wrappedServer.IsAcceptableGrpcCorsRequest(r) {
+			r.Header.Set(transportKey, transportGRPCWeb)
+			wrappedServer.ServeHTTP(w, r)
+			return
+		}
+
+		// Native clients can't talk to this listener, so don't let anybody fake the transport,
+		// neither directly nor through the metadata headers forwarded by the gateway.
+		r.Header.Del(transportKey)
+		r.Header.Del(runtime.MetadataHeaderPrefix + transportKey)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/peer"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// systemdListeners returns the listeners passed by systemd socket activation, none when the
+// process was not socket activated.
+func systemdListeners() ([]net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// The variables are meant for this process only, not for its children.
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", listenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inheriting the systemd listener %s: %w", name, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// unixListener listens on the unix socket at path, removing the socket left by a previous run.
+func unixListener(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// ListenerLabelExtractor labels every call with the transport of the listener it was received
+// on, tcp or unix, whether the listener was opened by the server or inherited from systemd.
+type ListenerLabelExtractor struct{}
+
+// LabelNames returns the listener label
+func (l *ListenerLabelExtractor) LabelNames() []string {
+	return []string{"listener"}
+}
+
+// Labels returns the network of the peer address of the call, unknown for any other network to
+// keep the label bounded.
+func (l *ListenerLabelExtractor) Labels(ctx context.Context) map[string]string {
+	listener := "unknown"
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		switch network := p.Addr.Network(); network {
+		case "tcp", "unix":
+			listener = network
+		}
+	}
+	return map[string]string{"listener": listener}
+}
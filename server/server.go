@@ -2,174 +2,115 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"google.golang.org/grpc"
-
-	pb "github.com/grpc-ecosystem/go-grpc-prometheus/examples/grpc-server-with-prometheus/protobuf"
-	"github.com/grpc-ecosystem/go-grpc-prometheus/packages/grpcstatus"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	channelz "google.golang.org/grpc/channelz/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/orca"
+	"google.golang.org/grpc/status"
+
+	"github.com/positiveblue/poc-grpc-prometheus/pkg/grpcprom"
+	pb "github.com/positiveblue/poc-grpc-prometheus/protobuf"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 )
 
-/****
-PROOF OF CONCEPT FOR PROMETHEUS METRICS
-****/
-type ServerMetrics struct {
-	labels                 []string
-	serverHandledCounter   *prom.CounterVec
-	serverHandledHistogram *prom.HistogramVec
-}
-
-// NewServerMetrics returns a ServerMetric which exposes the grpc service metrics for prometheus.
-// SeverMetricLabels should contain the name for the custom labels that we want to attach to all the
-// metrics.
-func NewServerMetrics(labelExtractor LabelExtractor) *ServerMetrics {
-	labels := append([]string{"grpc_service", "grpc_method", "grpc_status"}, labelExtractor.LabelNames()...)
-	return &ServerMetrics{
-		labels: labels,
-		serverHandledCounter: prom.NewCounterVec(
-			prom.CounterOpts{
-				Name: "grpc_server_handled_total",
-				Help: "Total number of RPCs completed on the server, regardless of success or failure.",
-			}, labels,
-		),
-		serverHandledHistogram: prom.NewHistogramVec(
-			prom.HistogramOpts{
-				Name:    "grpc_server_handling_seconds",
-				Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
-				Buckets: prom.DefBuckets,
-			}, labels,
-		),
-	}
-}
-
-func (m *ServerMetrics) Describe(ch chan<- *prom.Desc) {
-	m.serverHandledCounter.Describe(ch)
-	m.serverHandledHistogram.Describe(ch)
-}
-
-func (m *ServerMetrics) Collect(ch chan<- prom.Metric) {
-	m.serverHandledCounter.Collect(ch)
-	m.serverHandledHistogram.Collect(ch)
+// DemoServiceServer defines a Server.
+type DemoServiceServer struct {
+	pb.UnimplementedDemoServiceServer
 }
 
-// LabelExtractor must extract the needed labels for each one of the metrics and return
-// an array of labels in the SAME ORDER than the ServerMetricLabels used for creating a NewServerMetrics()
-type LabelExtractor interface {
-	LabelNames() []string
-	Labels(context.Context) map[string]string
+func newDemoServer() *DemoServiceServer {
+	return &DemoServiceServer{}
 }
 
-// DefaultLabelExtractor is a dummy LabelExtractor which returns the empty
-// list when processing the context to get the CustomLabels
-type DefaultLabelExtractor struct{}
+// injectErrorKey is the metadata key used by the demo client scenarios to ask for a failed call.
+const injectErrorKey = "x-inject-error"
 
-// LabelNames returns the names of the extra labels per metric
-func (d *DefaultLabelExtractor) LabelNames() []string {
-	return []string{}
-}
-
-// Labels returns the empty list
-func (d *DefaultLabelExtractor) Labels(ctx context.Context) map[string]string {
-	res := map[string]string{}
-	for _, l := range d.LabelNames() {
-		res[l] = "default"
+// injectedError returns the error requested by the caller through the injectErrorKey metadata, if any.
+func injectedError(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(injectErrorKey)) == 0 {
+		return nil
 	}
-	return res
-}
 
-// Method used for spliting the service/method names of a grpc service
-func splitMethodName(fullMethodName string) (string, string) {
-	fullMethodName = strings.TrimPrefix(fullMethodName, "/") // remove leading slash
-	if i := strings.Index(fullMethodName, "/"); i >= 0 {
-		return fullMethodName[:i], fullMethodName[i+1:]
+	name := md.Get(injectErrorKey)[0]
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c != codes.OK && strings.EqualFold(c.String(), name) {
+			return status.Errorf(c, "injected %s error", c)
+		}
 	}
-	return "unknown", "unknown"
+	return status.Errorf(codes.Unknown, "injected unknown error %q", name)
 }
 
-func (m *ServerMetrics) metricLabels(labelExtractor LabelExtractor, ctx context.Context, info *grpc.UnaryServerInfo) map[string]string {
-	service, method := splitMethodName(info.FullMethod)
+// nameBytesCounter is the per-RPC counter of the bytes of the greeted names.
+const nameBytesCounter = "demo_server_name_bytes_total"
 
-	// Populate basic labels
-	labels := map[string]string{
-		"grpc_service": service,
-		"grpc_method":  method,
+// SayHello implements a interface defined by protobuf.
+func (s *DemoServiceServer) SayHello(ctx context.Context, request *pb.HelloRequest) (*pb.HelloResponse, error) {
+	if err := injectedError(ctx); err != nil {
+		return nil, err
 	}
 
-	// Populate custom labels
-	for k, v := range labelExtractor.Labels(ctx) {
-		labels[k] = v
-	}
+	// Count the bytes of the greeted names with the RPC labels.
+	grpcprom.AddRPCValue(ctx, nameBytesCounter, float64(len(request.Name)))
 
-	// Populate non-initialized custom labels with default value
-	for _, labelName := range m.labels {
-		if _, ok := labels[labelName]; !ok {
-			labels[labelName] = "default"
-		}
+	// Report the cost of the call to the load balancers and the ORCA metrics.
+	if recorder := orca.CallMetricsRecorderFromContext(ctx); recorder != nil {
+		recorder.SetRequestCost("name_bytes", float64(len(request.Name)))
 	}
-	return labels
+	return &pb.HelloResponse{Message: fmt.Sprintf("Hello %s", request.Name)}, nil
 }
 
-// UnaryServerInterceptor is a gRPC server-side interceptor that provides Prometheus monitoring for Unary RPCs.
-func (m *ServerMetrics) UnaryServerInterceptor(labelExtractor LabelExtractor) func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		metricLabels := m.metricLabels(labelExtractor, ctx, info)
-		monitor := newServerReporter(m, metricLabels)
-		resp, err := handler(ctx, req)
-		st, _ := grpcstatus.FromError(err)
-		monitor.labels["grpc_status"] = st.Code().String()
-		monitor.Handled()
-		return resp, err
+// SayHelloStream implements a interface defined by protobuf, greeting every name received until
+// the client closes the stream.
+func (s *DemoServiceServer) SayHelloStream(stream pb.DemoService_SayHelloStreamServer) error {
+	if err := injectedError(stream.Context()); err != nil {
+		return err
 	}
-}
-
-type serverReporter struct {
-	metrics   *ServerMetrics
-	labels    map[string]string
-	startTime time.Time
-}
 
-func newServerReporter(m *ServerMetrics, labels map[string]string) *serverReporter {
-	r := &serverReporter{
-		metrics:   m,
-		labels:    labels,
-		startTime: time.Now(),
+	for {
+		request, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&pb.HelloResponse{Message: fmt.Sprintf("Hello %s", request.Name)}); err != nil {
+			return err
+		}
 	}
-	return r
 }
 
-func (r *serverReporter) Handled() {
-	var orderedLabels []string
-	for _, labelName := range r.metrics.labels {
-		orderedLabels = append(orderedLabels, r.labels[labelName])
+// authenticate is the Authenticator of the demo server. Anonymous calls are allowed, but calls
+// with an authorization header must carry the "Bearer demo" token.
+func authenticate(ctx context.Context, _ string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	switch auth := md.Get("authorization"); {
+	case len(auth) == 0, auth[0] == "Bearer demo":
+		return ctx, nil
+	case auth[0] == "Bearer expired":
+		return nil, grpcprom.ErrCredentialsExpired
+	default:
+		return nil, grpcprom.ErrCredentialsInvalid
 	}
-
-	r.metrics.serverHandledCounter.WithLabelValues(orderedLabels...).Inc()
-	r.metrics.serverHandledHistogram.WithLabelValues(orderedLabels...).Observe(time.Since(r.startTime).Seconds())
-}
-
-/****
-END OF POC FOR PROMETHEUS
-****/
-
-// DemoServiceServer defines a Server.
-type DemoServiceServer struct{}
-
-func newDemoServer() *DemoServiceServer {
-	return &DemoServiceServer{}
-}
-
-// SayHello implements a interface defined by protobuf.
-func (s *DemoServiceServer) SayHello(ctx context.Context, request *pb.HelloRequest) (*pb.HelloResponse, error) {
-	return &pb.HelloResponse{Message: fmt.Sprintf("Hello %s", request.Name)}, nil
 }
 
 type CustomLabelExtractor struct{}
@@ -183,21 +124,147 @@ func (d *CustomLabelExtractor) Labels(ctx context.Context) map[string]string {
 	return map[string]string{"userName": "jordi", "appVersion": "v0.5"}
 }
 
+// newAdaptiveLimiter returns the AdaptiveLimiter of the metrics, exiting if it is misconfigured.
+func newAdaptiveLimiter(metrics *grpcprom.ServerMetrics, latencyTarget time.Duration, errorTarget float64, minLimit, maxLimit int) *grpcprom.AdaptiveLimiter {
+	limiter, err := grpcprom.NewAdaptiveLimiter(metrics, latencyTarget, errorTarget, minLimit, maxLimit)
+	if err != nil {
+		log.Fatalf("failed to create the adaptive limiter: %v", err)
+	}
+	return limiter
+}
+
 var (
 	// Create a metrics registry.
 	reg = prom.NewRegistry()
+	// registerer labels the metrics registered in reg with the pod, namespace, zone and version
+	// of the instance, when they are set.
+	registerer prom.Registerer
 
 	customLabelExtractor = CustomLabelExtractor{}
 
-	// Create some standard server metrics.
-	grpcMetrics = NewServerMetrics(&customLabelExtractor)
+	// connectionAge labels cold the RPCs of the connections established less than a second ago.
+	connectionAge = grpcprom.NewConnectionAgeLabelExtractor(time.Second)
+
+	// The gRPC metrics are also labeled with the transport, to tell grpc-web calls apart, the
+	// listener, the /24 or /64 subnet of the client and the age class of the connection.
+	grpcLabelExtractor = grpcprom.ChainLabelExtractors(
+		&customLabelExtractor,
+		&TransportLabelExtractor{},
+		&ListenerLabelExtractor{},
+		grpcprom.NewPeerSubnetLabelExtractor(24, 64),
+		connectionAge,
+	)
+
+	// The label decisions of the last RPCs are served on /debug/labels.
+	labelAudit = grpcprom.NewLabelAudit(100, nil)
+
+	// Create some standard server metrics, with the SLO of the SayHello method, the
+	// consumption of the caller deadlines and a log of the RPCs slower than 50ms.
+	grpcMetrics = grpcprom.NewServerMetrics(grpcLabelExtractor,
+		grpcprom.WithSLOs(map[string]grpcprom.SLO{
+			"/proto.DemoService/SayHello": {Latency: 100 * time.Millisecond, ErrorRate: 0.01},
+		}),
+		grpcprom.WithDeadlineHistogram(grpcprom.DefDeadlineBuckets),
+		grpcprom.WithSlowRPCHook(50*time.Millisecond, nil, grpcprom.LogSlowRPCs(log.Default())),
+		grpcprom.WithStrictLabels(),
+		grpcprom.WithLabelAudit(labelAudit),
+		grpcprom.WithStatsWindow(time.Minute),
+		grpcprom.WithActiveHandlersGauge("userName"),
+		grpcprom.WithResultHistograms(prom.DefBuckets),
+		grpcprom.WithLabelEcho("/proto.DemoService/SayHello"),
+		grpcprom.WithRPCCounter(nameBytesCounter, "Total number of bytes of the names greeted by SayHello."),
+		grpcprom.WithGCAffectedCounter(),
+		grpcprom.WithExemplarSampling(grpcprom.ExemplarSampling{SuccessEvery: 10, SlowQuantile: 0.99}),
+	)
+
+	// Create the metrics for the REST gateway, sharing the custom labels of the gRPC metrics.
+	httpMetrics = grpcprom.NewHTTPMetrics(&customLabelExtractor)
+
+	// Count the authentication results apart from the application errors.
+	authMetrics = grpcprom.NewAuthMetrics(authenticate)
+
+	// Shed the load above 100 RPCs in flight, or 50 SayHello calls, after waiting 1 second.
+	limiter = grpcprom.NewConcurrencyLimiter(100, time.Second,
+		grpcprom.WithMethodLimit("/proto.DemoService/SayHello", 50),
+	)
+
+	// Shed the batch calls above 50 RPCs in flight, 500ms of queue delay or 512MiB of heap.
+	loadShedder = grpcprom.NewLoadShedder(grpcprom.Watermarks{
+		InFlight:   50,
+		QueueDelay: 500 * time.Millisecond,
+		HeapBytes:  512 << 20,
+	})
+
+	// Adapt the limit of every method, between 10 and 100 RPCs in flight, to keep its mean
+	// latency under 100ms and its error ratio under 5%.
+	adaptiveLimiter = newAdaptiveLimiter(grpcMetrics, 100*time.Millisecond, 0.05, 10, 100)
+
+	// Give every userName a quota of 50 requests per second, with bursts of 100.
+	rateLimiter = grpcprom.NewRateLimiter(grpcMetrics, "userName", 50, 100)
+
+	// Measure the queueing time of the calls sent by the demo client, tolerating 1s of skew.
+	queueDelayMetrics = grpcprom.NewQueueDelayMetrics(time.Second)
+
+	// Measure the CPU time consumed by the handlers, which never block for long, so locking them
+	// to their thread is cheap.
+	cpuMetrics = grpcprom.NewCPUMetrics(grpcprom.WithLockedThreads())
+
+	// Measure the heap allocations of a tenth of the RPCs.
+	allocMetrics = grpcprom.NewAllocMetrics(0.1)
+
+	// Track the open streams and the age of the oldest one.
+	streamMetrics = grpcprom.NewStreamMetrics(true)
+
+	// Create the metrics of the backend load reported by the handlers through ORCA.
+	orcaMetrics = grpcprom.NewORCAMetrics()
+
+	// Create the metrics of the RPCs received by the transport, before the interceptors.
+	tapMetrics = grpcprom.NewTapMetrics()
+
+	// Count the messages bigger than 64KiB and the RPCs failed by the 1MiB limit.
+	msgSizeMetrics = grpcprom.NewMessageSizeMetrics(64 << 10)
+
+	// Count the scrapes of the metrics endpoint.
+	scrapeMetrics = grpcprom.NewScrapeMetrics()
+
+	// Serve the metrics in the format negotiated with the scraper, warning when native histograms
+	// are scraped in a text format.
+	exposition = grpcprom.NewExpositionHandler(reg, grpcprom.ExpositionOptions{EnableOpenMetrics: true, Logger: log.Default()})
+
+	// Count the connections and the RPCs reset by the clients.
+	transportMetrics = grpcprom.NewTransportMetrics()
+
+	// Inject the faults configured with the CHAOS_* environment variables, none by default.
+	chaos = newChaosMetrics(chaosConfigFromEnv())
 
 	serverInterceptors = []grpc.UnaryServerInterceptor{
-		grpcMetrics.UnaryServerInterceptor(&customLabelExtractor),
+		queueDelayMetrics.UnaryServerInterceptor(),
+		adaptiveLimiter.UnaryServerInterceptor(),
+		grpcMetrics.UnaryServerInterceptor(),
+		authMetrics.UnaryServerInterceptor(),
+		loadShedder.UnaryServerInterceptor(),
+		limiter.UnaryServerInterceptor(),
+		rateLimiter.UnaryServerInterceptor(),
+		orcaMetrics.UnaryServerInterceptor(),
+		cpuMetrics.UnaryServerInterceptor(),
+		allocMetrics.UnaryServerInterceptor(),
+		grpcprom.PprofUnaryServerInterceptor(&customLabelExtractor, "userName"),
+		chaos.UnaryServerInterceptor(),
 	}
 
 	serverOptions = []grpc.ServerOption{
-		grpc_middleware.WithUnaryServerChain(serverInterceptors...),
+		// The ORCA call metrics recorder must be installed before the orcaMetrics interceptor.
+		orca.CallMetricsServerOption(nil),
+		// The chain warns if the recovery or auth interceptors run outside of the metrics one.
+		grpcMetrics.UnaryServerChain(log.Default(), serverInterceptors...),
+		grpc_middleware.WithStreamServerChain(streamMetrics.StreamServerInterceptor()),
+		grpc.InTapHandle(tapMetrics.ServerInHandle(nil)),
+		grpc.StatsHandler(msgSizeMetrics),
+		grpc.StatsHandler(transportMetrics.ServerHandler()),
+		// The connections are wrapped to count the GOAWAY frames and tell the connection resets.
+		grpc.Creds(transportMetrics.Credentials(insecure.NewCredentials())),
+		grpc.StatsHandler(connectionAge),
+		grpc.MaxRecvMsgSize(1 << 20),
 	}
 
 	// Create a customized counter metric.
@@ -208,13 +275,48 @@ var (
 )
 
 func init() {
+	var err error
+	registerer, err = grpcprom.WrapRegistererWithInstanceLabels(reg, grpcprom.DefaultInstanceLabels)
+	if err != nil {
+		log.Fatalf("failed to read the instance labels: %v", err)
+	}
+
 	// Register standard server metrics and customized metrics to registry.
-	reg.MustRegister(grpcMetrics)
+	registerer.MustRegister(grpcMetrics)
+	registerer.MustRegister(httpMetrics)
+	registerer.MustRegister(orcaMetrics)
+	registerer.MustRegister(tapMetrics)
+	registerer.MustRegister(msgSizeMetrics)
+	registerer.MustRegister(transportMetrics)
+	registerer.MustRegister(authMetrics)
+	registerer.MustRegister(streamMetrics)
+	registerer.MustRegister(cpuMetrics)
+	registerer.MustRegister(allocMetrics)
+	registerer.MustRegister(queueDelayMetrics)
+	registerer.MustRegister(limiter)
+	registerer.MustRegister(loadShedder)
+	registerer.MustRegister(adaptiveLimiter)
+	registerer.MustRegister(scrapeMetrics)
+	registerer.MustRegister(exposition)
+	registerer.MustRegister(rateLimiter)
+	registerer.MustRegister(chaos)
+	registerer.MustRegister(grpcprom.NewBuildInfoCollector())
+
+	// Count the restarts of the demo in a file of the temporary directory.
+	restarts, err := grpcprom.NewRestartCollector(grpcprom.NewFileStateStore(filepath.Join(os.TempDir(), "demo_server_restarts.json")))
+	if err != nil {
+		log.Fatalf("failed to count the restarts: %v", err)
+	}
+	registerer.MustRegister(restarts)
 	//customizedCounterMetric.WithLabelValues("Test")
 }
 
 // NOTE: Graceful shutdown is missing. Don't use this demo in your production setup.
 func main() {
+	unixSocket := flag.String("unix-socket", "", "path of a unix socket to serve the gRPC API on, besides the TCP port")
+	grpcWebOrigins := flag.String("grpc-web-origins", "", "comma separated origins allowed to send cross-origin grpc-web requests")
+	flag.Parse()
+
 	// Listen an actual port.
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", 9093))
 	if err != nil {
@@ -222,8 +324,51 @@ func main() {
 	}
 	defer lis.Close()
 
-	// Create a HTTP server for prometheus.
-	httpServer := &http.Server{Handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}), Addr: fmt.Sprintf("0.0.0.0:%d", 9092)}
+	// Serve the gRPC API on the unix socket and the listeners passed by systemd socket activation
+	// too, labeling the calls with the transport of their listener.
+	extraListeners, err := systemdListeners()
+	if err != nil {
+		log.Fatalf("failed to inherit the systemd listeners: %v", err)
+	}
+	if *unixSocket != "" {
+		unixLis, err := unixListener(*unixSocket)
+		if err != nil {
+			log.Fatalf("failed to listen on the unix socket: %v", err)
+		}
+		extraListeners = append(extraListeners, unixLis)
+	}
+
+	// Create a HTTP server for prometheus and the health checks, instrumented like the gateway.
+	mux := http.NewServeMux()
+	// OpenMetrics is needed to expose the trace IDs attached as exemplars.
+	mux.Handle("/metrics", scrapeMetrics.InstrumentHandler(exposition))
+	// The aggregated endpoint sums the userName label away, for a central Prometheus.
+	mux.Handle("/metrics/aggregated", promhttp.HandlerFor(grpcprom.NewAggregatingGatherer(reg, "userName"), promhttp.HandlerOpts{}))
+	// The tenant endpoint only serves the series of one userName, to the requests whose
+	// X-Scope-OrgID header, set by the authenticating proxy in front of it, is that userName.
+	authorizeTenant := func(r *http.Request, tenant string) bool {
+		return r.Header.Get("X-Scope-OrgID") == tenant
+	}
+	mux.Handle("/metrics/tenant/{id}", grpcprom.NewTenantHandler(reg, "userName", authorizeTenant, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/debug/labels", labelAudit)
+	// The profiles are labeled with the service, method and userName of the RPCs.
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	metricsOpts := grpcprom.MetricsServerOptions{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", 9092),
+		Handler: httpMetrics.InstrumentMux(mux),
+		OnError: func(err error) {
+			log.Fatalf("the metrics http server failed: %v", err)
+		},
+	}
+	// The scrapes must carry the token when METRICS_TOKEN is set.
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		metricsOpts.Authenticate = grpcprom.BearerToken(token)
+	}
+	metricsServer := grpcprom.NewMetricsServer(metricsOpts)
 
 	// Create a gRPC Server with gRPC interceptor.
 	grpcServer := grpc.NewServer(
@@ -237,15 +382,60 @@ func main() {
 	pb.RegisterDemoServiceServer(grpcServer, demoServer)
 
 	// Initialize all metrics.
-	//grpcMetrics.InitializeMetrics(grpcServer)
+	grpcMetrics.InitializeMetrics(grpcServer)
+
+	// Expose the channelz data of the process, read through a loopback connection. It is
+	// registered after initializing the metrics so only the demo methods are initialized.
+	channelz.RegisterChannelzServiceToServer(grpcServer)
+	// The tap, message size and transport metrics label the RPCs of every registered service, the
+	// others are unknown.
+	tapMetrics.InitializeMetrics(grpcServer)
+	msgSizeMetrics.InitializeMetrics(grpcServer)
+	transportMetrics.InitializeMetrics(grpcServer)
+	channelzConn, err := grpc.Dial(fmt.Sprintf("localhost:%d", 9093), grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("failed to dial the channelz service: %v", err)
+	}
+	defer channelzConn.Close()
+	registerer.MustRegister(grpcprom.NewChannelzCollector(channelzpb.NewChannelzClient(channelzConn)))
+
+	// Create a HTTP server for the REST gateway and the grpc-web clients of the api server. The
+	// gateway calls the gRPC server through a loopback connection, like the channelz collector.
+	gatewayConn, err := grpc.Dial(fmt.Sprintf("localhost:%d", 9093), grpc.WithInsecure())
+	if err != nil {
+		log.Fatalf("failed to dial the gRPC server for the gateway: %v", err)
+	}
+	defer gatewayConn.Close()
+	var allowedOrigins []string
+	if *grpcWebOrigins != "" {
+		allowedOrigins = strings.Split(*grpcWebOrigins, ",")
+	}
+	gatewayServer := &http.Server{
+		Handler: newGRPCWebHandler(grpcServer, allowedOrigins, newGatewayHandler(pb.NewDemoServiceClient(gatewayConn))),
+		Addr:    fmt.Sprintf("0.0.0.0:%d", 8080),
+	}
+
+	// Adjust the adaptive limits every second.
+	go adaptiveLimiter.Run(context.Background(), time.Second)
 
 	// Start your http server for prometheus.
+	if err := metricsServer.Start(); err != nil {
+		log.Fatalf("Unable to start a http server: %v", err)
+	}
+
+	// Start your http server for the REST gateway and grpc-web.
 	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
-			log.Fatal("Unable to start a http server.")
+		if err := gatewayServer.ListenAndServe(); err != nil {
+			log.Fatal("Unable to start the gateway http server.")
 		}
 	}()
 
+	for _, extraLis := range extraListeners {
+		go func(extraLis net.Listener) {
+			log.Fatal(grpcServer.Serve(extraLis))
+		}(extraLis)
+	}
+
 	// Start your gRPC server.
 	log.Fatal(grpcServer.Serve(lis))
 }